@@ -0,0 +1,298 @@
+// Package archive unpacks template archives.
+//
+// Zip files and gzipped tarballs are supported; the format is told from the
+// content, not the file name, since download URLs often have neither.
+//
+// Archives are untrusted input. Entries that would land outside the
+// destination, through "..", an absolute path or a symbolic link, are
+// rejected, and nothing but regular files, directories and, by choice,
+// symbolic links is ever created.
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/CeoFred/nturu/glob"
+)
+
+var (
+	zipMagic  = []byte("PK\x03\x04")
+	gzipMagic = []byte{0x1f, 0x8b}
+)
+
+// DefaultExclude lists the operating system litter archivers pick up, which
+// is never part of a template.
+var DefaultExclude = []string{"**/__MACOSX/", ".DS_Store", "._*", "Thumbs.db", "desktop.ini"}
+
+// SymlinkPolicy says what to do with symbolic links in an archive.
+type SymlinkPolicy int
+
+const (
+	// SkipSymlinks leaves symbolic links out.
+	SkipSymlinks SymlinkPolicy = iota
+	// RejectSymlinks fails the extraction on the first symbolic link.
+	RejectSymlinks
+	// KeepSymlinks creates symbolic links whose target stays inside the
+	// destination and rejects the others.
+	KeepSymlinks
+)
+
+// Options tune an extraction. The zero value skips symbolic links and
+// excludes nothing beyond DefaultExclude.
+type Options struct {
+	// Exclude holds glob patterns, in the syntax of package glob, of entries
+	// to leave out in addition to DefaultExclude.
+	Exclude  []string
+	Symlinks SymlinkPolicy
+}
+
+// Extract unpacks the archive at src into the existing directory dst.
+func Extract(src, dst string, opts Options) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	magic, err := bufio.NewReader(f).Peek(4)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	switch {
+	case bytes.HasPrefix(magic, zipMagic):
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		return ExtractZip(f, info.Size(), dst, opts)
+	case bytes.HasPrefix(magic, gzipMagic):
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		return ExtractTarGz(f, dst, opts)
+	}
+	return fmt.Errorf("%s: not a zip or tar.gz archive", src)
+}
+
+// ExtractZip unpacks the zip archive in r, size bytes long, into the
+// existing directory dst.
+func ExtractZip(r io.ReaderAt, size int64, dst string, opts Options) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+	x := &extractor{dst: dst, opts: opts}
+	for _, file := range zr.File {
+		if err := x.zipEntry(file); err != nil {
+			return fmt.Errorf("archive entry %q: %w", file.Name, err)
+		}
+	}
+	return nil
+}
+
+// ExtractTarGz unpacks the gzipped tarball read from r into the existing
+// directory dst.
+func ExtractTarGz(r io.Reader, dst string, opts Options) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	x := &extractor{dst: dst, opts: opts}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := x.tarEntry(hdr, tr); err != nil {
+			return fmt.Errorf("archive entry %q: %w", hdr.Name, err)
+		}
+	}
+}
+
+type extractor struct {
+	dst  string
+	opts Options
+}
+
+func (x *extractor) zipEntry(file *zip.File) error {
+	mode := file.Mode()
+	switch {
+	case mode.IsDir():
+		return x.dir(file.Name)
+	case mode&fs.ModeSymlink != 0:
+		rc, err := file.Open()
+		if err != nil {
+			return err
+		}
+		// A link target is a path, never more than a few kilobytes.
+		target, err := io.ReadAll(io.LimitReader(rc, 4096))
+		rc.Close()
+		if err != nil {
+			return err
+		}
+		return x.symlink(file.Name, string(target))
+	case mode.IsRegular():
+		rc, err := file.Open()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		return x.file(file.Name, mode, rc)
+	}
+	return nil
+}
+
+func (x *extractor) tarEntry(hdr *tar.Header, r io.Reader) error {
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		return x.dir(hdr.Name)
+	case tar.TypeSymlink:
+		return x.symlink(hdr.Name, hdr.Linkname)
+	case tar.TypeReg, tar.TypeRegA:
+		return x.file(hdr.Name, hdr.FileInfo().Mode(), r)
+	case tar.TypeLink:
+		// A hard link could alias a file outside the destination on
+		// extraction, and templates have no use for one.
+		return errors.New("hard links are not supported")
+	}
+	// Devices, fifos and PAX metadata entries are not part of a template.
+	return nil
+}
+
+func (x *extractor) dir(name string) error {
+	target, skip, err := x.target(name)
+	if err != nil || skip {
+		return err
+	}
+	return os.MkdirAll(target, 0755)
+}
+
+// file writes a regular file, executable by everyone when the archive marks
+// it executable for anyone, and otherwise readable by everyone.
+func (x *extractor) file(name string, mode fs.FileMode, r io.Reader) error {
+	target, skip, err := x.target(name)
+	if err != nil || skip {
+		return err
+	}
+	perm := fs.FileMode(0644)
+	if mode&0111 != 0 {
+		perm = 0755
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	// An earlier entry of the same name, a link in particular, is replaced
+	// rather than written through.
+	if err := os.Remove(target); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	// The umask may have dropped bits the template relies on.
+	return os.Chmod(target, perm)
+}
+
+func (x *extractor) symlink(name, link string) error {
+	switch x.opts.Symlinks {
+	case SkipSymlinks:
+		return nil
+	case RejectSymlinks:
+		return errors.New("symbolic links are not allowed")
+	}
+	target, skip, err := x.target(name)
+	if err != nil || skip {
+		return err
+	}
+	link = strings.ReplaceAll(link, `\`, "/")
+	if path.IsAbs(link) || filepath.IsAbs(link) || filepath.VolumeName(link) != "" {
+		return fmt.Errorf("symbolic link to absolute path %q", link)
+	}
+	// Links are resolved relative to their own directory, which target
+	// checked is not reached through a link. ".." after a name could climb
+	// out of another link, so it may only lead the target; then the lexical
+	// result is where the link really points.
+	named := false
+	for _, part := range strings.Split(link, "/") {
+		if part == ".." && named {
+			return fmt.Errorf("symbolic link to %q climbs out of a directory it entered", link)
+		}
+		named = named || part != ".." && part != "." && part != ""
+	}
+	resolved := path.Join(path.Dir(clean(name)), link)
+	if resolved == ".." || strings.HasPrefix(resolved, "../") {
+		return fmt.Errorf("symbolic link to %q points outside the archive", link)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	if err := os.Remove(target); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return os.Symlink(filepath.FromSlash(link), target)
+}
+
+// target returns where the entry called name lands under dst, and whether
+// it is excluded. It refuses names that would land outside dst, either
+// directly or through a symbolic link created by an earlier entry.
+func (x *extractor) target(name string) (string, bool, error) {
+	rel := clean(name)
+	if rel == "." {
+		return x.dst, false, nil
+	}
+	if path.IsAbs(rel) || filepath.VolumeName(rel) != "" || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", false, errors.New("path is outside the archive")
+	}
+	if glob.Any(DefaultExclude, rel) || glob.Any(x.opts.Exclude, rel) {
+		return "", true, nil
+	}
+
+	dir := x.dst
+	parts := strings.Split(rel, "/")
+	for _, part := range parts[:len(parts)-1] {
+		dir = filepath.Join(dir, part)
+		info, err := os.Lstat(dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		if err != nil {
+			return "", false, err
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			return "", false, errors.New("path goes through a symbolic link")
+		}
+	}
+	return filepath.Join(x.dst, filepath.FromSlash(rel)), false, nil
+}
+
+// clean normalises an entry name to a slash-separated path, treating
+// backslashes as separators the way Windows archivers write them.
+func clean(name string) string {
+	return path.Clean(strings.ReplaceAll(name, `\`, "/"))
+}
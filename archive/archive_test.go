@@ -0,0 +1,297 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// entry is one member of a test archive. A non-empty link makes it a
+// symbolic link; a name ending in / a directory.
+type entry struct {
+	name string
+	body string
+	mode fs.FileMode
+	link string
+}
+
+func makeZip(t *testing.T, entries ...entry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+		mode := e.mode
+		switch {
+		case e.link != "":
+			mode = fs.ModeSymlink | 0777
+		case strings.HasSuffix(e.name, "/"):
+			mode = fs.ModeDir | 0755
+		case mode == 0:
+			mode = 0644
+		}
+		hdr.SetMode(mode)
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body := e.body
+		if e.link != "" {
+			body = e.link
+		}
+		if _, err := w.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func makeTarGz(t *testing.T, entries ...entry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: int64(e.mode), Size: int64(len(e.body)), Typeflag: tar.TypeReg}
+		switch {
+		case e.link != "":
+			hdr.Typeflag, hdr.Linkname, hdr.Size, hdr.Mode = tar.TypeSymlink, e.link, 0, 0777
+		case strings.HasSuffix(e.name, "/"):
+			hdr.Typeflag, hdr.Mode = tar.TypeDir, 0755
+		case hdr.Mode == 0:
+			hdr.Mode = 0644
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// extract writes data to a file and extracts it into a fresh directory
+// inside a parent, so escapes land next to dst where the test can see them.
+func extract(t *testing.T, data []byte, opts Options) (dst string, err error) {
+	t.Helper()
+	parent := t.TempDir()
+	src := filepath.Join(parent, "template.archive")
+	if err := os.WriteFile(src, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	dst = filepath.Join(parent, "dst")
+	if err := os.Mkdir(dst, 0755); err != nil {
+		t.Fatal(err)
+	}
+	return dst, Extract(src, dst, opts)
+}
+
+// formats builds the same entries as each supported archive format.
+var formats = []struct {
+	name string
+	make func(*testing.T, ...entry) []byte
+}{
+	{"zip", makeZip},
+	{"tar.gz", makeTarGz},
+}
+
+func TestExtract(t *testing.T) {
+	for _, format := range formats {
+		t.Run(format.name, func(t *testing.T) {
+			data := format.make(t,
+				entry{name: "tpl/"},
+				entry{name: "tpl/template.yaml", body: "name: x\n"},
+				entry{name: "tpl/scripts/run.sh", body: "#!/bin/sh\n", mode: 0700},
+				entry{name: `tpl\windows.txt`, body: "dos"},
+				entry{name: "tpl/.DS_Store", body: "junk"},
+				entry{name: "__MACOSX/tpl/._template.yaml", body: "junk"},
+				entry{name: "tpl/._run.sh", body: "junk"},
+				entry{name: "tpl/secret.env", body: "junk"},
+			)
+			dst, err := extract(t, data, Options{Exclude: []string{"*.env"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			filepath.WalkDir(dst, func(name string, d fs.DirEntry, err error) error {
+				if err == nil && !d.IsDir() {
+					rel, _ := filepath.Rel(dst, name)
+					got = append(got, filepath.ToSlash(rel))
+				}
+				return err
+			})
+			want := []string{"tpl/scripts/run.sh", "tpl/template.yaml", "tpl/windows.txt"}
+			if strings.Join(got, " ") != strings.Join(want, " ") {
+				t.Errorf("extracted %q, want %q", got, want)
+			}
+
+			if runtime.GOOS == "windows" {
+				return
+			}
+			for name, perm := range map[string]fs.FileMode{"tpl/scripts/run.sh": 0755, "tpl/template.yaml": 0644} {
+				info, err := os.Stat(filepath.Join(dst, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if info.Mode().Perm() != perm {
+					t.Errorf("%s mode = %v, want %v", name, info.Mode().Perm(), perm)
+				}
+			}
+		})
+	}
+}
+
+func TestExtractRejectsTraversal(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []entry
+	}{
+		{"parent", []entry{{name: "../evil", body: "x"}}},
+		{"nested parent", []entry{{name: "tpl/../../evil", body: "x"}}},
+		{"backslash parent", []entry{{name: `..\evil`, body: "x"}}},
+		{"absolute", []entry{{name: "/tmp/evil", body: "x"}}},
+		{"directory", []entry{{name: "../evil/"}}},
+	}
+	for _, format := range formats {
+		for _, tt := range tests {
+			t.Run(format.name+"/"+tt.name, func(t *testing.T) {
+				dst, err := extract(t, format.make(t, tt.entries...), Options{})
+				if err == nil {
+					t.Fatal("Extract succeeded, want an error")
+				}
+				if _, err := os.Lstat(filepath.Join(filepath.Dir(dst), "evil")); !errors.Is(err, fs.ErrNotExist) {
+					t.Errorf("entry escaped the destination: %v", err)
+				}
+			})
+		}
+	}
+}
+
+func TestExtractSymlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links need privileges on Windows")
+	}
+	for _, format := range formats {
+		t.Run(format.name, func(t *testing.T) {
+			inside := format.make(t,
+				entry{name: "tpl/README.md", body: "hi"},
+				entry{name: "tpl/docs/README.md", link: "../README.md"},
+			)
+
+			dst, err := extract(t, inside, Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Lstat(filepath.Join(dst, "tpl/docs/README.md")); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("SkipSymlinks created the link: %v", err)
+			}
+
+			if _, err := extract(t, inside, Options{Symlinks: RejectSymlinks}); err == nil {
+				t.Error("RejectSymlinks: Extract succeeded, want an error")
+			}
+
+			dst, err = extract(t, inside, Options{Symlinks: KeepSymlinks})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if data, err := os.ReadFile(filepath.Join(dst, "tpl/docs/README.md")); err != nil || string(data) != "hi" {
+				t.Errorf("KeepSymlinks: link reads %q, %v", data, err)
+			}
+		})
+	}
+}
+
+func TestExtractRejectsEscapingSymlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links need privileges on Windows")
+	}
+	tests := []struct {
+		name    string
+		entries []entry
+	}{
+		{"parent", []entry{{name: "evil", link: ".."}}},
+		{"absolute", []entry{{name: "evil", link: "/etc/passwd"}}},
+		{"deep parent", []entry{{name: "a/evil", link: "../../x"}}},
+		// b points at ".", so b/.. is the parent of the destination even
+		// though it looks like the destination itself.
+		{"through link", []entry{{name: "b", link: "."}, {name: "evil", link: "b/.."}}},
+		// The link itself is harmless until an entry is written through it.
+		{"write through", []entry{{name: "a/b/", body: ""}, {name: "a/up", link: ".."}, {name: "a/up/up/evil", body: "x"}}},
+	}
+	for _, format := range formats {
+		for _, tt := range tests {
+			t.Run(format.name+"/"+tt.name, func(t *testing.T) {
+				dst, err := extract(t, format.make(t, tt.entries...), Options{Symlinks: KeepSymlinks})
+				if err == nil {
+					t.Fatal("Extract succeeded, want an error")
+				}
+				if _, err := os.Lstat(filepath.Join(filepath.Dir(dst), "evil")); !errors.Is(err, fs.ErrNotExist) {
+					t.Errorf("entry escaped the destination: %v", err)
+				}
+			})
+		}
+	}
+}
+
+func TestExtractReplacesLinkInsteadOfWritingThrough(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links need privileges on Windows")
+	}
+	for _, format := range formats {
+		t.Run(format.name, func(t *testing.T) {
+			data := format.make(t,
+				entry{name: "target", body: "original"},
+				entry{name: "link", link: "target"},
+				entry{name: "link", body: "replaced"},
+			)
+			dst, err := extract(t, data, Options{Symlinks: KeepSymlinks})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if data, _ := os.ReadFile(filepath.Join(dst, "target")); string(data) != "original" {
+				t.Errorf("target = %q, want it untouched", data)
+			}
+			if data, _ := os.ReadFile(filepath.Join(dst, "link")); string(data) != "replaced" {
+				t.Errorf("link = %q, want %q", data, "replaced")
+			}
+		})
+	}
+}
+
+func TestExtractRejectsHardLinks(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	tw.WriteHeader(&tar.Header{Name: "evil", Typeflag: tar.TypeLink, Linkname: "/etc/passwd"})
+	tw.Close()
+	gz.Close()
+
+	if _, err := extract(t, buf.Bytes(), Options{Symlinks: KeepSymlinks}); err == nil {
+		t.Fatal("Extract succeeded, want an error")
+	}
+}
+
+func TestExtractUnknownFormat(t *testing.T) {
+	if _, err := extract(t, []byte("<html>not found</html>"), Options{}); err == nil {
+		t.Fatal("Extract succeeded, want an error")
+	}
+}
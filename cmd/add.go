@@ -0,0 +1,230 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/CeoFred/nturu/lock"
+	"github.com/CeoFred/nturu/scaffold"
+)
+
+var AddDir string
+var AddDryRun bool
+var HandlerMethod string
+var HandlerPath string
+var HandlerAuth bool
+var MiddlewareGroup string
+var ResourceFields []string
+
+func init() {
+	addCmd.PersistentFlags().StringVarP(&AddDir, "dir", "C", ".", "project directory")
+	addCmd.PersistentFlags().BoolVar(&AddDryRun, "dry-run", false, "list the files that would change without writing anything")
+
+	addHandlerCmd.Flags().StringVar(&HandlerMethod, "method", "GET", "HTTP method: GET, POST, PUT, PATCH or DELETE")
+	addHandlerCmd.Flags().StringVar(&HandlerPath, "path", "", "route below the API prefix, e.g. /orders/:id (defaults to /<resource>)")
+	addHandlerCmd.Flags().BoolVar(&HandlerAuth, "auth", false, "put the route behind the JWT middleware")
+	addCmd.AddCommand(addHandlerCmd)
+	addCmd.AddCommand(addModelCmd)
+
+	addMiddlewareCmd.Flags().StringVar(&MiddlewareGroup, "group", "", "register on the route group of this resource, e.g. orders, instead of every route")
+	addCmd.AddCommand(addMiddlewareCmd)
+
+	addResourceCmd.Flags().StringSliceVar(&ResourceFields, "fields", nil, "fields of the model as name:type, comma-separated or repeated")
+	addCmd.AddCommand(addResourceCmd)
+
+	rootCmd.AddCommand(addCmd)
+}
+
+var addCmd = &cobra.Command{
+	Use:   "add",
+	Short: "Adds code to a generated project the way its template writes it.",
+	Long: `Adds code to a generated project the way its template writes it.
+
+The project is found through ` + lock.File + `, which also tells which template
+it came from. Declarations the project already has are left alone, and
+registrations are only inserted where they are missing, so running the same
+command twice changes nothing the second time.`,
+}
+
+var addHandlerCmd = &cobra.Command{
+	Use:   "handler <resource>.<action>",
+	Short: "Adds an HTTP handler and registers its route.",
+	Long: `Adds an HTTP handler and registers its route.
+
+	nturu add handler orders.create --method POST --path /orders --auth
+
+adds a Create method with swagger annotations to the handler of the orders
+resource in internal/handlers, and routes POST /orders to it in the function
+of internal/routes that creates the orders group, behind the JWT middleware.
+POST, PUT and PATCH handlers also get a request body type in
+internal/helpers and a validator in internal/validators.
+
+A resource without a route group gets a handler type, a register function
+creating its group and a call to it in Routes. Handlers are supported in
+fiber projects.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		resource, action, err := scaffold.ParseHandler(args[0])
+		if err != nil {
+			return err
+		}
+		p, err := scaffold.Open(AddDir)
+		if err != nil {
+			return err
+		}
+		err = p.AddHandler(scaffold.Handler{
+			Resource: resource,
+			Action:   action,
+			Method:   HandlerMethod,
+			Path:     HandlerPath,
+			Auth:     HandlerAuth,
+		})
+		if err != nil {
+			return err
+		}
+		return applyAddition(cmd, p, "handler "+args[0])
+	},
+}
+
+var addModelCmd = &cobra.Command{
+	Use:   "model <name> [field:type...]",
+	Short: "Adds a model with its migration.",
+	Long: `Adds a model with its migration.
+
+	nturu add model Product name:string price:float64 owner_id:uuid
+
+Every model gets an id primary key and created_at and updated_at timestamps
+besides its fields. Field types are string, text, int, int32, int64,
+float32, float64, bool, time, uuid and json; they map to Go types and to
+Postgres columns such as VARCHAR(255), DOUBLE PRECISION and UUID.
+
+In fiber projects the model goes in internal/models, a repository with a
+finder for every field in internal/repository, and the query creating its
+table in the list database.RunManualMigration runs. In default projects a
+bun model goes in internal/db/models.go and a bun migration in
+internal/db/migrations, which main runs after connecting to the database.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		m := scaffold.Model{Name: args[0]}
+		for _, arg := range args[1:] {
+			f, err := scaffold.ParseField(arg)
+			if err != nil {
+				return err
+			}
+			m.Fields = append(m.Fields, f)
+		}
+		p, err := scaffold.Open(AddDir)
+		if err != nil {
+			return err
+		}
+		if err := p.AddModel(m); err != nil {
+			return err
+		}
+		return applyAddition(cmd, p, "model "+args[0])
+	},
+}
+
+var addMiddlewareCmd = &cobra.Command{
+	Use:   "middleware <name>",
+	Short: "Adds a middleware and registers it.",
+	Long: `Adds a middleware and registers it.
+
+	nturu add middleware tenant
+	nturu add middleware audit --group orders
+
+adds TenantMiddleware, which passes every request on, to internal/middleware
+with a test stub next to it. In fiber projects it takes the database like
+JWTMiddleware and returns a fiber.Handler; it is registered for every route
+with app.Use in main, right before routes.Routes binds them, or with --group
+on the route group of a resource in internal/routes. In default projects it
+is a bunrouter middleware, registered among the options of bunrouter.New in
+Microservice.Run, or with --group on the group a service file creates with
+router.NewGroup.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		p, err := scaffold.Open(AddDir)
+		if err != nil {
+			return err
+		}
+		if err := p.AddMiddleware(scaffold.Middleware{Name: args[0], Group: MiddlewareGroup}); err != nil {
+			return err
+		}
+		return applyAddition(cmd, p, "middleware "+args[0])
+	},
+}
+
+var addResourceCmd = &cobra.Command{
+	Use:   "resource <name>",
+	Short: "Adds a model served with list, get, create, update and delete endpoints.",
+	Long: `Adds a model served with list, get, create, update and delete endpoints.
+
+	nturu add resource invoices --fields number:string,total:float64,due:time
+
+adds the bun model Invoice with its migration as add model does, and an
+InvoiceStore in internal/db reading and writing it through the *bun.DB
+NewMicroservice is given, which Microservice keeps from now on. Handlers in
+service/invoices.go, each with a tracing span, are routed in Run:
+
+	GET    /v1/invoices       a page of invoices, ?limit= (default 20, at most 100) and ?offset=
+	POST   /v1/invoices       creates one
+	GET    /v1/invoices/:id   gets one
+	PUT    /v1/invoices/:id   replaces one
+	DELETE /v1/invoices/:id   deletes one
+
+Create and update require every field in the JSON body. Resources are
+supported in default projects.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r := scaffold.Resource{Name: args[0]}
+		for _, arg := range ResourceFields {
+			f, err := scaffold.ParseField(arg)
+			if err != nil {
+				return err
+			}
+			r.Fields = append(r.Fields, f)
+		}
+		p, err := scaffold.Open(AddDir)
+		if err != nil {
+			return err
+		}
+		if err := p.AddResource(r); err != nil {
+			return err
+		}
+		return applyAddition(cmd, p, "resource "+args[0])
+	},
+}
+
+// applyAddition lists the files an addition changes and writes them,
+// unless --dry-run is set.
+func applyAddition(cmd *cobra.Command, p *scaffold.Project, what string) error {
+	out := cmd.OutOrStdout()
+	changes := p.Changes()
+	if len(changes) == 0 {
+		fmt.Fprintf(out, "The project already has %s; nothing to change\n", what)
+		return nil
+	}
+
+	verb := "Adding"
+	if AddDryRun {
+		verb = "Would add"
+	}
+	fmt.Fprintf(out, "%s %s\n", verb, what)
+	for _, c := range changes {
+		action := "update"
+		if c.Created {
+			action = "create"
+		}
+		fmt.Fprintf(out, "  %s %s\n", action, c.Path)
+	}
+	if AddDryRun {
+		return nil
+	}
+	if err := p.Apply(); err != nil {
+		return err
+	}
+	for _, note := range p.Notes() {
+		fmt.Fprintln(out, "Note:", note)
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/CeoFred/nturu/diff"
+	"github.com/CeoFred/nturu/generator"
+	"github.com/CeoFred/nturu/glob"
+	"github.com/CeoFred/nturu/lock"
+)
+
+var DiffDir string
+var DiffStat bool
+var DiffContext int
+
+func init() {
+	diffCmd.Flags().StringVarP(&DiffDir, "dir", "C", ".", "project directory")
+	diffCmd.Flags().BoolVar(&DiffStat, "stat", false, "only list changed files with counts of changed lines")
+	diffCmd.Flags().IntVarP(&DiffContext, "unified", "U", 3, "lines of context around changes")
+	rootCmd.AddCommand(diffCmd)
+}
+
+var diffCmd = &cobra.Command{
+	Use:   "diff [path...]",
+	Short: "Shows how a project differs from the template it was generated from.",
+	Long: `Shows how a project differs from the template it was generated from.
+
+The template recorded in ` + lock.File + ` is rendered again with the recorded
+answers and features into a scratch directory, and every file it produces is
+compared with the project: lines starting with - come from the template,
+lines starting with + from the project. Files the project added itself are
+not shown.
+
+Paths limit the comparison to matching files; they are directories or
+glob patterns such as internal/ or '*.go'.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		l, err := lock.Read(DiffDir)
+		if err != nil {
+			return err
+		}
+		t, err := catalog.ResolvePinned(l.Template.Ref, l.Template.Commit, l.Template.Digest)
+		if err != nil {
+			return err
+		}
+		defer t.Close()
+		if t.Manifest.Version != l.Template.Version {
+			fmt.Fprintf(os.Stderr, "Warning: %s %s is no longer available; comparing with %s\n", l.Template.Name, l.Template.Version, t.Manifest.Version)
+		}
+
+		values, err := resolveLocked(t.Manifest, l, nil)
+		if err != nil {
+			return err
+		}
+		features, err := lockedFeatures(t.Manifest, l, nil, nil, nil)
+		if err != nil {
+			return err
+		}
+
+		scratch, err := os.MkdirTemp("", "nturu-diff-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(scratch)
+		files, err := generator.New(t.FS, t.Manifest, values, features).Generate(cmd.Context(), scratch)
+		if err != nil {
+			return err
+		}
+
+		var paths []string
+		for _, f := range files {
+			if matchesPaths(f.Path, args) {
+				paths = append(paths, f.Path)
+			}
+		}
+		sort.Strings(paths)
+
+		var stats []fileStat
+		for _, name := range paths {
+			rendered, err := os.ReadFile(filepath.Join(scratch, filepath.FromSlash(name)))
+			if err != nil {
+				return err
+			}
+			project, err := os.ReadFile(filepath.Join(DiffDir, filepath.FromSlash(name)))
+			missing := errors.Is(err, fs.ErrNotExist)
+			if err != nil && !missing {
+				return err
+			}
+
+			stat, err := diffFile(cmd.OutOrStdout(), name, rendered, project, missing)
+			if err != nil {
+				return err
+			}
+			if stat != nil {
+				stats = append(stats, *stat)
+			}
+		}
+		if DiffStat {
+			printDiffStat(cmd.OutOrStdout(), stats)
+		}
+		return nil
+	},
+}
+
+// fileStat counts the changes to one file, for --stat.
+type fileStat struct {
+	path           string
+	added, removed int
+	binary         bool
+}
+
+// diffFile prints the diff between the template's and the project's version
+// of name, unless --stat is set, and returns its counts or nil when the two
+// are the same.
+func diffFile(out io.Writer, name string, rendered, project []byte, missing bool) (*fileStat, error) {
+	if !missing && string(rendered) == string(project) {
+		return nil, nil
+	}
+
+	from, to := "a/"+name, "b/"+name
+	if missing {
+		to = "/dev/null"
+	}
+	if diff.IsBinary(rendered) || diff.IsBinary(project) {
+		if !DiffStat {
+			_, err := fmt.Fprintf(out, "Binary files %s and %s differ\n", from, to)
+			return &fileStat{path: name, binary: true}, err
+		}
+		return &fileStat{path: name, binary: true}, nil
+	}
+
+	a, b := diff.Lines(rendered), diff.Lines(project)
+	added, removed := diff.Stat(a, b)
+	if !DiffStat {
+		if _, err := io.WriteString(out, diff.Unified(from, to, a, b, DiffContext)); err != nil {
+			return nil, err
+		}
+	}
+	return &fileStat{path: name, added: added, removed: removed}, nil
+}
+
+// matchesPaths reports whether name is selected by the path arguments: a
+// file or directory path, or a glob pattern. No arguments select every file.
+func matchesPaths(name string, paths []string) bool {
+	if len(paths) == 0 {
+		return true
+	}
+	for _, p := range paths {
+		p = strings.TrimPrefix(filepath.ToSlash(filepath.Clean(p)), "./")
+		if p == "." || name == p || strings.HasPrefix(name, p+"/") || glob.Match(p, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// printDiffStat prints one line per changed file and a summary, in the
+// style of git diff --stat.
+func printDiffStat(out io.Writer, stats []fileStat) {
+	if len(stats) == 0 {
+		return
+	}
+	width, most := 0, 0
+	for _, s := range stats {
+		width = max(width, len(s.path))
+		most = max(most, s.added+s.removed)
+	}
+
+	const barWidth = 40
+	added, removed := 0, 0
+	for _, s := range stats {
+		if s.binary {
+			fmt.Fprintf(out, " %-*s | Bin\n", width, s.path)
+			continue
+		}
+		plus, minus := s.added, s.removed
+		if most > barWidth {
+			plus = (s.added*barWidth + most - 1) / most
+			minus = (s.removed*barWidth + most - 1) / most
+		}
+		fmt.Fprintf(out, " %-*s | %d %s%s\n", width, s.path, s.added+s.removed, strings.Repeat("+", plus), strings.Repeat("-", minus))
+		added += s.added
+		removed += s.removed
+	}
+	fmt.Fprintf(out, " %s changed, %s(+), %s(-)\n", plural(len(stats), "file"), plural(added, "insertion"), plural(removed, "deletion"))
+}
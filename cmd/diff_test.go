@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/CeoFred/nturu/manifest"
+)
+
+// generateProject writes a template of files to a directory of its own and
+// generates a project called orders from it, without hooks. It returns the
+// project's directory.
+func generateProject(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		writeFile(t, filepath.Join(dir, "template", name), content)
+	}
+	tpl, err := catalog.Resolve(filepath.Join(dir, "template"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpl.Close()
+	values, err := tpl.Manifest.Resolve(map[string]string{manifest.AppName: "orders"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	features, err := tpl.Manifest.SelectFeatures(nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest := filepath.Join(dir, "orders")
+	if err := writeProject(context.Background(), tpl, values, features, dest, false, true); err != nil {
+		t.Fatal(err)
+	}
+	return dest
+}
+
+func writeFile(t *testing.T, name, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// execute runs nturu with args and returns what the command printed.
+func execute(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	var out bytes.Buffer
+	rootCmd.SetOut(&out)
+	defer rootCmd.SetOut(nil)
+	rootCmd.SetArgs(args)
+	defer rootCmd.SetArgs(nil)
+	err := rootCmd.Execute()
+	return out.String(), err
+}
+
+func TestDiff(t *testing.T) {
+	dest := generateProject(t, map[string]string{
+		manifest.File:    "name: svc\nvariables:\n  - name: AppName\n",
+		"main.go":        "package main\n\nfunc main() {\n\tprintln(\"one\")\n}\n",
+		"README.md.tmpl": "# {{.AppName}}\n",
+		"docs/notes.txt": "a\nb\nc\nd\ne\nf\ng\nh\n",
+		"docs/same.txt":  "same\n",
+	})
+	writeFile(t, filepath.Join(dest, "main.go"), "package main\n\nfunc main() {\n\tprintln(\"two\")\n}\n")
+	writeFile(t, filepath.Join(dest, "docs", "notes.txt"), "a\nb\nc\nd\ne\nf\ng\nH\n")
+	writeFile(t, filepath.Join(dest, "added.go"), "package main\n")
+	if err := os.Remove(filepath.Join(dest, "README.md")); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { DiffDir, DiffStat, DiffContext = ".", false, 3 }()
+
+	readme := "--- a/README.md\n+++ /dev/null\n@@ -1 +0,0 @@\n-# orders\n"
+	notes := "--- a/docs/notes.txt\n+++ b/docs/notes.txt\n@@ -5,4 +5,4 @@\n e\n f\n g\n-h\n+H\n"
+	mainGo := "--- a/main.go\n+++ b/main.go\n@@ -1,5 +1,5 @@\n package main\n \n func main() {\n-\tprintln(\"one\")\n+\tprintln(\"two\")\n }\n"
+	stat := " README.md      | 1 -\n" +
+		" docs/notes.txt | 2 +-\n" +
+		" main.go        | 2 +-\n" +
+		" 3 files changed, 2 insertions(+), 3 deletions(-)\n"
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"every file", nil, readme + notes + mainGo},
+		{"stat", []string{"--stat"}, stat},
+		{"directory and context", []string{"-U", "1", "docs/"}, "--- a/docs/notes.txt\n+++ b/docs/notes.txt\n@@ -7,2 +7,2 @@\n g\n-h\n+H\n"},
+		{"glob", []string{"*.go"}, mainGo},
+		{"unchanged", []string{"docs/same.txt"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			DiffStat, DiffContext = false, 3
+			out, err := execute(t, append([]string{"diff", "-C", dest}, tt.args...)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out != tt.want {
+				t.Errorf("nturu diff %s printed\n%s\nwant\n%s", strings.Join(tt.args, " "), out, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/CeoFred/nturu/doctor"
+	"github.com/CeoFred/nturu/lock"
+	"github.com/CeoFred/nturu/manifest"
+	"github.com/CeoFred/nturu/source"
+)
+
+var DoctorDir string
+var DoctorTemplate string
+var DoctorWith []string
+var DoctorWithout []string
+
+func init() {
+	doctorCmd.Flags().StringVarP(&DoctorDir, "dir", "C", ".", "project directory")
+	doctorCmd.Flags().StringVarP(&DoctorTemplate, "template", "t", "", "only check the tools of this template")
+	doctorCmd.Flags().StringSliceVar(&DoctorWith, "with", nil, "also check the tools of these optional features")
+	doctorCmd.Flags().StringSliceVar(&DoctorWithout, "without", nil, "skip the tools of these features")
+	rootCmd.AddCommand(doctorCmd)
+}
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Checks that the tools templates need are installed and a project is healthy.",
+	Long: `Checks that the tools templates need are installed and a project is healthy.
+
+Templates declare the tools their projects need, such as go, swag or protoc,
+with the oldest version that works. doctor looks for each on the PATH, runs
+it to read its version and says how to install what is missing.
+
+Inside a generated project (a directory with ` + lock.File + `) the tools of
+the template it came from are checked with its recorded features, and so is
+the project: .env must set every variable of .env.example, go.mod must be
+valid, need no newer Go than installed and declare the recorded module, and
+no Go file may still import the template's own module. Elsewhere the tools
+of every template are checked, or of the one given with --template, with
+its default features.
+
+Nothing is changed. doctor exits with an error when a required tool is
+missing or too old, or the project is broken; warnings do not fail it.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		out := cmd.OutOrStdout()
+
+		l, err := lock.Read(DoctorDir)
+		if err != nil && !errors.Is(err, lock.ErrNotFound) {
+			return err
+		}
+
+		var failed int
+		report := func(title string, findings []doctor.Finding) {
+			failed += printFindings(out, title, findings)
+		}
+
+		switch {
+		case l != nil && DoctorTemplate == "":
+			project := &doctor.Project{Dir: DoctorDir, Module: l.Answers[manifest.ModulePath]}
+			t, err := catalog.ResolvePinned(l.Template.Ref, l.Template.Commit, l.Template.Digest)
+			if err != nil {
+				// The project can still be checked without its template.
+				fmt.Fprintf(os.Stderr, "Warning: cannot check the tools of %s: %v\n", l.Template.Name, err)
+			} else {
+				defer t.Close()
+				features, err := lockedFeatures(t.Manifest, l, nil, DoctorWith, DoctorWithout)
+				if err != nil {
+					return err
+				}
+				project.TemplateModules = []string{t.Manifest.Module}
+				report(templateTitle(t), doctor.Tools(ctx, t.Manifest.Tools, features))
+			}
+
+			findings, err := project.Check(ctx)
+			if err != nil {
+				return err
+			}
+			dir, _ := filepath.Abs(DoctorDir)
+			report("Project "+dir, findings)
+
+		case DoctorTemplate != "":
+			t, err := catalog.Resolve(DoctorTemplate)
+			if err != nil {
+				return err
+			}
+			defer t.Close()
+			features, err := t.Manifest.SelectFeatures(DoctorWith, DoctorWithout, nil)
+			if err != nil {
+				return err
+			}
+			report(templateTitle(t), doctor.Tools(ctx, t.Manifest.Tools, features))
+
+		default:
+			if len(DoctorWith) > 0 || len(DoctorWithout) > 0 {
+				return errors.New("--with and --without need a project or --template")
+			}
+			templates, err := catalog.List()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Warning:", err)
+			}
+			for _, t := range templates {
+				features, err := t.Manifest.SelectFeatures(nil, nil, nil)
+				if err != nil {
+					return err
+				}
+				report(templateTitle(t), doctor.Tools(ctx, t.Manifest.Tools, features))
+			}
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("%s failed", plural(failed, "check"))
+		}
+		return nil
+	},
+}
+
+func templateTitle(t *source.Template) string {
+	return fmt.Sprintf("Template %s %s", t.Name, t.Manifest.Version)
+}
+
+// printFindings prints a titled section of findings with their fixes and
+// returns how many failed.
+func printFindings(out io.Writer, title string, findings []doctor.Finding) int {
+	fmt.Fprintln(out, title)
+	if len(findings) == 0 {
+		fmt.Fprintln(out, "  nothing to check")
+	}
+	failed := 0
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, f := range findings {
+		fmt.Fprintf(w, "  %s\t%s\t%s\n", f.Status, f.Check, f.Detail)
+		if f.Fix != "" {
+			fmt.Fprintf(w, "  \t\tfix: %s\n", f.Fix)
+		}
+		if f.Status == doctor.Failure {
+			failed++
+		}
+	}
+	w.Flush()
+	fmt.Fprintln(out)
+	return failed
+}
@@ -1,141 +1,436 @@
 package cmd
 
 import (
+	"bufio"
+	"context"
 	"embed"
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"syscall"
 
 	"github.com/spf13/cobra"
 
+	"github.com/CeoFred/nturu/generator"
+	"github.com/CeoFred/nturu/lock"
+	"github.com/CeoFred/nturu/manifest"
+	"github.com/CeoFred/nturu/modpath"
+	"github.com/CeoFred/nturu/source"
+	"github.com/CeoFred/nturu/spec"
 	"github.com/CeoFred/nturu/utils"
 )
 
 //go:embed templates/*
 var embededTemplates embed.FS
 var Framework string
+var TemplateRef string
+var ProjectName string
+var ProjectModule string
+var Offline bool
+var DryRun bool
+var PlanFormat string
+var Force bool
+var SkipHooks bool
 var Verbose bool
+var OutputDir string
+var AssumeYes bool
+var ConfigFile string
+var WithFeatures []string
+var WithoutFeatures []string
 
 func init() {
 	generateCmd.Flags().StringVarP(&Framework, "framework", "f", "default", "Go lang Framework to use")
+	generateCmd.Flags().StringVarP(&TemplateRef, "template", "t", "", "template to generate from: a name, a directory or a file:// URL")
+	generateCmd.Flags().StringVarP(&ProjectName, "name", "n", "", "application name, also the output directory")
+	generateCmd.Flags().StringVarP(&ProjectModule, "module", "m", "", "Go module path of the project (defaults to the name)")
+	generateCmd.Flags().BoolVar(&Offline, "offline", false, "never use the network: archive templates must already be cached")
+	generateCmd.Flags().StringVarP(&OutputDir, "output", "o", "", "directory to generate into (defaults to ./<name>)")
+	generateCmd.Flags().BoolVarP(&AssumeYes, "yes", "y", false, "never prompt, use defaults for missing values")
+	generateCmd.Flags().BoolVar(&DryRun, "dry-run", false, "print what would be generated without writing anything")
+	generateCmd.Flags().StringVar(&PlanFormat, "format", "text", "dry-run output format: text or json")
+	generateCmd.Flags().BoolVar(&SkipHooks, "skip-hooks", false, "do not run the commands the template runs after generating, such as go mod tidy")
+	generateCmd.Flags().BoolVar(&Force, "force", false, "generate into an existing directory, overwriting the files the template produces")
+	generateCmd.Flags().StringVarP(&ConfigFile, "config", "c", "", "generate from a project spec file such as "+spec.DefaultFile)
+	generateCmd.Flags().StringToStringVar(&variableValues, "set", nil, "set a template variable, e.g. --set Port=8080")
+	generateCmd.Flags().StringSliceVar(&WithFeatures, "with", nil, "optional template features to include, e.g. --with swagger,otp")
+	generateCmd.Flags().StringSliceVar(&WithoutFeatures, "without", nil, "optional template features to leave out, e.g. --without cloudinary")
 	rootCmd.AddCommand(generateCmd)
 	rootCmd.PersistentFlags().BoolVarP(&Verbose, "generate", "g", false, "verbose output")
 }
 
 var generateCmd = &cobra.Command{
-	Use:   "generate",
+	Use:   "generate [template]",
 	Short: "Creates a new microservice using the default boilerplate.",
-	Long:  `This generates a new microservice using the default boilerplate.`,
-	Run: func(cmd *cobra.Command, args []string) {
-
-		var framework string
+	Long: `This generates a new microservice using the default boilerplate.
+
+The questions asked, and the flags answering them, come from the variables
+declared in the template's manifest. Values that are not passed as flags are
+asked for interactively. When stdin is not a terminal, or --yes is set, nturu
+never prompts: defaults are used and missing required values are an error.
+
+The project records the template, answers and enabled features it was
+generated with in ` + lock.File + `, which upgrade, diff and add rely on;
+keep it under version control.
+
+Optional template features are picked with --with and --without, or asked
+for interactively; features not mentioned keep their default.
+
+The template is a built-in or installed template name, or a directory
+holding a template.yaml, given as a path or a file:// URL, a directory in a
+git repository: git+<url>[//<subdir>][@<tag, branch or commit>], or an
+http(s) URL of a zip or tar.gz archive, optionally followed by //<subdir>.
+Archives are downloaded once and cached; see nturu templates pull.
+Every variable of the template is also a flag, listed by
+nturu generate <template> --help, and can be set with --set Name=value.
+
+Generation is atomic: the project is assembled in a hidden directory next to
+the destination and only moved into place once every file is written. If
+rendering fails or generate is interrupted with Ctrl-C, that directory is
+removed and nothing is left behind. With --force, files in an existing
+destination are replaced one by one once the whole project has been
+rendered; if a file cannot be moved into place, those already moved are put
+back.
+
+Once the files are written, the commands the template declares as hooks,
+such as go mod tidy or git init, run in the new project in order, with their
+output shown. A failing hook fails the generation and nothing is written,
+unless the template marks it optional. --skip-hooks runs none of them.
+
+With --dry-run, nturu prints the files and directories it would create,
+overwrite or skip and exits without writing; --format json prints the plan
+as JSON, as it does for the templates commands. -o/--output names the
+destination directory, which is why JSON is not selected with --output json.
+
+With --config, every answer is read from a project spec file instead and
+nturu never prompts. Flags given on the command line override the spec.`,
+	// The flags of the template's variables are only known once the
+	// template is, so RunE parses the command line itself.
+	DisableFlagParsing: true,
+	RunE: func(cmd *cobra.Command, line []string) error {
+		args, err := parseBuiltinFlags(cmd, line)
+		if err != nil {
+			return err
+		}
+		if len(args) > 1 {
+			return fmt.Errorf("accepts at most 1 arg(s), received %d", len(args))
+		}
+		help, _ := cmd.Flags().GetBool("help")
 
-		if len(args) > 0 {
-			framework = args[0]
+		if err := checkFormat(PlanFormat); err != nil {
+			return err
+		}
+		if PlanFormat == "json" && !DryRun {
+			return errors.New("--format json needs --dry-run")
 		}
 
-		if framework == "" {
-			framework = "default"
+		var projectSpec *spec.Spec
+		if ConfigFile != "" {
+			projectSpec, err = spec.Load(ConfigFile)
+			if err != nil {
+				return err
+			}
 		}
 
-		var availableTemplates []string
+		ref := Framework
+		fromSpec := false
+		if projectSpec != nil && !cmd.Flags().Changed("framework") && projectSpec.Template.Value != "" {
+			ref = projectSpec.Template.Value
+			fromSpec = true
+			// Template directories named by a spec are relative to the spec.
+			if source.IsPath(ref) && !filepath.IsAbs(ref) {
+				ref = filepath.Join(filepath.Dir(projectSpec.Path), ref)
+			}
+		}
+		if TemplateRef != "" {
+			ref = TemplateRef
+			fromSpec = false
+		}
+		if len(args) > 0 {
+			if TemplateRef != "" {
+				return errors.New("pass the template either as an argument or with --template, not both")
+			}
+			ref = args[0]
+			fromSpec = false
+		}
 
-		availableTemplates = append(availableTemplates, "fiber", "default")
+		if ref == "" {
+			ref = "default"
+		}
 
-		if !isTemplateAvailable(framework, availableTemplates) {
-			fmt.Println("Error:", "Template not available")
-			os.Exit(1)
+		catalog.Offline = Offline
+		t, err := catalog.Resolve(ref)
+		if errors.Is(err, source.ErrNotFound) {
+			err = fmt.Errorf("template %q not available; see nturu templates list", ref)
 		}
-		clearScreen()
+		if err != nil && help {
+			return cmd.Help()
+		}
+		if err != nil && fromSpec {
+			return projectSpec.Errorf(projectSpec.Template.Pos, "%v", err)
+		}
+		if err != nil {
+			return err
+		}
+		defer t.Close()
+		if err := parseVariableFlags(cmd, t.Manifest, line); err != nil {
+			return err
+		}
+		if help {
+			return cmd.Help()
+		}
+		if t.Commit != "" && !DryRun {
+			fmt.Println("Using template", t.Location, "at commit", t.Commit)
+		}
+		m := t.Manifest
 
-		// ask for app name
-		var ModulePath string
-		var AppName string
+		answers := map[string]string{}
+		if projectSpec != nil {
+			err = applySpec(cmd, projectSpec, m, answers)
+			if err != nil {
+				return err
+			}
+		}
+		err = collectVariableFlags(cmd, m, answers)
+		if err != nil {
+			return err
+		}
 
-		fmt.Println("\033[1;31m What is your application name?\033[0m")
-		fmt.Scanln(&AppName)
-		clearScreen()
+		var ask manifest.Asker
+		var askFeature manifest.FeatureAsker
+		if !AssumeYes && projectSpec == nil && utils.IsTerminal(os.Stdin) {
+			clearScreen()
+			in := bufio.NewReader(os.Stdin)
+			ask = askVariable(in)
+			askFeature = askFeatureEnabled(in)
+		}
 
-		fmt.Println("\033[1;31m What is your preferred module path?\033[0m")
-		fmt.Scanln(&ModulePath)
-		clearScreen()
+		values, err := m.Resolve(answers, ask)
+		if err != nil {
+			return err
+		}
+		if module, _ := values[manifest.ModulePath].(string); m.Module != "" && module != "" {
+			if err := modpath.Check(module); err != nil {
+				return fmt.Errorf("%s: %w", manifest.ModulePath, err)
+			}
+		}
+		features, err := m.SelectFeatures(WithFeatures, WithoutFeatures, askFeature)
+		if err != nil {
+			return err
+		}
+		appName, _ := values[manifest.AppName].(string)
 
 		currentDir, err := os.Getwd()
 		if err != nil {
-			fmt.Println("Error:", err)
-			return
+			return err
 		}
-		fmt.Println("Current working directory:", currentDir)
 
-		err = createFolder(currentDir, AppName)
+		destinationFolder := OutputDir
+		if destinationFolder == "" {
+			destinationFolder = appName
+		}
+		if !filepath.IsAbs(destinationFolder) {
+			destinationFolder = filepath.Join(currentDir, destinationFolder)
+		}
 
-		if err != nil {
-			fmt.Println("Error:", err)
-			return
+		if DryRun {
+			plan, err := planGeneration(t, values, features, destinationFolder, !SkipHooks)
+			if err != nil {
+				return err
+			}
+			if PlanFormat == "json" {
+				return writeJSON(cmd.OutOrStdout(), plan)
+			}
+			printPlan(cmd.OutOrStdout(), plan)
+			return nil
 		}
 
-		sourceFolder := filepath.Join(currentDir, "templates/"+framework)
-		destinationFolder := filepath.Join(currentDir, AppName)
+		fmt.Println("Current working directory:", currentDir)
 
-		err = copyTemplates(sourceFolder, destinationFolder, framework)
+		if info, err := os.Stat(destinationFolder); err == nil && !info.IsDir() {
+			return fmt.Errorf("%s already exists and is not a directory", destinationFolder)
+		} else if err == nil && !Force {
+			return fmt.Errorf("%s already exists; pass --force to generate into it", destinationFolder)
+		}
+		err = os.MkdirAll(filepath.Dir(destinationFolder), 0755)
 		if err != nil {
-			fmt.Println("Error:", err)
-			deleteFolder(destinationFolder)
-			return
+			return err
 		}
 
 		fmt.Println("----------------------------------------------------------------")
+		fmt.Println("Rendering template..")
 
-		zippedTemplate := filepath.Join(destinationFolder, framework+".zip")
-
-		err = utils.UnzipFile(zippedTemplate)
-		if err != nil {
-			fmt.Println("Error:", err)
-			deleteFolder(destinationFolder)
-			return
+		if err := writeProject(cmd.Context(), t, values, features, destinationFolder, Force, SkipHooks); err != nil {
+			return err
 		}
 
-		fmt.Println("Extracting template..")
+		fmt.Println("\033[1;31mDone! Template generated successfully. Say Hi to @codemon_")
+		return nil
+	},
+}
+
+// writeProject generates the project t renders with values and features
+// into dest, runs the template's hooks unless skipHooks, and records the
+// result in its lockfile. The project is assembled in a stage next to dest and moved
+// into place once complete; on any error or interrupt the stage is removed
+// and dest is left untouched. force replaces the files of an existing dest.
+func writeProject(ctx context.Context, t *source.Template, values map[string]any, features map[string]bool, dest string, force, skipHooks bool) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	stage, err := generator.NewStage(dest)
+	if err != nil {
+		return err
+	}
+	defer stage.Discard()
 
-		err = os.Remove(zippedTemplate)
+	g := generator.New(t.FS, t.Manifest, values, features)
+	files, err := g.Generate(ctx, stage.Dir)
+	if ctx.Err() != nil {
+		return errors.New("interrupted; nothing was written")
+	}
+	if err != nil {
+		return err
+	}
+	fileSums := map[string]string{}
+	for _, f := range files {
+		fileSums[f.Path] = f.Sum
+	}
+	if !skipHooks {
+		err = runHooks(ctx, g, stage.Dir)
+		if ctx.Err() != nil {
+			return errors.New("interrupted; nothing was written")
+		}
 		if err != nil {
-			fmt.Println("Error:", err)
-			deleteFolder(destinationFolder)
-			return
+			return fmt.Errorf("%w; nothing was written (pass --skip-hooks to generate without running hooks)", err)
 		}
-
-		utils.ReplaceInDirectory(destinationFolder, "github.com/nturu/microservice-template", ModulePath)
-		fmt.Println("\033[1;31mDone! Template generated successfully. Say Hi to @codemon_")
-
-	},
+		// Hooks such as go mod tidy rewrite generated files; record them as
+		// the hooks left them so later commands do not take that for edits.
+		fileSums, err = hookedSums(stage.Dir, fileSums)
+		if err != nil {
+			return err
+		}
+	}
+	err = lock.Write(stage.Dir, newLock(t, values, features, fileSums))
+	if err != nil {
+		return err
+	}
+	return stage.Commit(force)
 }
 
-func isTemplateAvailable(template string, availableTemplates []string) bool {
-	for _, t := range availableTemplates {
-		if t == template {
-			return true
+// hookedSums returns the sums of the generated files in dir as the hooks
+// left them. Files a hook removed are no longer recorded.
+func hookedSums(dir string, generated map[string]string) (map[string]string, error) {
+	out := map[string]string{}
+	for name := range generated {
+		content, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
 		}
+		out[name] = lock.Sum(content)
 	}
-	return false
+	return out, nil
 }
 
-func deleteFolder(destinationFolder string) {
-	err := os.RemoveAll(destinationFolder)
+// runHooks runs the template's hooks in the project at dir, streaming their
+// output. A failing optional hook only prints a warning.
+func runHooks(ctx context.Context, g *generator.Generator, dir string) error {
+	hooks, err := g.Hooks()
 	if err != nil {
-		fmt.Println("Error deleting folder:", err)
-		return
+		return err
+	}
+	for _, h := range hooks {
+		fmt.Printf("Running hook %s: %s\n", h.Name, strings.Join(h.Run, " "))
+		err := generator.RunHook(ctx, dir, h, os.Stdout, os.Stderr)
+		if err != nil && h.Optional && ctx.Err() == nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v; continuing as the hook is optional\n", err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
-func createFolder(dir, newFolderName string) error {
-	// Join the current directory and the new folder name
-	newFolderPath := filepath.Join(dir, newFolderName)
-	err := os.Mkdir(newFolderPath, 0755) // 0755 is the default permission mode
-	return err
+// newLock records how a project was generated from t. files maps every
+// generated path to the lock.Sum of its content.
+func newLock(t *source.Template, values map[string]any, features map[string]bool, files map[string]string) *lock.Lock {
+	return &lock.Lock{
+		Nturu: Version,
+		Template: lock.Template{
+			Name:    t.Manifest.Name,
+			Version: t.Manifest.Version,
+			Source:  string(t.Kind),
+			Ref:     t.Ref(),
+			Commit:  t.Commit,
+			Digest:  t.Digest,
+		},
+		Answers:  t.Manifest.Answers(values),
+		Features: manifest.EnabledFeatures(features),
+		Files:    files,
+	}
+}
+
+// applySpec copies every answer the spec records into answers and fills in
+// the flags the command line left unset. Variables and features the
+// template does not declare are reported at their position in the file.
+func applySpec(cmd *cobra.Command, s *spec.Spec, m *manifest.Manifest, answers map[string]string) error {
+	flags := cmd.Flags()
+
+	if s.Name.Value != "" {
+		answers[manifest.AppName] = s.Name.Value
+	}
+	if s.Module.Value != "" {
+		answers[manifest.ModulePath] = s.Module.Value
+	}
+	if !flags.Changed("output") && s.Output.Value != "" {
+		// Relative outputs are anchored at the spec, not the caller's cwd, so
+		// the same file generates the same tree wherever it is run from.
+		OutputDir = s.Output.Value
+		if !filepath.IsAbs(OutputDir) {
+			OutputDir = filepath.Join(filepath.Dir(s.Path), OutputDir)
+		}
+	}
+
+	var errs []error
+	listed := map[string]bool{}
+	for _, f := range s.Features {
+		if m.Feature(f.Value) == nil {
+			errs = append(errs, s.Errorf(f.Pos, "template %s has no feature %q", m.Name, f.Value))
+		}
+		listed[f.Value] = true
+	}
+	// The spec lists exactly the features to enable, so a template gaining a
+	// default-on feature does not change what the spec generates.
+	if s.Features != nil && !flags.Changed("with") && !flags.Changed("without") {
+		for _, f := range m.Features {
+			if listed[f.Name] {
+				WithFeatures = append(WithFeatures, f.Name)
+			} else {
+				WithoutFeatures = append(WithoutFeatures, f.Name)
+			}
+		}
+	}
+	for _, v := range s.Variables {
+		if m.Variable(v.Name) == nil {
+			errs = append(errs, s.Errorf(v.Pos, "template %s has no variable %q", m.Name, v.Name))
+			continue
+		}
+		if _, err := m.Variable(v.Name).Convert(v.Value.Value); err != nil {
+			errs = append(errs, s.Errorf(v.Pos, "%v", err))
+			continue
+		}
+		answers[v.Name] = v.Value.Value
+	}
+	return errors.Join(errs...)
 }
 
 func clearScreen() {
@@ -150,46 +445,3 @@ func clearScreen() {
 		cmd.Run()
 	}
 }
-
-func copyTemplates(src, dst, framework string) error {
-	templates, err := embededTemplates.ReadDir(filepath.Join("templates", framework))
-	if err != nil {
-		fmt.Printf("failed to read templates for framework %s\n", framework)
-		return err
-	}
-
-	for _, entry := range templates {
-		srcPath := filepath.Join("templates", framework, entry.Name())
-		destPath := filepath.Join(dst, entry.Name())
-
-		// Ensure that the entry is within the specified framework directory
-		if !strings.HasPrefix(filepath.Clean(destPath), filepath.Clean(dst)) {
-			return errors.New("attempted to copy files outside of the specified framework directory")
-		}
-
-		if entry.IsDir() {
-			err := os.MkdirAll(destPath, os.ModePerm)
-			if err != nil {
-				return err
-			}
-
-			// Recursively copy contents of subdirectories
-			err = copyTemplates(srcPath, destPath, framework)
-			if err != nil {
-				return err
-			}
-		} else {
-			data, err := embededTemplates.ReadFile(srcPath)
-			if err != nil {
-				return err
-			}
-
-			err = os.WriteFile(destPath, data, os.ModePerm)
-			if err != nil {
-				return err
-			}
-		}
-	}
-
-	return nil
-}
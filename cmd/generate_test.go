@@ -0,0 +1,202 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/CeoFred/nturu/lock"
+	"github.com/CeoFred/nturu/manifest"
+	"github.com/CeoFred/nturu/source"
+	"github.com/CeoFred/nturu/spec"
+)
+
+// gitTemplate returns a template whose hooks make a repository of their own.
+func gitTemplate(t *testing.T) *source.Template {
+	t.Helper()
+	fsys := fstest.MapFS{
+		manifest.File: {Data: []byte(`name: repo
+variables:
+  - name: AppName
+hooks:
+  - name: git
+    run: [git, init, --quiet]
+  - name: remote
+    run: [git, remote, add, origin, https://example.com/template.git]
+`)},
+		"main.go": {Data: []byte("package main\n")},
+	}
+	m, err := manifest.Load(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &source.Template{Name: "repo", Kind: source.Local, FS: fsys, Manifest: m}
+}
+
+func git(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// TestWriteProjectIntoRepo generates with --force into an existing
+// repository, whose metadata must survive the template's git init hook.
+func TestWriteProjectIntoRepo(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	tpl := gitTemplate(t)
+	values := map[string]any{manifest.AppName: "orders"}
+
+	dest := filepath.Join(t.TempDir(), "orders")
+	if err := os.Mkdir(dest, 0755); err != nil {
+		t.Fatal(err)
+	}
+	git(t, dest, "init", "--quiet")
+	git(t, dest, "symbolic-ref", "HEAD", "refs/heads/trunk")
+	git(t, dest, "remote", "add", "origin", "https://example.com/mine.git")
+	config, err := os.ReadFile(filepath.Join(dest, ".git", "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeProject(context.Background(), tpl, values, map[string]bool{}, dest, true, false); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"main.go", lock.File} {
+		if _, err := os.Stat(filepath.Join(dest, name)); err != nil {
+			t.Errorf("%s was not generated: %v", name, err)
+		}
+	}
+	if got, err := os.ReadFile(filepath.Join(dest, ".git", "config")); err != nil || string(got) != string(config) {
+		t.Errorf(".git/config = %q, %v; want it untouched:\n%s", got, err, config)
+	}
+	if got := git(t, dest, "symbolic-ref", "HEAD"); got != "refs/heads/trunk" {
+		t.Errorf("HEAD = %s, want refs/heads/trunk", got)
+	}
+	if got := git(t, dest, "remote", "get-url", "origin"); got != "https://example.com/mine.git" {
+		t.Errorf("origin = %s, want the repository's own", got)
+	}
+
+	// A new project keeps the repository its hooks made.
+	fresh := filepath.Join(t.TempDir(), "orders")
+	if err := writeProject(context.Background(), tpl, values, map[string]bool{}, fresh, false, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := git(t, fresh, "remote", "get-url", "origin"); got != "https://example.com/template.git" {
+		t.Errorf("origin of a new project = %s", got)
+	}
+}
+
+func TestApplySpecFeatures(t *testing.T) {
+	m, err := manifest.Parse([]byte(`name: mini
+variables:
+  - name: AppName
+features:
+  - name: swagger
+    default: true
+  - name: otp
+    default: true
+  - name: docker
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(with, without []string) { WithFeatures, WithoutFeatures = with, without }(WithFeatures, WithoutFeatures)
+
+	tests := []struct {
+		name string
+		spec string
+		want map[string]bool
+	}{
+		{"not listed", "template: mini\n", map[string]bool{"swagger": true, "otp": true, "docker": false}},
+		{"listed", "template: mini\nfeatures: [docker]\n", map[string]bool{"swagger": false, "otp": false, "docker": true}},
+		{"none", "template: mini\nfeatures: []\n", map[string]bool{"swagger": false, "otp": false, "docker": false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			WithFeatures, WithoutFeatures = nil, nil
+			s, err := spec.Parse(spec.DefaultFile, []byte(tt.spec))
+			if err != nil {
+				t.Fatal(err)
+			}
+			cmd, _, _ := testCommand()
+			cmd.Flags().StringSlice("without", nil, "")
+			if err := applySpec(cmd, s, m, map[string]string{}); err != nil {
+				t.Fatal(err)
+			}
+			got, err := m.SelectFeatures(WithFeatures, WithoutFeatures, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("features = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestWriteProjectLocksHookedFiles checks the lockfile records generated
+// files as the hooks left them.
+func TestWriteProjectLocksHookedFiles(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not installed")
+	}
+	fsys := fstest.MapFS{
+		manifest.File: {Data: []byte(`name: tidy
+variables:
+  - name: AppName
+hooks:
+  - name: tidy
+    run: [sh, -c, "printf 'require example.com/dep v1.0.0\n' >> go.mod && rm notes.txt && touch go.sum"]
+`)},
+		"go.mod":    {Data: []byte("module orders\n")},
+		"notes.txt": {Data: []byte("notes\n")},
+		"main.go":   {Data: []byte("package main\n")},
+	}
+	m, err := manifest.Load(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &source.Template{Name: "tidy", Kind: source.Local, FS: fsys, Manifest: m}
+
+	dest := filepath.Join(t.TempDir(), "orders")
+	if err := writeProject(context.Background(), tpl, map[string]any{manifest.AppName: "orders"}, map[string]bool{}, dest, false, false); err != nil {
+		t.Fatal(err)
+	}
+	l, err := lock.Read(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"go.mod":  lock.Sum([]byte("module orders\nrequire example.com/dep v1.0.0\n")),
+		"main.go": lock.Sum([]byte("package main\n")),
+	}
+	if !reflect.DeepEqual(l.Files, want) {
+		t.Errorf("locked files = %v, want %v", l.Files, want)
+	}
+}
+
+// TestWriteProjectCancelled checks an interrupted generation removes its
+// stage and leaves no project behind.
+func TestWriteProjectCancelled(t *testing.T) {
+	tpl := gitTemplate(t)
+	parent := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := writeProject(ctx, tpl, map[string]any{manifest.AppName: "orders"}, map[string]bool{}, filepath.Join(parent, "orders"), false, true)
+	if err == nil || err.Error() != "interrupted; nothing was written" {
+		t.Errorf("writeProject with a cancelled context = %v", err)
+	}
+	if entries, err := os.ReadDir(parent); err != nil || len(entries) != 0 {
+		t.Errorf("left behind: %v, %v", entries, err)
+	}
+}
@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/CeoFred/nturu/generator"
+	"github.com/CeoFred/nturu/lock"
+	"github.com/CeoFred/nturu/manifest"
+	"github.com/CeoFred/nturu/source"
+)
+
+// planAction is what generate would do to one path.
+type planAction string
+
+const (
+	planCreate    planAction = "create"
+	planOverwrite planAction = "overwrite"
+	planSkip      planAction = "skip"
+)
+
+type planEntry struct {
+	Path   string     `json:"path"`
+	Action planAction `json:"action"`
+	Dir    bool       `json:"dir,omitempty"`
+	Reason string     `json:"reason,omitempty"`
+}
+
+// generatePlan is what generate --dry-run prints.
+type generatePlan struct {
+	Template    string      `json:"template"`
+	Version     string      `json:"version"`
+	Source      source.Kind `json:"source"`
+	Commit      string      `json:"commit,omitempty"`
+	Destination string      `json:"destination"`
+	// Exists is set when the destination is already there, in which case
+	// generate only proceeds with --force.
+	Exists   bool              `json:"exists"`
+	Answers  map[string]string `json:"answers"`
+	Features []string          `json:"features"`
+	Entries  []planEntry       `json:"entries"`
+	// Hooks run after the files are written, unless --skip-hooks is set.
+	Hooks []manifest.Hook `json:"hooks,omitempty"`
+}
+
+// planGeneration works out what generating t into dest would create,
+// overwrite and skip, without writing anything.
+func planGeneration(t *source.Template, values map[string]any, features map[string]bool, dest string, hooks bool) (*generatePlan, error) {
+	g := generator.New(t.FS, t.Manifest, values, features)
+	files, err := g.Files()
+	if err != nil {
+		return nil, err
+	}
+	skipped, err := g.Skipped()
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &generatePlan{
+		Template:    t.Manifest.Name,
+		Version:     t.Manifest.Version,
+		Source:      t.Kind,
+		Commit:      t.Commit,
+		Destination: dest,
+		Answers:     t.Manifest.Answers(values),
+		Features:    manifest.EnabledFeatures(features),
+	}
+	_, err = os.Stat(dest)
+	plan.Exists = err == nil
+
+	dirs := map[string]bool{}
+	paths := []string{lock.File}
+	for _, f := range files {
+		paths = append(paths, f.Path)
+	}
+	for _, p := range paths {
+		for dir := path.Dir(p); dir != "." && !dirs[dir]; dir = path.Dir(dir) {
+			dirs[dir] = true
+			if !exists(filepath.Join(dest, filepath.FromSlash(dir))) {
+				plan.Entries = append(plan.Entries, planEntry{Path: dir, Action: planCreate, Dir: true})
+			}
+		}
+		action := planCreate
+		if exists(filepath.Join(dest, filepath.FromSlash(p))) {
+			action = planOverwrite
+		}
+		plan.Entries = append(plan.Entries, planEntry{Path: p, Action: action})
+	}
+	for _, s := range skipped {
+		plan.Entries = append(plan.Entries, planEntry{Path: s.Path, Action: planSkip, Reason: s.Reason})
+	}
+	sort.Slice(plan.Entries, func(i, j int) bool { return plan.Entries[i].Path < plan.Entries[j].Path })
+	if hooks {
+		plan.Hooks, err = g.Hooks()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return plan, nil
+}
+
+func exists(name string) bool {
+	_, err := os.Stat(name)
+	return !errors.Is(err, fs.ErrNotExist)
+}
+
+func printPlan(out io.Writer, plan *generatePlan) {
+	origin := string(plan.Source)
+	if plan.Commit != "" {
+		origin += " at " + plan.Commit
+	}
+	fmt.Fprintf(out, "Would generate %s %s (%s) into %s\n", plan.Template, plan.Version, origin, plan.Destination)
+	if len(plan.Features) > 0 {
+		fmt.Fprintf(out, "Features: %s\n", strings.Join(plan.Features, ", "))
+	}
+	fmt.Fprintln(out)
+
+	labels := map[string]string{}
+	var paths []string
+	counts := map[planAction]int{}
+	for _, e := range plan.Entries {
+		paths = append(paths, e.Path)
+		switch {
+		case e.Action == planSkip:
+			labels[e.Path] = "(skip: " + e.Reason + ")"
+		case e.Action == planOverwrite:
+			labels[e.Path] = "(overwrite)"
+		case e.Dir:
+			labels[e.Path] = "(new directory)"
+		}
+		if !e.Dir {
+			counts[e.Action]++
+		}
+	}
+	printTree(out, paths, func(p string) string { return labels[p] })
+
+	if len(plan.Hooks) > 0 {
+		fmt.Fprintln(out, "\nThen run:")
+		for _, h := range plan.Hooks {
+			line := fmt.Sprintf("  %s: %s", h.Name, strings.Join(h.Run, " "))
+			if notes := hookNotes(h); len(notes) > 0 {
+				line += " (" + strings.Join(notes, "; ") + ")"
+			}
+			fmt.Fprintln(out, line)
+		}
+	}
+
+	fmt.Fprintf(out, "\n%d to create, %d to overwrite, %d skipped. Nothing was written.\n",
+		counts[planCreate], counts[planOverwrite], counts[planSkip])
+	if plan.Exists {
+		fmt.Fprintln(out, "The destination exists: generate needs --force to write into it.")
+	}
+}
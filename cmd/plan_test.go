@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/CeoFred/nturu/lock"
+	"github.com/CeoFred/nturu/manifest"
+)
+
+// resetFlags puts back the defaults of the flags a test set on cmd once
+// the test is done, so the next run of cmd starts afresh.
+func resetFlags(t *testing.T, cmd *cobra.Command) {
+	t.Cleanup(func() {
+		cmd.Flags().VisitAll(func(f *pflag.Flag) {
+			if !f.Changed {
+				return
+			}
+			if s, ok := f.Value.(pflag.SliceValue); ok {
+				s.Replace(nil)
+			} else {
+				f.Value.Set(f.DefValue)
+			}
+			f.Changed = false
+		})
+	})
+}
+
+// planTemplate writes a template with an optional feature and hooks to a
+// directory of its own and returns it.
+func planTemplate(t *testing.T) string {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "template")
+	for name, content := range map[string]string{
+		manifest.File: `name: svc
+version: 1.0.0
+variables:
+  - name: AppName
+features:
+  - name: docs
+    files: ['docs/']
+hooks:
+  - name: tidy
+    run: [go, mod, tidy]
+  - name: git
+    run: [git, init]
+    optional: true
+  - name: docs
+    run: [swag, init]
+    when: docs
+`,
+		"main.go":             "package main\n",
+		"README.md.tmpl":      "# {{.AppName}}\n",
+		"internal/app/app.go": "package app\n",
+		"docs/index.md":       "docs\n",
+	} {
+		writeFile(t, filepath.Join(dir, name), content)
+	}
+	return dir
+}
+
+// listTree returns the contents of every file under dir.
+func listTree(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	tree := map[string]string{}
+	err := filepath.WalkDir(dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, name)
+		tree[filepath.ToSlash(rel)] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+func TestGenerateDryRun(t *testing.T) {
+	tpl := planTemplate(t)
+
+	t.Run("text", func(t *testing.T) {
+		resetFlags(t, generateCmd)
+		dest := filepath.Join(t.TempDir(), "orders")
+		writeFile(t, filepath.Join(dest, "main.go"), "package main // mine\n")
+
+		out, err := execute(t, "generate", tpl, "-y", "-n", "orders", "-o", dest, "--dry-run")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "Would generate svc 1.0.0 (directory) into " + dest + `
+
+.
+├── ` + lock.File + `
+├── README.md
+├── docs  (skip: feature docs disabled)
+├── internal  (new directory)
+│   └── app  (new directory)
+│       └── app.go
+└── main.go  (overwrite)
+
+Then run:
+  tidy: go mod tidy
+  git: git init (optional)
+
+3 to create, 1 to overwrite, 1 skipped. Nothing was written.
+The destination exists: generate needs --force to write into it.
+`
+		if out != want {
+			t.Errorf("generate --dry-run printed\n%s\nwant\n%s", out, want)
+		}
+		if got := listTree(t, dest); !reflect.DeepEqual(got, map[string]string{"main.go": "package main // mine\n"}) {
+			t.Errorf("generate --dry-run changed the destination: %v", got)
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		resetFlags(t, generateCmd)
+		dest := filepath.Join(t.TempDir(), "orders")
+
+		out, err := execute(t, "generate", tpl, "-y", "-n", "orders", "-o", dest, "--with", "docs", "--dry-run", "--format", "json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var plan generatePlan
+		if err := json.Unmarshal([]byte(out), &plan); err != nil {
+			t.Fatalf("%v:\n%s", err, out)
+		}
+		if plan.Exists || plan.Destination != dest || !reflect.DeepEqual(plan.Features, []string{"docs"}) {
+			t.Errorf("plan = %+v", plan)
+		}
+		wantEntries := []planEntry{
+			{Path: lock.File, Action: planCreate},
+			{Path: "README.md", Action: planCreate},
+			{Path: "docs", Action: planCreate, Dir: true},
+			{Path: "docs/index.md", Action: planCreate},
+			{Path: "internal", Action: planCreate, Dir: true},
+			{Path: "internal/app", Action: planCreate, Dir: true},
+			{Path: "internal/app/app.go", Action: planCreate},
+			{Path: "main.go", Action: planCreate},
+		}
+		if !reflect.DeepEqual(plan.Entries, wantEntries) {
+			t.Errorf("entries = %+v\nwant %+v", plan.Entries, wantEntries)
+		}
+		var hooks []string
+		for _, h := range plan.Hooks {
+			hooks = append(hooks, h.Name)
+		}
+		if !reflect.DeepEqual(hooks, []string{"tidy", "git", "docs"}) {
+			t.Errorf("hooks = %v, want tidy, git and docs", hooks)
+		}
+		if _, err := os.Stat(dest); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("generate --dry-run created %s: %v", dest, err)
+		}
+	})
+}
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"io/fs"
+
+	"github.com/CeoFred/nturu/generator"
+	"github.com/CeoFred/nturu/lock"
+	"github.com/CeoFred/nturu/manifest"
+	"github.com/CeoFred/nturu/source"
+)
+
+// renderProject renders every file t produces with the given values and
+// features, keyed by path, without writing anything. modes holds the mode
+// each file is generated with.
+func renderProject(t *source.Template, values map[string]any, features map[string]bool) (rendered map[string][]byte, modes map[string]fs.FileMode, err error) {
+	g := generator.New(t.FS, t.Manifest, values, features)
+	files, err := g.Files()
+	if err != nil {
+		return nil, nil, err
+	}
+	rendered = map[string][]byte{}
+	modes = map[string]fs.FileMode{}
+	for _, f := range files {
+		content, err := g.Render(f)
+		if err != nil {
+			return nil, nil, err
+		}
+		rendered[f.Path] = content
+		modes[f.Path] = f.Mode
+	}
+	return rendered, modes, nil
+}
+
+// resolveLocked resolves the answers recorded in l against m. Answers to
+// variables m no longer declares are dropped and overrides replace recorded
+// answers; variables new in m get their default.
+func resolveLocked(m *manifest.Manifest, l *lock.Lock, overrides map[string]string) (map[string]any, error) {
+	answers := map[string]string{}
+	for name, value := range l.Answers {
+		if m.Variable(name) != nil {
+			answers[name] = value
+		}
+	}
+	for name, value := range overrides {
+		answers[name] = value
+	}
+	return m.Resolve(answers, nil)
+}
+
+// lockedFeatures selects m's features as recorded in l. Recorded features
+// stay enabled and the others stay disabled, except features that known,
+// the manifest l was written from, did not have: those get their default.
+// A nil known treats every feature as known. with and without override the
+// record.
+func lockedFeatures(m *manifest.Manifest, l *lock.Lock, known *manifest.Manifest, with, without []string) (map[string]bool, error) {
+	enabled := map[string]bool{}
+	for _, name := range l.Features {
+		enabled[name] = true
+	}
+	return m.SelectFeatures(with, without, func(f *manifest.Feature) (bool, error) {
+		if enabled[f.Name] {
+			return true, nil
+		}
+		if known == nil || known.Feature(f.Name) != nil {
+			return false, nil
+		}
+		return f.Default, nil
+	})
+}
+
+// sums returns the lock.Sum of every rendered file.
+func sums(rendered map[string][]byte) map[string]string {
+	out := map[string]string{}
+	for name, content := range rendered {
+		out[name] = lock.Sum(content)
+	}
+	return out
+}
@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/CeoFred/nturu/lock"
+	"github.com/CeoFred/nturu/manifest"
+	"github.com/CeoFred/nturu/modpath"
+)
+
+var RenameDir string
+var RenameDryRun bool
+
+func init() {
+	renameModuleCmd.Flags().StringVarP(&RenameDir, "dir", "C", ".", "project directory")
+	renameModuleCmd.Flags().BoolVar(&RenameDryRun, "dry-run", false, "list the files that would change without writing anything")
+	rootCmd.AddCommand(renameModuleCmd)
+}
+
+var renameModuleCmd = &cobra.Command{
+	Use:   "rename-module <new module path>",
+	Short: "Moves a Go project to a new module path.",
+	Long: `Moves a Go project to a new module path.
+
+The module directive in go.mod is changed, and every Go file importing a
+package of the module is rewritten to import it from the new path. Nested
+modules below the old path move along with it. Comments, strings and other
+files that only mention the old path are left alone, as are vendor and
+testdata directories and hidden directories such as .git.
+
+In a generated project the new path is also recorded in ` + lock.File + `, so
+upgrade and diff render the template with it.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		to := args[0]
+		if err := modpath.Check(to); err != nil {
+			return err
+		}
+		data, err := os.ReadFile(filepath.Join(RenameDir, "go.mod"))
+		if err != nil {
+			return err
+		}
+		from := modpath.ModulePath(data)
+		if from == "" {
+			return fmt.Errorf("%s declares no module", filepath.Join(RenameDir, "go.mod"))
+		}
+		if from == to {
+			return fmt.Errorf("the module is already %s", to)
+		}
+
+		changes, err := planRename(RenameDir, from, to)
+		if err != nil {
+			return err
+		}
+		out := cmd.OutOrStdout()
+		verb := "Moving"
+		if RenameDryRun {
+			verb = "Would move"
+		}
+		fmt.Fprintf(out, "%s %s to %s\n", verb, from, to)
+		for _, c := range changes {
+			fmt.Fprintf(out, "  rewrite %s\n", c.path)
+		}
+		fmt.Fprintf(out, "%s to rewrite\n", plural(len(changes), "file"))
+		if RenameDryRun {
+			return nil
+		}
+
+		for _, c := range changes {
+			// WriteFile keeps the mode of the file it replaces.
+			if err := os.WriteFile(filepath.Join(RenameDir, filepath.FromSlash(c.path)), c.content, 0644); err != nil {
+				return err
+			}
+		}
+		return recordRename(RenameDir, to, changes)
+	},
+}
+
+// renameChange is a file rename-module rewrites.
+type renameChange struct {
+	path         string
+	old, content []byte
+}
+
+// planRename works out the new contents of every go.mod and Go file under
+// dir that refers to the module from.
+func planRename(dir, from, to string) ([]renameChange, error) {
+	var changes []renameChange
+	err := filepath.WalkDir(dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			base := d.Name()
+			if name != dir && (strings.HasPrefix(base, ".") || base == "vendor" || base == "testdata") {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || (d.Name() != "go.mod" && filepath.Ext(name) != ".go") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, name)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		old, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		var content []byte
+		if d.Name() == "go.mod" {
+			content, err = modpath.GoMod(rel, old, from, to)
+		} else {
+			content, err = modpath.GoFile(old, from, to)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", rel, err)
+		}
+		if !bytes.Equal(content, old) {
+			changes = append(changes, renameChange{path: rel, old: old, content: content})
+		}
+		return nil
+	})
+	return changes, err
+}
+
+// recordRename records the new module path in the project's lock, if it has
+// one. Files the template generated and nobody edited are recorded with
+// their new content, as the template now renders them that way.
+func recordRename(dir, to string, changes []renameChange) error {
+	l, err := lock.Read(dir)
+	if errors.Is(err, lock.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if l.Answers == nil {
+		l.Answers = map[string]string{}
+	}
+	l.Answers[manifest.ModulePath] = to
+	for _, c := range changes {
+		if sum, ok := l.Files[c.path]; ok && sum == lock.Sum(c.old) {
+			l.Files[c.path] = lock.Sum(c.content)
+		}
+	}
+	return lock.Write(dir, l)
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/CeoFred/nturu/lock"
+	"github.com/CeoFred/nturu/manifest"
+)
+
+func TestRenameModule(t *testing.T) {
+	dest := generateProject(t, map[string]string{
+		manifest.File: "name: svc\nvariables:\n  - name: AppName\n",
+		"go.mod":      "module example.com/orders\n\ngo 1.21\n",
+		"main.go": `package main
+
+import (
+	"example.com/orders/internal/app"
+	"github.com/acme/log"
+)
+
+func main() { log.Print(app.Name) }
+`,
+		"internal/app/app.go":  "package app\n\nconst Name = \"example.com/orders\"\n",
+		"internal/db/db.go":    "package db\n\nimport _ \"example.com/orders/internal/app\"\n",
+		"tools/go.mod":         "module example.com/orders/tools\n\ngo 1.21\n",
+		"vendor/modules.txt":   "# example.com/orders\n",
+		"testdata/old/x.go":    "package x\n\nimport _ \"example.com/orders/internal/app\"\n",
+		".config/settings.go":  "package config\n\nimport _ \"example.com/orders/internal/app\"\n",
+		"docs/example.com.txt": "go get example.com/orders\n",
+	})
+	// An edit of the user's own, which the lock must not take for the
+	// template's.
+	writeFile(t, filepath.Join(dest, "internal", "db", "db.go"), "package db // mine\n\nimport _ \"example.com/orders/internal/app\"\n")
+	before := listTree(t, dest)
+	resetFlags(t, renameModuleCmd)
+
+	out, err := execute(t, "rename-module", "-C", dest, "--dry-run", "zeta.dev/orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan := `Would move example.com/orders to zeta.dev/orders
+  rewrite go.mod
+  rewrite internal/db/db.go
+  rewrite main.go
+  rewrite tools/go.mod
+4 files to rewrite
+`
+	if out != plan {
+		t.Errorf("dry run printed:\n%s\nwant:\n%s", out, plan)
+	}
+	if got := listTree(t, dest); !reflect.DeepEqual(got, before) {
+		t.Error("the dry run changed the project")
+	}
+
+	if _, err := execute(t, "rename-module", "-C", dest, "--dry-run=false", "zeta.dev/orders"); err != nil {
+		t.Fatal(err)
+	}
+	after := listTree(t, dest)
+	for name, want := range map[string]string{
+		"go.mod":       "module zeta.dev/orders\n\ngo 1.21\n",
+		"tools/go.mod": "module zeta.dev/orders/tools\n\ngo 1.21\n",
+		// The moved import now sorts after the one it used to precede.
+		"main.go": `package main
+
+import (
+	"github.com/acme/log"
+	"zeta.dev/orders/internal/app"
+)
+
+func main() { log.Print(app.Name) }
+`,
+		"internal/db/db.go": "package db // mine\n\nimport _ \"zeta.dev/orders/internal/app\"\n",
+	} {
+		if after[name] != want {
+			t.Errorf("%s:\n%s\nwant:\n%s", name, after[name], want)
+		}
+	}
+	for _, name := range []string{"internal/app/app.go", "vendor/modules.txt", "testdata/old/x.go", ".config/settings.go", "docs/example.com.txt"} {
+		if _, ok := before[name]; !ok {
+			t.Errorf("%s was not generated", name)
+		} else if after[name] != before[name] {
+			t.Errorf("%s was rewritten:\n%s", name, after[name])
+		}
+	}
+
+	l, err := lock.Read(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := l.Answers[manifest.ModulePath]; got != "zeta.dev/orders" {
+		t.Errorf("locked module path = %q, want zeta.dev/orders", got)
+	}
+	for name, want := range map[string]string{
+		"go.mod":  lock.Sum([]byte(after["go.mod"])),
+		"main.go": lock.Sum([]byte(after["main.go"])),
+		// Edited files keep the sum of what the template generated.
+		"internal/db/db.go": lock.Sum([]byte("package db\n\nimport _ \"example.com/orders/internal/app\"\n")),
+	} {
+		if l.Files[name] != want {
+			t.Errorf("locked sum of %s = %s, want %s", name, l.Files[name], want)
+		}
+	}
+
+	// A project already at the path has nothing to move.
+	if _, err := execute(t, "rename-module", "-C", dest, "zeta.dev/orders"); err == nil || err.Error() != "the module is already zeta.dev/orders" {
+		t.Errorf("renaming to the same path = %v", err)
+	}
+}
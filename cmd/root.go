@@ -7,10 +7,18 @@ import (
 	"github.com/spf13/cobra"
 )
 
+// Version is the nturu release, set at build time with
+// -ldflags "-X github.com/CeoFred/nturu/cmd.Version=v1.2.3".
+var Version = "dev"
+
 var rootCmd = &cobra.Command{
-	Use:   "nturu",
-	Short: "nturu is a microservice boilerplate generator using go.",
-	Long:  `nturu is a microservice boilerplate generator using go.`,
+	Use:     "nturu",
+	Short:   "nturu is a microservice boilerplate generator using go.",
+	Long:    `nturu is a microservice boilerplate generator using go.`,
+	Version: Version,
+	// Execute reports errors itself, without dumping the usage text.
+	SilenceErrors: true,
+	SilenceUsage:  true,
 	Run: func(cmd *cobra.Command, args []string) {
 		if len(args) == 0 {
 			fmt.Println(fmt.Errorf("no arguments specified"))
@@ -21,7 +29,7 @@ var rootCmd = &cobra.Command{
 
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
+		fmt.Println("Error:", err)
 		os.Exit(1)
 	}
 }
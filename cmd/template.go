@@ -0,0 +1,191 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/CeoFred/nturu/manifest"
+	"github.com/CeoFred/nturu/source"
+)
+
+// variableFlags holds the value of every flag generated from a variable of
+// the template being generated, keyed by flag name.
+var variableFlags = map[string]*string{}
+
+// variableValues collects --set Name=value answers.
+var variableValues map[string]string
+
+// catalog finds the templates generate and templates can open by name.
+var catalog = &source.Catalog{
+	Embedded: embededTemplates,
+	LocalDir: source.LocalDir(),
+	Cache:    &source.Cache{Dir: source.CacheDir()},
+}
+
+// parseBuiltinFlags parses the flags of cmd itself out of the command
+// line, skipping the ones the template adds, and returns the arguments.
+// Every flag a template adds takes a value, which is skipped with it.
+func parseBuiltinFlags(cmd *cobra.Command, line []string) ([]string, error) {
+	flags := cmd.Flags()
+	flags.ParseErrorsWhitelist.UnknownFlags = true
+	if err := flags.Parse(line); err != nil {
+		return nil, err
+	}
+	return flags.Args(), nil
+}
+
+// parseVariableFlags registers the flags of the variables of m on cmd and
+// parses them out of the command line, rejecting flags neither knows.
+func parseVariableFlags(cmd *cobra.Command, m *manifest.Manifest, line []string) error {
+	builtin := map[string]bool{}
+	cmd.Flags().VisitAll(func(f *pflag.Flag) { builtin[f.Name] = true })
+	registerVariableFlags(cmd, m)
+
+	strict := pflag.NewFlagSet(cmd.Name(), pflag.ContinueOnError)
+	strict.SetOutput(io.Discard)
+	strict.Usage = func() {}
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if builtin[f.Name] {
+			// Set by parseBuiltinFlags already; a second Set would append
+			// to lists.
+			f = &pflag.Flag{Name: f.Name, Shorthand: f.Shorthand, NoOptDefVal: f.NoOptDefVal, Value: ignored(f.Value.Type())}
+		}
+		strict.AddFlag(f)
+	})
+	return strict.Parse(line)
+}
+
+// registerVariableFlags adds a flag to cmd for every variable declared by
+// m but the well-known ones, which --name and --module set. Manifests
+// cannot take the flags of generate itself, so a variable whose flag or
+// shorthand is taken all the same is only reported; --set still sets it.
+func registerVariableFlags(cmd *cobra.Command, m *manifest.Manifest) {
+	flags := cmd.Flags()
+	for _, v := range m.Variables {
+		if v.Name == manifest.AppName || v.Name == manifest.ModulePath {
+			continue
+		}
+		flag := v.FlagName()
+		if flags.Lookup(flag) != nil || len(v.Shorthand) > 1 || (v.Shorthand != "" && flags.ShorthandLookup(v.Shorthand) != nil) {
+			fmt.Fprintf(cmd.ErrOrStderr(), "Warning: template %s: variable %s cannot have the flag --%s; set it with --set %s=<value>\n", m.Name, v.Name, flag, v.Name)
+			continue
+		}
+		variableFlags[flag] = flags.StringP(flag, v.Shorthand, "", v.Usage())
+	}
+}
+
+// ignored is the value of a flag that is parsed but not set.
+type ignored string
+
+func (v ignored) String() string   { return "" }
+func (v ignored) Set(string) error { return nil }
+func (v ignored) Type() string     { return string(v) }
+
+// collectVariableFlags copies --name, --module, the variable flags and
+// --set values given on the command line into answers.
+func collectVariableFlags(cmd *cobra.Command, m *manifest.Manifest, answers map[string]string) error {
+	if cmd.Flags().Changed("name") {
+		answers[manifest.AppName] = ProjectName
+	}
+	if cmd.Flags().Changed("module") {
+		if m.Variable(manifest.ModulePath) == nil {
+			return fmt.Errorf("template %s does not use --module", m.Name)
+		}
+		answers[manifest.ModulePath] = ProjectModule
+	}
+	for _, v := range m.Variables {
+		if value, ok := variableFlags[v.FlagName()]; ok && cmd.Flags().Changed(v.FlagName()) {
+			answers[v.Name] = *value
+		}
+	}
+	for name, value := range variableValues {
+		if m.Variable(name) == nil {
+			return fmt.Errorf("template %s has no variable %q", m.Name, name)
+		}
+		answers[name] = value
+	}
+	return nil
+}
+
+// askVariable prompts on the terminal until the answer is valid for the
+// variable.
+func askVariable(in *bufio.Reader) manifest.Asker {
+	return func(v *manifest.Variable, def string) (string, error) {
+		question := v.Prompt
+		if question == "" {
+			question = v.Name + "?"
+		}
+		switch {
+		case v.Type == manifest.Enum:
+			question += " [" + strings.Join(v.Choices, "/") + "]"
+		case v.Type == manifest.Bool:
+			question += " [y/n]"
+		}
+		if def != "" {
+			question += " (" + def + ")"
+		}
+
+		for {
+			fmt.Printf("\033[1;31m %s\033[0m\n", question)
+			answer, err := in.ReadString('\n')
+			if err != nil && answer == "" {
+				return "", fmt.Errorf("reading %s: %w", v.Name, err)
+			}
+			answer = strings.TrimSpace(answer)
+			if answer == "" {
+				answer = def
+			}
+			if answer == "" && v.Required {
+				fmt.Println("An answer is required.")
+				continue
+			}
+			if _, err := v.Convert(answer); err != nil {
+				fmt.Println(err)
+				continue
+			}
+			clearScreen()
+			return answer, nil
+		}
+	}
+}
+
+// askFeatureEnabled asks on the terminal whether to include a feature,
+// offering its default.
+func askFeatureEnabled(in *bufio.Reader) manifest.FeatureAsker {
+	return func(f *manifest.Feature) (bool, error) {
+		question := "Include " + f.Name
+		if f.Description != "" {
+			question += " (" + f.Description + ")"
+		}
+		if f.Default {
+			question += "? [Y/n]"
+		} else {
+			question += "? [y/N]"
+		}
+
+		for {
+			fmt.Printf("\033[1;31m %s\033[0m\n", question)
+			answer, err := in.ReadString('\n')
+			if err != nil && answer == "" {
+				return false, fmt.Errorf("reading feature %s: %w", f.Name, err)
+			}
+			switch strings.ToLower(strings.TrimSpace(answer)) {
+			case "":
+				clearScreen()
+				return f.Default, nil
+			case "y", "yes":
+				clearScreen()
+				return true, nil
+			case "n", "no":
+				clearScreen()
+				return false, nil
+			}
+			fmt.Println("Please answer y or n.")
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"bytes"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/CeoFred/nturu/manifest"
+)
+
+// testCommand has flags like generate's.
+func testCommand() (*cobra.Command, *bool, *[]string) {
+	cmd := &cobra.Command{Use: "generate"}
+	force := cmd.Flags().Bool("force", false, "")
+	with := cmd.Flags().StringSlice("with", nil, "")
+	cmd.Flags().StringP("template", "t", "", "")
+	cmd.SetErr(&bytes.Buffer{})
+	return cmd, force, with
+}
+
+func TestReservedFlags(t *testing.T) {
+	generateCmd.InitDefaultHelpFlag()
+	generateCmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if variableFlags[f.Name] != nil {
+			return
+		}
+		if !slices.Contains(manifest.ReservedFlags, f.Name) {
+			t.Errorf("flag --%s of generate is not in manifest.ReservedFlags", f.Name)
+		}
+		if f.Shorthand != "" && !slices.Contains(manifest.ReservedShorthands, f.Shorthand) {
+			t.Errorf("shorthand -%s of generate is not in manifest.ReservedShorthands", f.Shorthand)
+		}
+	})
+}
+
+func TestRegisterVariableFlagsCollision(t *testing.T) {
+	cmd, _, _ := testCommand()
+	var stderr bytes.Buffer
+	cmd.SetErr(&stderr)
+	// Built by hand: Validate would reject the first two.
+	m := &manifest.Manifest{Name: "clash", Variables: []manifest.Variable{
+		{Name: "Force"},
+		{Name: "Tag", Shorthand: "t"},
+		{Name: "Port", Shorthand: "p"},
+	}}
+	registerVariableFlags(cmd, m)
+
+	if f := cmd.Flags().Lookup("port"); f == nil || f.Shorthand != "p" {
+		t.Errorf("--port not registered: %v", f)
+	}
+	if cmd.Flags().Lookup("tag") != nil {
+		t.Error("--tag registered with the shorthand of --template")
+	}
+	for _, want := range []string{"variable Force cannot have the flag --force", "variable Tag cannot have the flag --tag"} {
+		if !strings.Contains(stderr.String(), want) {
+			t.Errorf("warnings do not report %q:\n%s", want, stderr.String())
+		}
+	}
+}
+
+func TestParseFlags(t *testing.T) {
+	cmd, force, with := testCommand()
+	line := []string{"--force", "--port", "8080", "mini", "--with", "a", "-t", "x", "--with=b"}
+	args, err := parseBuiltinFlags(cmd, line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(args, []string{"mini"}) {
+		t.Errorf("args = %q, want [mini]", args)
+	}
+
+	m := &manifest.Manifest{Name: "mini", Variables: []manifest.Variable{{Name: "Port"}, {Name: "Debug"}}}
+	if err := parseVariableFlags(cmd, m, line); err != nil {
+		t.Fatal(err)
+	}
+	answers := map[string]string{}
+	if err := collectVariableFlags(cmd, m, answers); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(answers, map[string]string{"Port": "8080"}) {
+		t.Errorf("answers = %v, want Port=8080", answers)
+	}
+	// Parsing the command line twice must not set the built-in flags twice.
+	if !*force || !reflect.DeepEqual(*with, []string{"a", "b"}) {
+		t.Errorf("force = %v, with = %q; want true, [a b]", *force, *with)
+	}
+
+	cmd, _, _ = testCommand()
+	line = []string{"mini", "--prot", "8080"}
+	if _, err := parseBuiltinFlags(cmd, line); err != nil {
+		t.Fatal(err)
+	}
+	if err := parseVariableFlags(cmd, m, line); err == nil || err.Error() != "unknown flag: --prot" {
+		t.Errorf("parseVariableFlags error = %v, want unknown flag: --prot", err)
+	}
+}
+
+func TestNameAndModuleFlags(t *testing.T) {
+	resetFlags(t, generateCmd)
+	m := &manifest.Manifest{Name: "mini", Variables: []manifest.Variable{
+		{Name: manifest.AppName, Flag: "project"},
+		{Name: manifest.ModulePath},
+	}}
+	line := []string{"--name", "orders", "-m", "example.com/orders"}
+	if _, err := parseBuiltinFlags(generateCmd, line); err != nil {
+		t.Fatal(err)
+	}
+	if err := parseVariableFlags(generateCmd, m, line); err != nil {
+		t.Fatal(err)
+	}
+	answers := map[string]string{}
+	if err := collectVariableFlags(generateCmd, m, answers); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{manifest.AppName: "orders", manifest.ModulePath: "example.com/orders"}
+	if !reflect.DeepEqual(answers, want) {
+		t.Errorf("answers = %v, want %v", answers, want)
+	}
+
+	m.Variables = m.Variables[:1]
+	if err := collectVariableFlags(generateCmd, m, answers); err == nil || err.Error() != "template mini does not use --module" {
+		t.Errorf("collectVariableFlags error = %v, want template mini does not use --module", err)
+	}
+}
@@ -0,0 +1,497 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/CeoFred/nturu/generator"
+	"github.com/CeoFred/nturu/manifest"
+	"github.com/CeoFred/nturu/source"
+)
+
+// TemplatesFormat is the output format of the templates commands.
+var TemplatesFormat string
+
+// PruneOlderThan is how long a cached template may go unused before prune
+// removes it.
+var PruneOlderThan string
+
+func init() {
+	for _, cmd := range []*cobra.Command{templatesListCmd, templatesDescribeCmd} {
+		cmd.Flags().StringVar(&TemplatesFormat, "format", "text", "output format: text or json")
+		templatesCmd.AddCommand(cmd)
+	}
+	templatesPruneCmd.Flags().StringVar(&PruneOlderThan, "older-than", "30d", "remove templates not used for this long, e.g. 12h, 30d or 2w")
+	templatesCmd.AddCommand(templatesPullCmd, templatesUpdateCmd, templatesPruneCmd)
+	rootCmd.AddCommand(templatesCmd)
+}
+
+var templatesCmd = &cobra.Command{
+	Use:   "templates",
+	Short: "Lists and inspects the templates nturu can generate from.",
+	Long: `Lists and inspects the templates nturu can generate from.
+
+Templates are compiled into nturu, or installed locally as directories under
+` + source.LocalDir() + `.
+A local template replaces a built-in one of the same name.
+
+Templates downloaded from http(s) archive URLs are cached under
+` + source.CacheDir() + `,
+one entry per URL and template version, and checked against their recorded
+SHA-256 whenever they are used.
+
+list and describe print JSON with --format json. It was first planned as
+--output json, but -o/--output names the directory generate writes to, so
+every command selects JSON with --format instead.`,
+}
+
+var templatesListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists every available template.",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := checkFormat(TemplatesFormat); err != nil {
+			return err
+		}
+
+		templates, err := catalog.List()
+		if err != nil {
+			// A broken template should not hide the working ones.
+			fmt.Fprintln(os.Stderr, "Warning:", err)
+		}
+
+		if TemplatesFormat == "json" {
+			list := []templateInfo{}
+			for _, t := range templates {
+				list = append(list, newTemplateInfo(t))
+			}
+			return writeJSON(cmd.OutOrStdout(), list)
+		}
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tSOURCE\tVERSION\tDESCRIPTION")
+		for _, t := range templates {
+			// Cached templates are used by URL, not by name.
+			name := t.Name
+			if t.Kind == source.Cached {
+				name = t.Location
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", name, t.Kind, t.Manifest.Version, firstLine(t.Manifest.Description))
+		}
+		return w.Flush()
+	},
+}
+
+var templatesDescribeCmd = &cobra.Command{
+	Use:   "describe <template>",
+	Short: "Shows the variables, features and files of a template.",
+	Long: `Shows the variables, features and files of a template.
+
+The file tree is the one generate produces with every feature at its
+default. Paths depending on a required variable without a default use a
+placeholder value. The template is a name, a directory, a file:// URL or
+a git+ reference, as for generate.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := checkFormat(TemplatesFormat); err != nil {
+			return err
+		}
+
+		t, err := catalog.Resolve(args[0])
+		if err != nil {
+			return err
+		}
+		defer t.Close()
+		files, err := sampleFiles(t)
+		if err != nil {
+			return fmt.Errorf("template %s: %w", t.Name, err)
+		}
+
+		info := newTemplateInfo(t)
+		info.Location = t.Location
+		info.Variables = t.Manifest.Variables
+		info.Features = t.Manifest.Features
+		info.Hooks = t.Manifest.Hooks
+		info.Tools = t.Manifest.Tools
+		info.Files = files
+
+		if TemplatesFormat == "json" {
+			return writeJSON(cmd.OutOrStdout(), info)
+		}
+		printTemplate(cmd.OutOrStdout(), info)
+		return nil
+	},
+}
+
+var templatesPullCmd = &cobra.Command{
+	Use:   "pull <url>",
+	Short: "Downloads an archive template into the cache.",
+	Long: `Downloads an archive template into the cache.
+
+The URL points at a zip or tar.gz archive, optionally followed by //<subdir>
+when the template is not at the root of the archive. Pulling a URL again
+replaces the cached copy of the same template version.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !source.IsArchive(args[0]) {
+			return fmt.Errorf("%s is not an http(s) archive URL; only archives are cached", args[0])
+		}
+		e, err := catalog.Cache.Pull(args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Pulled %s %s from %s (sha256 %s)\n", e.Name, e.Version, e.Source, e.SHA256)
+		return nil
+	},
+}
+
+var templatesUpdateCmd = &cobra.Command{
+	Use:   "update",
+	Short: "Downloads every cached archive template again.",
+	Long: `Downloads every cached archive template again, caching new versions
+alongside the old ones.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		entries, err := catalog.Cache.Entries()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Warning:", err)
+		}
+
+		latest := map[string]*source.Entry{}
+		var sources []string
+		for _, e := range entries {
+			if latest[e.Source] == nil {
+				sources = append(sources, e.Source)
+			}
+			latest[e.Source] = e
+		}
+
+		var errs []error
+		for _, src := range sources {
+			e, err := catalog.Cache.Pull(src)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			old := latest[src]
+			switch {
+			case old.Version != e.Version:
+				fmt.Fprintf(cmd.OutOrStdout(), "%s: updated %s to %s\n", src, old.Version, e.Version)
+			case old.SHA256 != e.SHA256:
+				fmt.Fprintf(cmd.OutOrStdout(), "%s: %s changed without a new version\n", src, e.Version)
+			default:
+				fmt.Fprintf(cmd.OutOrStdout(), "%s: %s is up to date\n", src, e.Version)
+			}
+		}
+		return errors.Join(errs...)
+	},
+}
+
+var templatesPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Removes cached templates that have not been used for a while.",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		age, err := parseAge(PruneOlderThan)
+		if err != nil {
+			return fmt.Errorf("--older-than: %w", err)
+		}
+		entries, err := catalog.Cache.Entries()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Warning:", err)
+		}
+
+		cutoff := time.Now().Add(-age)
+		var errs []error
+		for _, e := range entries {
+			last := e.Used
+			if last.IsZero() {
+				last = e.Fetched
+			}
+			if last.After(cutoff) {
+				continue
+			}
+			if err := catalog.Cache.Remove(e); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Removed %s %s (last used %s)\n", e.Source, e.Version, last.Local().Format(time.DateOnly))
+		}
+		return errors.Join(errs...)
+	},
+}
+
+// parseAge parses a duration, also accepting days and weeks such as "30d".
+func parseAge(s string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(s, suffix); ok {
+			count, err := strconv.Atoi(n)
+			if err != nil || count < 0 {
+				return 0, fmt.Errorf("invalid duration %q", s)
+			}
+			return time.Duration(count) * unit, nil
+		}
+	}
+	return time.ParseDuration(s)
+}
+
+// templateInfo is the description of a template printed by the templates
+// commands. list fills in the summary only.
+type templateInfo struct {
+	Name        string              `json:"name"`
+	Source      source.Kind         `json:"source"`
+	Location    string              `json:"location,omitempty"`
+	Commit      string              `json:"commit,omitempty"`
+	Digest      string              `json:"digest,omitempty"`
+	Version     string              `json:"version"`
+	Description string              `json:"description"`
+	Variables   []manifest.Variable `json:"variables,omitempty"`
+	Features    []manifest.Feature  `json:"features,omitempty"`
+	Hooks       []manifest.Hook     `json:"hooks,omitempty"`
+	Tools       []manifest.Tool     `json:"tools,omitempty"`
+	Files       []string            `json:"files,omitempty"`
+}
+
+func newTemplateInfo(t *source.Template) templateInfo {
+	info := templateInfo{
+		Name:        t.Name,
+		Source:      t.Kind,
+		Commit:      t.Commit,
+		Digest:      t.Digest,
+		Version:     t.Manifest.Version,
+		Description: t.Manifest.Description,
+	}
+	if t.Kind != source.Embedded {
+		info.Location = t.Location
+	}
+	return info
+}
+
+// checkFormat checks the value of a --format flag.
+func checkFormat(format string) error {
+	switch format {
+	case "text", "json":
+		return nil
+	}
+	return fmt.Errorf("unknown format %q: want text or json", format)
+}
+
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// sampleFiles lists the files t generates with default features, answering
+// required variables that have no default with a placeholder.
+func sampleFiles(t *source.Template) ([]string, error) {
+	m := t.Manifest
+	answers := map[string]string{}
+	for _, v := range m.Variables {
+		if !v.Required || v.Default != "" {
+			continue
+		}
+		switch v.Type {
+		case manifest.Enum:
+			answers[v.Name] = v.Choices[0]
+		case manifest.Int:
+			answers[v.Name] = "0"
+		case manifest.Bool:
+			answers[v.Name] = "false"
+		default:
+			answers[v.Name] = v.Name
+		}
+	}
+	values, err := m.Resolve(answers, nil)
+	if err != nil {
+		return nil, err
+	}
+	features, err := m.SelectFeatures(nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	generated, err := generator.New(t.FS, m, values, features).Files()
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, f := range generated {
+		files = append(files, f.Path)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func printTemplate(out io.Writer, info templateInfo) {
+	origin := string(info.Source)
+	if info.Location != origin {
+		origin += ": " + info.Location
+	}
+	if info.Commit != "" {
+		origin += " at " + info.Commit
+	}
+	if info.Digest != "" {
+		origin += ", " + info.Digest
+	}
+	fmt.Fprintf(out, "%s %s (%s)\n", info.Name, info.Version, origin)
+	if info.Description != "" {
+		fmt.Fprintln(out, info.Description)
+	}
+
+	if len(info.Variables) > 0 {
+		fmt.Fprintln(out, "\nVariables:")
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		for _, v := range info.Variables {
+			flag := "--" + v.FlagName()
+			if v.Shorthand != "" {
+				flag += ", -" + v.Shorthand
+			}
+			var notes []string
+			if v.Required {
+				notes = append(notes, "required")
+			}
+			if v.Default != "" {
+				notes = append(notes, "default "+v.Default)
+			}
+			if len(v.Choices) > 0 {
+				notes = append(notes, "one of "+strings.Join(v.Choices, ", "))
+			}
+			if v.When != "" {
+				notes = append(notes, "when "+v.When)
+			}
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s\n", v.Name, flag, v.Type, v.Usage(), strings.Join(notes, "; "))
+		}
+		w.Flush()
+	}
+
+	if len(info.Features) > 0 {
+		fmt.Fprintln(out, "\nFeatures:")
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		for _, f := range info.Features {
+			state := "off"
+			if f.Default {
+				state = "on"
+			}
+			description := f.Description
+			if len(f.Requires) > 0 {
+				description += " (requires " + strings.Join(f.Requires, ", ") + ")"
+			}
+			fmt.Fprintf(w, "  %s\t%s\t%s\n", f.Name, state, description)
+		}
+		w.Flush()
+	}
+
+	if len(info.Hooks) > 0 {
+		fmt.Fprintln(out, "\nHooks, run after generating:")
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		for _, h := range info.Hooks {
+			fmt.Fprintf(w, "  %s\t%s\t%s\n", h.Name, strings.Join(h.Run, " "), strings.Join(hookNotes(h), "; "))
+		}
+		w.Flush()
+	}
+
+	if len(info.Tools) > 0 {
+		fmt.Fprintln(out, "\nTools, checked by nturu doctor:")
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		for _, t := range info.Tools {
+			version := "any version"
+			if t.Version != "" {
+				version = t.Version + " or newer"
+			}
+			var notes []string
+			if t.When != "" {
+				notes = append(notes, "when "+t.When)
+			}
+			if t.Optional {
+				notes = append(notes, "optional")
+			}
+			fmt.Fprintf(w, "  %s\t%s\t%s\n", t.Name, version, strings.Join(notes, "; "))
+		}
+		w.Flush()
+	}
+
+	fmt.Fprintln(out, "\nFiles:")
+	printTree(out, info.Files, nil)
+}
+
+// hookNotes describes when and how a hook runs, for listings.
+func hookNotes(h manifest.Hook) []string {
+	var notes []string
+	if h.Dir != "" && h.Dir != "." {
+		notes = append(notes, "in "+h.Dir)
+	}
+	if h.When != "" {
+		notes = append(notes, "when "+h.When)
+	}
+	if h.Timeout != "" {
+		notes = append(notes, "timeout "+h.Timeout)
+	}
+	if h.Optional {
+		notes = append(notes, "optional")
+	}
+	return notes
+}
+
+// printTree draws the sorted slash-separated paths as a directory tree. A
+// non-nil label returns text printed after the entry at a path, files and
+// directories alike.
+func printTree(out io.Writer, paths []string, label func(path string) string) {
+	type node struct {
+		name     string
+		path     string
+		children []*node
+	}
+	root := &node{name: "."}
+	for _, p := range paths {
+		n := root
+		for _, part := range strings.Split(p, "/") {
+			var child *node
+			for _, c := range n.children {
+				if c.name == part {
+					child = c
+				}
+			}
+			if child == nil {
+				child = &node{name: part, path: strings.TrimPrefix(n.path+"/"+part, "/")}
+				n.children = append(n.children, child)
+			}
+			n = child
+		}
+	}
+
+	var walk func(n *node, indent string)
+	walk = func(n *node, indent string) {
+		for i, child := range n.children {
+			branch, next := "├── ", "│   "
+			if i == len(n.children)-1 {
+				branch, next = "└── ", "    "
+			}
+			line := indent + branch + child.name
+			if label != nil {
+				if l := label(child.path); l != "" {
+					line += "  " + l
+				}
+			}
+			fmt.Fprintln(out, line)
+			walk(child, indent+next)
+		}
+	}
+	fmt.Fprintln(out, root.name)
+	walk(root, "")
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(s), "\n")
+	return line
+}
@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CeoFred/nturu/source"
+)
+
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"30d", 30 * 24 * time.Hour},
+		{"0d", 0},
+		{"2w", 14 * 24 * time.Hour},
+		{"12h", 12 * time.Hour},
+		{"90m", 90 * time.Minute},
+		{"1h30m", 90 * time.Minute},
+	}
+	for _, tt := range tests {
+		got, err := parseAge(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("parseAge(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+	}
+	for _, in := range []string{"", "d", "-1d", "1.5d", "3x", "w2"} {
+		if _, err := parseAge(in); err == nil {
+			t.Errorf("parseAge(%q) succeeded, want an error", in)
+		}
+	}
+}
+
+func TestTemplatesPrune(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now().UTC()
+	entries := map[string]source.Entry{
+		// Used recently, though fetched long ago.
+		"a/1.0.0": {Source: "https://example.com/a.zip", Version: "1.0.0", Fetched: now.AddDate(0, 0, -90), Used: now.AddDate(0, 0, -1)},
+		"a/0.9.0": {Source: "https://example.com/a.zip", Version: "0.9.0", Fetched: now.AddDate(0, 0, -90), Used: now.AddDate(0, 0, -40)},
+		// Never used, fetched long ago.
+		"b/2.0.0": {Source: "https://example.com/b.zip", Version: "2.0.0", Fetched: now.AddDate(0, 0, -31)},
+		"c/1.0.0": {Source: "https://example.com/c.zip", Version: "1.0.0", Fetched: now.AddDate(0, 0, -2)},
+	}
+	for name, e := range entries {
+		data, err := json.Marshal(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(filepath.Join(dir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name, "entry.json"), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer func(c *source.Cache) { catalog.Cache = c }(catalog.Cache)
+	catalog.Cache = &source.Cache{Dir: dir}
+
+	var out bytes.Buffer
+	rootCmd.SetOut(&out)
+	defer rootCmd.SetOut(nil)
+	rootCmd.SetArgs([]string{"templates", "prune", "--older-than", "30d"})
+	defer rootCmd.SetArgs(nil)
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, removed := range []string{"https://example.com/a.zip 0.9.0", "https://example.com/b.zip 2.0.0"} {
+		if !strings.Contains(out.String(), "Removed "+removed) {
+			t.Errorf("prune did not remove %s:\n%s", removed, out.String())
+		}
+	}
+	left, err := catalog.Cache.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var versions []string
+	for _, e := range left {
+		versions = append(versions, e.Source+" "+e.Version)
+	}
+	if got := strings.Join(versions, ", "); got != "https://example.com/a.zip 1.0.0, https://example.com/c.zip 1.0.0" {
+		t.Errorf("left in the cache: %s", got)
+	}
+	// b has no versions left, so its directory goes too.
+	if _, err := os.Stat(filepath.Join(dir, "b")); !os.IsNotExist(err) {
+		t.Errorf("b is left in the cache: %v", err)
+	}
+
+	rootCmd.SetArgs([]string{"templates", "prune", "--older-than", "soon"})
+	if err := rootCmd.Execute(); err == nil || !strings.HasPrefix(err.Error(), "--older-than: ") {
+		t.Errorf("prune --older-than soon = %v", err)
+	}
+}
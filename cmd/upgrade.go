@@ -0,0 +1,346 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/CeoFred/nturu/diff"
+	"github.com/CeoFred/nturu/lock"
+	"github.com/CeoFred/nturu/manifest"
+	"github.com/CeoFred/nturu/source"
+)
+
+var UpgradeTo string
+var UpgradeTemplate string
+var UpgradeDryRun bool
+var UpgradeValues map[string]string
+var UpgradeWith []string
+var UpgradeWithout []string
+
+func init() {
+	upgradeCmd.Flags().StringVar(&UpgradeTo, "to", "", "template version to upgrade to: a tag, branch or commit for git templates")
+	upgradeCmd.Flags().StringVarP(&UpgradeTemplate, "template", "t", "", "upgrade from another template source, e.g. a new archive URL")
+	upgradeCmd.Flags().BoolVar(&UpgradeDryRun, "dry-run", false, "print what would change without writing anything")
+	upgradeCmd.Flags().StringToStringVar(&UpgradeValues, "set", nil, "set a template variable, e.g. --set Port=8080")
+	upgradeCmd.Flags().StringSliceVar(&UpgradeWith, "with", nil, "template features to enable")
+	upgradeCmd.Flags().StringSliceVar(&UpgradeWithout, "without", nil, "template features to disable")
+	rootCmd.AddCommand(upgradeCmd)
+}
+
+var upgradeCmd = &cobra.Command{
+	Use:   "upgrade [project dir]",
+	Short: "Re-applies a newer template version onto a generated project.",
+	Long: `Re-applies a newer template version onto a generated project.
+
+The template, answers and features recorded in ` + lock.File + ` are rendered
+with the new template version and merged into the project:
+
+  - files you did not edit are replaced by the new version;
+  - files the template did not change keep your edits;
+  - when both changed, the changes are merged line by line, and lines both
+    sides changed differently are left between conflict markers;
+  - when the old template output is not available to merge against, or the
+    file is binary, the new version is written next to yours as <file>.rej.
+
+Files the template dropped are removed unless you edited them. Variables and
+features new in the template get their defaults; set them with --set, --with
+and --without.
+
+Without --to, the template is upgraded to the newest version its source
+offers: the current built-in or local template, the head of the git ref, or
+the newest cached archive (see nturu templates update).`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir := "."
+		if len(args) > 0 {
+			dir = args[0]
+		}
+		l, err := lock.Read(dir)
+		if err != nil {
+			return err
+		}
+
+		ref := l.Template.Ref
+		if UpgradeTemplate != "" {
+			ref = UpgradeTemplate
+		}
+		var next *source.Template
+		if UpgradeTo != "" {
+			next, err = catalog.ResolveVersion(ref, UpgradeTo)
+		} else {
+			next, err = catalog.Resolve(ref)
+		}
+		if err != nil {
+			return err
+		}
+		defer next.Close()
+
+		// The old template output is the base of the merge. It is only
+		// trusted file by file, where it matches the digests in the lock.
+		base := map[string][]byte{}
+		var known *manifest.Manifest
+		old, err := catalog.ResolvePinned(l.Template.Ref, l.Template.Commit, l.Template.Digest)
+		if err == nil {
+			defer old.Close()
+			known = old.Manifest
+			base, err = renderLocked(old, l)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: cannot render %s %s to merge against (%v); edited files the template changed get .rej files\n", l.Template.Name, l.Template.Version, err)
+			base = map[string][]byte{}
+		}
+
+		values, err := resolveLocked(next.Manifest, l, UpgradeValues)
+		if err != nil {
+			return err
+		}
+		features, err := lockedFeatures(next.Manifest, l, known, UpgradeWith, UpgradeWithout)
+		if err != nil {
+			return err
+		}
+		rendered, modes, err := renderProject(next, values, features)
+		if err != nil {
+			return err
+		}
+
+		plan, err := planUpgrade(dir, l, base, rendered, next.Manifest.Version)
+		if err != nil {
+			return err
+		}
+
+		out := cmd.OutOrStdout()
+		verb := "Upgrading"
+		if UpgradeDryRun {
+			verb = "Would upgrade"
+		}
+		fmt.Fprintf(out, "%s %s %s to %s %s\n", verb, l.Template.Name, l.Template.Version, next.Manifest.Name, next.Manifest.Version)
+		printUpgradePlan(out, plan)
+		if UpgradeDryRun {
+			return nil
+		}
+
+		if err := applyUpgrade(dir, plan, modes); err != nil {
+			return err
+		}
+		if err := lock.Write(dir, newLock(next, values, features, sums(rendered))); err != nil {
+			return err
+		}
+		if n := plan.count(conflicted, rejected); n > 0 {
+			verb := "need"
+			if n == 1 {
+				verb = "needs"
+			}
+			return fmt.Errorf("%s %s attention: resolve the conflict markers and .rej files, then commit", plural(n, "file"), verb)
+		}
+		return nil
+	},
+}
+
+// renderLocked renders t exactly as recorded in l, keeping only the files
+// whose content matches the recorded digests.
+func renderLocked(t *source.Template, l *lock.Lock) (map[string][]byte, error) {
+	values, err := resolveLocked(t.Manifest, l, nil)
+	if err != nil {
+		return nil, err
+	}
+	features, err := lockedFeatures(t.Manifest, l, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	rendered, _, err := renderProject(t, values, features)
+	if err != nil {
+		return nil, err
+	}
+	for name, content := range rendered {
+		if l.Files[name] != lock.Sum(content) {
+			delete(rendered, name)
+		}
+	}
+	return rendered, nil
+}
+
+// upgradeAction is what upgrade does to one file.
+type upgradeAction string
+
+const (
+	added      upgradeAction = "added"
+	updated    upgradeAction = "updated"
+	merged     upgradeAction = "merged"
+	conflicted upgradeAction = "conflict"
+	rejected   upgradeAction = "rejected"
+	removed    upgradeAction = "removed"
+	kept       upgradeAction = "kept"
+	skipped    upgradeAction = "skipped"
+)
+
+type upgradeStep struct {
+	Path   string
+	Action upgradeAction
+	// Content is written to Path, or to Path.rej when rejected.
+	Content []byte
+	Note    string
+}
+
+type upgradePlan []upgradeStep
+
+func (p upgradePlan) count(actions ...upgradeAction) int {
+	n := 0
+	for _, step := range p {
+		for _, a := range actions {
+			if step.Action == a {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// planUpgrade decides, file by file, how to bring the project in dir from
+// the template output recorded in l to rendered. base holds the old output
+// where it is known.
+func planUpgrade(dir string, l *lock.Lock, base, rendered map[string][]byte, version string) (upgradePlan, error) {
+	paths := map[string]bool{}
+	for name := range l.Files {
+		paths[name] = true
+	}
+	for name := range rendered {
+		paths[name] = true
+	}
+	sorted := make([]string, 0, len(paths))
+	for name := range paths {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	labels := diff.Labels{Ours: "project", Theirs: "template " + version}
+	var plan upgradePlan
+	for _, name := range sorted {
+		recorded, inLock := l.Files[name]
+		next, inTemplate := rendered[name]
+		current, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		exists := err == nil
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		edited := exists && lock.Sum(current) != recorded
+
+		switch {
+		case !inTemplate && !exists:
+		case !inTemplate && edited:
+			plan = append(plan, upgradeStep{Path: name, Action: kept, Note: "dropped by the template, but edited"})
+		case !inTemplate:
+			plan = append(plan, upgradeStep{Path: name, Action: removed})
+
+		case !exists && !inLock:
+			plan = append(plan, upgradeStep{Path: name, Action: added, Content: next})
+		case !exists && lock.Sum(next) != recorded:
+			plan = append(plan, upgradeStep{Path: name, Action: skipped, Note: "deleted in the project, changed by the template"})
+		case !exists:
+
+		case bytes.Equal(current, next):
+		case inLock && lock.Sum(next) == recorded:
+			// Only the project changed the file.
+		case inLock && !edited:
+			plan = append(plan, upgradeStep{Path: name, Action: updated, Content: next})
+		default:
+			plan = append(plan, mergeStep(name, base, current, next, inLock, labels))
+		}
+	}
+	return plan, nil
+}
+
+// mergeStep merges the edits made to a file in the project with the
+// template's changes to it.
+func mergeStep(name string, base map[string][]byte, current, next []byte, inLock bool, labels diff.Labels) upgradeStep {
+	old, ok := base[name]
+	// A file both the project and the template added merges against nothing.
+	if !ok && inLock {
+		return upgradeStep{Path: name, Action: rejected, Content: next, Note: "old template version unavailable"}
+	}
+	if diff.IsBinary(current) || diff.IsBinary(next) || diff.IsBinary(old) {
+		return upgradeStep{Path: name, Action: rejected, Content: next, Note: "binary file"}
+	}
+
+	lines, conflicts := diff.Merge3(diff.Lines(old), diff.Lines(current), diff.Lines(next), labels)
+	content := []byte(strings.Join(lines, ""))
+	if conflicts > 0 {
+		return upgradeStep{Path: name, Action: conflicted, Content: content, Note: plural(conflicts, "conflict")}
+	}
+	return upgradeStep{Path: name, Action: merged, Content: content}
+}
+
+func printUpgradePlan(out io.Writer, plan upgradePlan) {
+	if len(plan) == 0 {
+		fmt.Fprintln(out, "Nothing to change.")
+		return
+	}
+	for _, step := range plan {
+		line := fmt.Sprintf("  %-9s %s", step.Action, step.Path)
+		if step.Action == rejected {
+			line += " -> " + step.Path + ".rej"
+		}
+		if step.Note != "" {
+			line += " (" + step.Note + ")"
+		}
+		fmt.Fprintln(out, line)
+	}
+
+	var counts []string
+	for _, a := range []upgradeAction{added, updated, merged, removed, conflicted, rejected, kept, skipped} {
+		if n := plan.count(a); n > 0 {
+			counts = append(counts, fmt.Sprintf("%d %s", n, a))
+		}
+	}
+	fmt.Fprintln(out, strings.Join(counts, ", "))
+}
+
+// applyUpgrade carries out plan in the project in dir. Files it creates get
+// the mode in modes the template generates them with.
+func applyUpgrade(dir string, plan upgradePlan, modes map[string]fs.FileMode) error {
+	for _, step := range plan {
+		name := filepath.Join(dir, filepath.FromSlash(step.Path))
+		var err error
+		switch step.Action {
+		case added, updated, merged, conflicted:
+			err = writeProjectFile(name, step.Content, modes[step.Path])
+		case rejected:
+			err = writeProjectFile(name+".rej", step.Content, 0644)
+		case removed:
+			err = os.Remove(name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeProjectFile writes content to name. A file it replaces keeps its
+// mode, which os.WriteFile leaves alone; a new one is created with mode, or
+// 0644 when that is zero, less the umask as generate creates files.
+func writeProjectFile(name string, content []byte, mode fs.FileMode) error {
+	if mode == 0 {
+		mode = 0644
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(name, content, mode)
+}
+
+// plural formats a count of things, e.g. "1 file" or "3 files".
+func plural(n int, thing string) string {
+	if n == 1 {
+		return "1 " + thing
+	}
+	return fmt.Sprintf("%d %ss", n, thing)
+}
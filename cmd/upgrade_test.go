@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/CeoFred/nturu/diff"
+	"github.com/CeoFred/nturu/lock"
+)
+
+// upgradeCase describes one file of a project being upgraded. A nil slice
+// means the file is not there.
+type upgradeCase struct {
+	// old is what the previous template version generated, recorded in
+	// the lock; project is the file in the project; next is what the new
+	// template version renders.
+	old, project, next []byte
+	// unknownBase leaves the old output out of the merge base.
+	unknownBase bool
+	action      upgradeAction
+	content     string
+	note        string
+}
+
+func TestPlanUpgrade(t *testing.T) {
+	b := func(s string) []byte { return []byte(s) }
+	cases := map[string]upgradeCase{
+		"untouched.go": {old: b("a\n"), project: b("a\n"), next: b("a\n")},
+		"clean.go":     {old: b("a\nb\n"), project: b("a\nb\n"), next: b("a\nB\n"), action: updated, content: "a\nB\n"},
+		"local.go":     {old: b("a\n"), project: b("a\nmine\n"), next: b("a\n")},
+		"same.go":      {old: b("a\n"), project: b("b\n"), next: b("b\n")},
+		"merged.go":    {old: b("a\nb\nc\nd\n"), project: b("mine\nb\nc\nd\n"), next: b("a\nb\nc\nD\n"), action: merged, content: "mine\nb\nc\nD\n"},
+		"conflict.go":  {old: b("a\nb\n"), project: b("a\nmine\n"), next: b("a\ntheirs\n"), action: conflicted, content: "a\n<<<<<<< project\nmine\n=======\ntheirs\n>>>>>>> template 1.1.0\n", note: "1 conflict"},
+		"nobase.go":    {old: b("a\n"), project: b("mine\n"), next: b("b\n"), unknownBase: true, action: rejected, content: "b\n", note: "old template version unavailable"},
+		"image.png":    {old: b("\x00a"), project: b("\x00mine"), next: b("\x00b"), action: rejected, content: "\x00b", note: "binary file"},
+		"new.go":       {next: b("new\n"), action: added, content: "new\n"},
+		// A file both sides added merges against nothing.
+		"both-added.go":      {project: b("mine\n"), next: b("theirs\n"), action: conflicted, content: "<<<<<<< project\nmine\n=======\ntheirs\n>>>>>>> template 1.1.0\n", note: "1 conflict"},
+		"dropped.go":         {old: b("a\n"), project: b("a\n"), action: removed},
+		"dropped-edit.go":    {old: b("a\n"), project: b("mine\n"), action: kept, note: "dropped by the template, but edited"},
+		"gone.go":            {old: b("a\n")},
+		"deleted.go":         {old: b("a\n"), next: b("a\n")},
+		"deleted-changed.go": {old: b("a\n"), next: b("b\n"), action: skipped, note: "deleted in the project, changed by the template"},
+	}
+
+	dir := t.TempDir()
+	l := &lock.Lock{Files: map[string]string{}}
+	base, rendered := map[string][]byte{}, map[string][]byte{}
+	for name, c := range cases {
+		if c.old != nil {
+			l.Files[name] = lock.Sum(c.old)
+			if !c.unknownBase {
+				base[name] = c.old
+			}
+		}
+		if c.next != nil {
+			rendered[name] = c.next
+		}
+		if c.project != nil {
+			if err := os.WriteFile(filepath.Join(dir, name), c.project, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	plan, err := planUpgrade(dir, l, base, rendered, "1.1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps := map[string]upgradeStep{}
+	for i, step := range plan {
+		if i > 0 && plan[i-1].Path >= step.Path {
+			t.Errorf("plan is not sorted: %s before %s", plan[i-1].Path, step.Path)
+		}
+		steps[step.Path] = step
+	}
+	for name, c := range cases {
+		step, ok := steps[name]
+		switch {
+		case c.action == "" && ok:
+			t.Errorf("%s: planned %s, want nothing", name, step.Action)
+		case c.action == "":
+		case !ok:
+			t.Errorf("%s: nothing planned, want %s", name, c.action)
+		case step.Action != c.action || string(step.Content) != c.content || step.Note != c.note:
+			t.Errorf("%s: planned %s %q (%s), want %s %q (%s)", name, step.Action, step.Content, step.Note, c.action, c.content, c.note)
+		}
+	}
+	if n := plan.count(conflicted, rejected); n != 4 {
+		t.Errorf("%d files need attention, want 4", n)
+	}
+}
+
+func TestMergeStep(t *testing.T) {
+	labels := diff.Labels{Ours: "project", Theirs: "template 1.1.0"}
+	base := map[string][]byte{"main.go": []byte("a\nb\nc\n")}
+	step := mergeStep("main.go", base, []byte("A\nb\nc\n"), []byte("a\nb\nC\n"), true, labels)
+	if step.Action != merged || string(step.Content) != "A\nb\nC\n" {
+		t.Errorf("mergeStep = %s %q, want a clean merge", step.Action, step.Content)
+	}
+	step = mergeStep("main.go", base, []byte("a\nmine\nc\n"), []byte("a\ntheirs\nc\n"), true, labels)
+	if step.Action != conflicted || step.Note != "1 conflict" || !strings.Contains(string(step.Content), "<<<<<<< project\nmine\n") {
+		t.Errorf("mergeStep = %s %q (%s), want a conflict", step.Action, step.Content, step.Note)
+	}
+}
+
+func TestApplyUpgrade(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string, mode fs.FileMode) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("run.sh", "echo old\n", 0755)
+	write("old.go", "old\n", 0644)
+	write("main.go", "mine\n", 0644)
+
+	plan := upgradePlan{
+		{Path: "run.sh", Action: updated, Content: []byte("echo new\n")},
+		{Path: "scripts/setup.sh", Action: added, Content: []byte("echo setup\n")},
+		{Path: "README.md", Action: added, Content: []byte("# app\n")},
+		{Path: "old.go", Action: removed},
+		{Path: "main.go", Action: rejected, Content: []byte("theirs\n")},
+		{Path: "kept.go", Action: kept},
+	}
+	modes := map[string]fs.FileMode{"run.sh": 0644, "scripts/setup.sh": 0755, "README.md": 0644}
+	if err := applyUpgrade(dir, plan, modes); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, content string
+		exec          bool
+	}{
+		// A file replaced keeps its mode, whatever the template's.
+		{"run.sh", "echo new\n", true},
+		// A new one gets the template's.
+		{"scripts/setup.sh", "echo setup\n", true},
+		{"README.md", "# app\n", false},
+		{"main.go", "mine\n", false},
+		{"main.go.rej", "theirs\n", false},
+	}
+	for _, tt := range tests {
+		name := filepath.Join(dir, filepath.FromSlash(tt.name))
+		content, err := os.ReadFile(name)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if string(content) != tt.content {
+			t.Errorf("%s = %q, want %q", tt.name, content, tt.content)
+		}
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exec := info.Mode()&0100 != 0; exec != tt.exec {
+			t.Errorf("%s has mode %v", tt.name, info.Mode())
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "old.go")); !os.IsNotExist(err) {
+		t.Errorf("old.go was not removed: %v", err)
+	}
+}
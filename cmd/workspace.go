@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/CeoFred/nturu/manifest"
+	"github.com/CeoFred/nturu/modpath"
+	"github.com/CeoFred/nturu/scaffold"
+	"github.com/CeoFred/nturu/source"
+	"github.com/CeoFred/nturu/workspace"
+)
+
+var WorkspaceModule string
+var WorkspaceOutput string
+var ServiceTemplate string
+var ServiceWith []string
+var ServiceWithout []string
+var ServiceSkipHooks bool
+
+func init() {
+	newWorkspaceCmd.Flags().StringVarP(&WorkspaceModule, "module", "m", "", "module path prefix of the shared module and the services (defaults to the name)")
+	newWorkspaceCmd.Flags().StringVarP(&WorkspaceOutput, "output", "o", "", "directory to create the workspace in (defaults to ./<name>)")
+	newCmd.AddCommand(newWorkspaceCmd)
+	rootCmd.AddCommand(newCmd)
+
+	addServiceCmd.Flags().StringVarP(&ServiceTemplate, "template", "t", "default", "template to generate the service from")
+	addServiceCmd.Flags().StringSliceVar(&ServiceWith, "with", nil, "optional template features to include")
+	addServiceCmd.Flags().StringSliceVar(&ServiceWithout, "without", nil, "optional template features to leave out")
+	addServiceCmd.Flags().BoolVar(&ServiceSkipHooks, "skip-hooks", false, "do not run the commands the template runs after generating")
+	addCmd.AddCommand(addServiceCmd)
+}
+
+var newCmd = &cobra.Command{
+	Use:   "new",
+	Short: "Creates a new workspace.",
+}
+
+var newWorkspaceCmd = &cobra.Command{
+	Use:   "workspace <name>",
+	Short: "Creates a workspace for several services side by side.",
+	Long: `Creates a workspace for several services side by side.
+
+	nturu new workspace shop -m github.com/acme/shop
+
+creates shop/ with a go.work using the shared module github.com/acme/shop/shared
+in shared/, for protocol buffers in shared/proto and code the services share,
+a Makefile generating Go code from the protos, a docker-compose.yaml and the
+manifest ` + workspace.File + `. Services are added with nturu add service.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		module := WorkspaceModule
+		if module == "" {
+			module = name
+		}
+		if err := modpath.Check(module); err != nil {
+			return fmt.Errorf("module: %w", err)
+		}
+		dir := WorkspaceOutput
+		if dir == "" {
+			dir = name
+		}
+		dir, err := filepath.Abs(dir)
+		if err != nil {
+			return err
+		}
+		w := &workspace.Workspace{Dir: dir, Name: name, Module: module}
+		if err := workspace.Create(w); err != nil {
+			return err
+		}
+		out := cmd.OutOrStdout()
+		fmt.Fprintf(out, "Created workspace %s in %s\n", name, dir)
+		fmt.Fprintf(out, "Add services with: nturu add service <name> --template fiber -C %s\n", dir)
+		return nil
+	},
+}
+
+var addServiceCmd = &cobra.Command{
+	Use:   "service <name>",
+	Short: "Generates a service into the workspace.",
+	Long: `Generates a service into the workspace.
+
+	nturu add service orders --template fiber
+
+generates orders/ from the fiber template with the module path
+<workspace module>/orders, without asking questions, and registers it in
+go.work, in docker-compose.yaml, where air runs it with the whole workspace
+mounted, and in ` + workspace.File + `. The workspace is found from the
+current directory or -C upwards.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		w, err := workspace.Find(AddDir)
+		if err != nil {
+			return err
+		}
+		if w.Service(name) != nil {
+			return fmt.Errorf("workspace %s already has a service %s", w.Name, name)
+		}
+		dest := filepath.Join(w.Dir, name)
+		if _, err := os.Stat(dest); err == nil {
+			return fmt.Errorf("%s already exists", dest)
+		}
+
+		t, err := catalog.Resolve(ServiceTemplate)
+		if errors.Is(err, source.ErrNotFound) {
+			err = fmt.Errorf("template %q not available; see nturu templates list", ServiceTemplate)
+		}
+		if err != nil {
+			return err
+		}
+		defer t.Close()
+		m := t.Manifest
+
+		module := w.ServiceModule(name)
+		answers := map[string]string{manifest.AppName: name}
+		if m.Variable(manifest.ModulePath) != nil {
+			if err := modpath.Check(module); err != nil {
+				return fmt.Errorf("%s: %w", manifest.ModulePath, err)
+			}
+			answers[manifest.ModulePath] = module
+		}
+		values, err := m.Resolve(answers, nil)
+		if err != nil {
+			return err
+		}
+		features, err := m.SelectFeatures(ServiceWith, ServiceWithout, nil)
+		if err != nil {
+			return err
+		}
+
+		out := cmd.OutOrStdout()
+		if AddDryRun {
+			fmt.Fprintf(out, "Would add service %s from %s\n", name, m.Name)
+			fmt.Fprintf(out, "  create %s/\n", name)
+			for _, file := range []string{workspace.GoWork, workspace.Compose, workspace.File} {
+				fmt.Fprintf(out, "  update %s\n", file)
+			}
+			return nil
+		}
+
+		fmt.Fprintf(out, "Adding service %s from %s\n", name, m.Name)
+		if err := writeProject(cmd.Context(), t, values, features, dest, false, ServiceSkipHooks); err != nil {
+			return err
+		}
+		p, err := scaffold.Open(dest)
+		if err != nil {
+			return err
+		}
+		err = w.AddService(workspace.Service{
+			Name:     name,
+			Template: m.Name,
+			Module:   p.Module,
+			Dir:      path.Join(name, p.GoDir),
+		})
+		if err != nil {
+			return fmt.Errorf("%s is generated, but registering it failed: %w", name, err)
+		}
+		fmt.Fprintf(out, "  create %s/\n", name)
+		for _, file := range []string{workspace.GoWork, workspace.Compose, workspace.File} {
+			fmt.Fprintf(out, "  update %s\n", file)
+		}
+		return nil
+	},
+}
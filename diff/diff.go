@@ -0,0 +1,234 @@
+// Package diff compares and merges text line by line.
+//
+// Line differences are found with Myers' algorithm, printed as unified diffs
+// and combined into three-way merges the way diff3 does.
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Lines splits text into lines, each keeping its "\n". A final line without
+// one is kept as is.
+func Lines(text []byte) []string {
+	var lines []string
+	for len(text) > 0 {
+		i := bytes.IndexByte(text, '\n')
+		if i < 0 {
+			lines = append(lines, string(text))
+			break
+		}
+		lines = append(lines, string(text[:i+1]))
+		text = text[i+1:]
+	}
+	return lines
+}
+
+// IsBinary reports whether content looks like binary data rather than text,
+// judging by a NUL byte in its first 8 KB as git does.
+func IsBinary(content []byte) bool {
+	if len(content) > 8000 {
+		content = content[:8000]
+	}
+	return bytes.IndexByte(content, 0) >= 0
+}
+
+// Change replaces the lines a[A0:A1] with the lines b[B0:B1]. Either range
+// may be empty.
+type Change struct {
+	A0, A1 int
+	B0, B1 int
+}
+
+// Changes returns the smallest set of changes turning a into b, in order.
+func Changes(a, b []string) []Change {
+	// Common prefixes and suffixes are frequent and cheap to strip before
+	// running the quadratic-in-edits search.
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+
+	changes := myers(a[pre:len(a)-suf], b[pre:len(b)-suf])
+	for i := range changes {
+		changes[i].A0 += pre
+		changes[i].A1 += pre
+		changes[i].B0 += pre
+		changes[i].B1 += pre
+	}
+	return changes
+}
+
+// maxEdits bounds the search for a shortest edit script, whose memory grows
+// with the square of the edits. Inputs differing more are treated as
+// entirely rewritten.
+const maxEdits = 2000
+
+// myers finds the shortest edit script between a and b and returns it as
+// changes, each grouping adjacent deletions and insertions.
+func myers(a, b []string) []Change {
+	n, m := len(a), len(b)
+	if n == 0 && m == 0 {
+		return nil
+	}
+	limit := n + m
+	offset := limit + 1
+	v := make([]int, 2*limit+3)
+	// trace[d] keeps v[offset-d-1 : offset+d+2], all that round d reads.
+	var trace [][]int
+
+	var d int
+search:
+	for d = 0; d <= limit; d++ {
+		if d > maxEdits {
+			return []Change{{A0: 0, A1: n, B0: 0, B1: m}}
+		}
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	// Walk the trace back from the end, collecting one edit per step.
+	type edit struct {
+		x, y   int
+		insert bool
+	}
+	var edits []edit
+	x, y := n, m
+	for ; d > 0; d-- {
+		v, base := trace[d], d+1
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[base+k-1] < v[base+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[base+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+		}
+		if x == prevX {
+			edits = append(edits, edit{x: prevX, y: prevY, insert: true})
+		} else {
+			edits = append(edits, edit{x: prevX, y: prevY})
+		}
+		x, y = prevX, prevY
+	}
+
+	var changes []Change
+	for i := len(edits) - 1; i >= 0; i-- {
+		e := edits[i]
+		if len(changes) > 0 {
+			last := &changes[len(changes)-1]
+			if last.A1 == e.x && last.B1 == e.y {
+				if e.insert {
+					last.B1++
+				} else {
+					last.A1++
+				}
+				continue
+			}
+		}
+		c := Change{A0: e.x, A1: e.x, B0: e.y, B1: e.y}
+		if e.insert {
+			c.B1++
+		} else {
+			c.A1++
+		}
+		changes = append(changes, c)
+	}
+	return changes
+}
+
+// Unified returns the unified diff turning a into b with the given lines of
+// context, or "" when they are equal.
+func Unified(aName, bName string, a, b []string, context int) string {
+	changes := Changes(a, b)
+	if len(changes) == 0 {
+		return ""
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", aName, bName)
+	for i := 0; i < len(changes); {
+		// A hunk takes every change whose context overlaps the previous one.
+		j := i + 1
+		for j < len(changes) && changes[j].A0-changes[j-1].A1 <= 2*context {
+			j++
+		}
+		first, last := changes[i], changes[j-1]
+		a0 := max(first.A0-context, 0)
+		a1 := min(last.A1+context, len(a))
+		b0 := first.B0 - (first.A0 - a0)
+		b1 := last.B1 + (a1 - last.A1)
+
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(a0, a1), hunkRange(b0, b1))
+		pos := a0
+		for _, c := range changes[i:j] {
+			writeLines(&out, " ", a[pos:c.A0])
+			writeLines(&out, "-", a[c.A0:c.A1])
+			writeLines(&out, "+", b[c.B0:c.B1])
+			pos = c.A1
+		}
+		writeLines(&out, " ", a[pos:a1])
+		i = j
+	}
+	return out.String()
+}
+
+// hunkRange formats a 0-based half-open range the way hunk headers want it:
+// 1-based start, and the length unless it is 1.
+func hunkRange(start, end int) string {
+	n := end - start
+	if n == 0 {
+		// An empty range names the line before it.
+		return fmt.Sprintf("%d,0", start)
+	}
+	if n == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, n)
+}
+
+func writeLines(out *strings.Builder, prefix string, lines []string) {
+	for _, line := range lines {
+		out.WriteString(prefix)
+		out.WriteString(line)
+		if !strings.HasSuffix(line, "\n") {
+			out.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// Stat counts the lines added and removed between a and b.
+func Stat(a, b []string) (added, removed int) {
+	for _, c := range Changes(a, b) {
+		added += c.B1 - c.B0
+		removed += c.A1 - c.A0
+	}
+	return added, removed
+}
@@ -0,0 +1,220 @@
+package diff
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// lines splits a compact description of lines, one letter per line, into
+// newline-terminated lines.
+func lines(s string) []string {
+	var out []string
+	for _, r := range s {
+		out = append(out, string(r)+"\n")
+	}
+	return out
+}
+
+// patch applies changes, computed from a to b, to a.
+func patch(a, b []string, changes []Change) []string {
+	var out []string
+	pos := 0
+	for _, c := range changes {
+		out = append(out, a[pos:c.A0]...)
+		out = append(out, b[c.B0:c.B1]...)
+		pos = c.A1
+	}
+	return append(out, a[pos:]...)
+}
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"a\n", []string{"a\n"}},
+		{"a\nb", []string{"a\n", "b"}},
+		{"a\n\nb\n", []string{"a\n", "\n", "b\n"}},
+	}
+	for _, tt := range tests {
+		if got := Lines([]byte(tt.in)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Lines(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestIsBinary(t *testing.T) {
+	if IsBinary([]byte("package main\n")) || !IsBinary([]byte("PNG\x00\x01")) {
+		t.Error("IsBinary does not tell text from binary")
+	}
+	late := append([]byte(strings.Repeat("a", 9000)), 0)
+	if IsBinary(late) {
+		t.Error("IsBinary looks past the first 8000 bytes")
+	}
+}
+
+func TestChanges(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want []Change
+	}{
+		{"identical", "abc", "abc", nil},
+		{"both empty", "", "", nil},
+		{"empty a", "", "ab", []Change{{0, 0, 0, 2}}},
+		{"empty b", "ab", "", []Change{{0, 2, 0, 0}}},
+		{"insert at start", "bc", "abc", []Change{{0, 0, 0, 1}}},
+		{"insert at end", "ab", "abc", []Change{{2, 2, 2, 3}}},
+		{"delete at start", "abc", "bc", []Change{{0, 1, 0, 0}}},
+		{"delete at end", "abc", "ab", []Change{{2, 3, 2, 2}}},
+		{"replace in the middle", "abc", "axc", []Change{{1, 2, 1, 2}}},
+		{"two changes", "abcdef", "xbcdey", []Change{{0, 1, 0, 1}, {5, 6, 5, 6}}},
+		{"rewrite", "abc", "xyz", []Change{{0, 3, 0, 3}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := lines(tt.a), lines(tt.b)
+			got := Changes(a, b)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Changes = %v, want %v", got, tt.want)
+			}
+			if p := patch(a, b, got); !reflect.DeepEqual(p, b) {
+				t.Errorf("patched a = %q, want %q", p, b)
+			}
+		})
+	}
+}
+
+// lcs returns the length of the longest common subsequence of a and b.
+func lcs(a, b []string) int {
+	prev, cur := make([]int, len(b)+1), make([]int, len(b)+1)
+	for i := range a {
+		for j := range b {
+			if a[i] == b[j] {
+				cur[j+1] = prev[j] + 1
+			} else {
+				cur[j+1] = max(cur[j], prev[j+1])
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// TestChangesPatch checks, on random inputs, that the changes from a to b
+// are ordered, turn a into b and keep every line the two can share.
+func TestChangesPatch(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	random := func(n int) []string {
+		out := make([]string, n)
+		for i := range out {
+			// Few distinct lines make for many matches.
+			out[i] = string(rune('a'+r.Intn(4))) + "\n"
+		}
+		return out
+	}
+	for i := 0; i < 2000; i++ {
+		a := random(r.Intn(30))
+		b := random(r.Intn(30))
+		if r.Intn(3) == 0 {
+			// A small edit of the same text, as files usually get.
+			mid := len(a) / 2
+			b = append(append(append([]string(nil), a[:mid]...), random(r.Intn(3))...), a[mid+min(1, len(a)-mid):]...)
+		}
+		changes := Changes(a, b)
+		if got := patch(a, b, changes); strings.Join(got, "") != strings.Join(b, "") {
+			t.Fatalf("patching %q with %v gives %q, want %q", a, changes, got, b)
+		}
+		for j, c := range changes {
+			if c.A0 > c.A1 || c.B0 > c.B1 || (c.A0 == c.A1 && c.B0 == c.B1) {
+				t.Fatalf("Changes(%q, %q): malformed change %v", a, b, c)
+			}
+			if j > 0 && c.A0 <= changes[j-1].A1 {
+				t.Fatalf("Changes(%q, %q): change %v does not follow %v", a, b, c, changes[j-1])
+			}
+		}
+		added, removed := Stat(a, b)
+		if kept := lcs(a, b); len(a)-removed != kept || len(b)-added != kept {
+			t.Fatalf("Stat(%q, %q) = +%d -%d, but they share %d lines", a, b, added, removed, kept)
+		}
+	}
+}
+
+func TestChangesTooManyEdits(t *testing.T) {
+	var a, b []string
+	for i := 0; i < maxEdits; i++ {
+		a = append(a, "a\n", "x\n")
+		b = append(b, "b\n", "x\n")
+	}
+	changes := Changes(a, b)
+	// The search gives up and replaces everything between the common
+	// prefix and suffix.
+	if want := []Change{{0, len(a) - 1, 0, len(b) - 1}}; !reflect.DeepEqual(changes, want) {
+		t.Errorf("Changes = %v, want %v", changes, want)
+	}
+	if got := patch(a, b, changes); !reflect.DeepEqual(got, b) {
+		t.Error("patched a differs from b")
+	}
+}
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name    string
+		a, b    string
+		context int
+		want    string
+	}{
+		{"identical", "a\nb\n", "a\nb\n", 3, ""},
+		{
+			name: "one change",
+			a:    "a\nb\nc\nd\ne\n", b: "a\nb\nX\nd\ne\n", context: 1,
+			want: "--- a/f\n+++ b/f\n@@ -2,3 +2,3 @@\n b\n-c\n+X\n d\n",
+		},
+		{
+			name: "insert into empty",
+			a:    "", b: "a\nb\n", context: 3,
+			want: "--- a/f\n+++ b/f\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name: "delete everything",
+			a:    "a\n", b: "", context: 3,
+			want: "--- a/f\n+++ b/f\n@@ -1 +0,0 @@\n-a\n",
+		},
+		{
+			name: "separate hunks",
+			a:    "a\nb\nc\nd\ne\nf\ng\n", b: "A\nb\nc\nd\ne\nf\nG\n", context: 1,
+			want: "--- a/f\n+++ b/f\n@@ -1,2 +1,2 @@\n-a\n+A\n b\n@@ -6,2 +6,2 @@\n f\n-g\n+G\n",
+		},
+		{
+			name: "merged hunks",
+			a:    "a\nb\nc\nd\n", b: "A\nb\nc\nD\n", context: 1,
+			want: "--- a/f\n+++ b/f\n@@ -1,4 +1,4 @@\n-a\n+A\n b\n c\n-d\n+D\n",
+		},
+		{
+			name: "missing trailing newline",
+			a:    "a\nb", b: "a\nb\n", context: 3,
+			want: "--- a/f\n+++ b/f\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Unified("a/f", "b/f", Lines([]byte(tt.a)), Lines([]byte(tt.b)), tt.context)
+			if got != tt.want {
+				t.Errorf("Unified:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStat(t *testing.T) {
+	added, removed := Stat(lines("abcd"), lines("axcdef"))
+	if added != 3 || removed != 1 {
+		t.Errorf("Stat = +%d -%d, want +3 -1", added, removed)
+	}
+	if added, removed := Stat(lines("ab"), lines("ab")); added != 0 || removed != 0 {
+		t.Errorf("Stat of equal lines = +%d -%d", added, removed)
+	}
+}
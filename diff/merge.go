@@ -0,0 +1,110 @@
+package diff
+
+import "strings"
+
+// Labels name the two sides of a merge in conflict markers.
+type Labels struct {
+	Ours   string
+	Theirs string
+}
+
+// Merge3 combines the changes ours and theirs each made to base. Changes
+// touching different lines are both applied; overlapping changes that differ
+// are kept side by side between conflict markers. It returns the merged
+// lines and the number of conflicts.
+func Merge3(base, ours, theirs []string, labels Labels) ([]string, int) {
+	type side struct {
+		lines   []string
+		changes []Change
+	}
+	sides := [2]side{
+		{ours, Changes(base, ours)},
+		{theirs, Changes(base, theirs)},
+	}
+
+	var out []string
+	conflicts := 0
+	pos := 0
+	next := [2]int{}
+	for next[0] < len(sides[0].changes) || next[1] < len(sides[1].changes) {
+		// Start a region with the earliest pending change, then grow it with
+		// every change from either side overlapping or touching it.
+		first := 0
+		if next[0] == len(sides[0].changes) ||
+			(next[1] < len(sides[1].changes) && sides[1].changes[next[1]].A0 < sides[0].changes[next[0]].A0) {
+			first = 1
+		}
+		lo := sides[first].changes[next[first]].A0
+		hi := sides[first].changes[next[first]].A1
+		start := next
+		next[first]++
+		for grown := true; grown; {
+			grown = false
+			for s := range sides {
+				if next[s] < len(sides[s].changes) && sides[s].changes[next[s]].A0 <= hi {
+					hi = max(hi, sides[s].changes[next[s]].A1)
+					next[s]++
+					grown = true
+				}
+			}
+		}
+
+		out = append(out, base[pos:lo]...)
+		region := [2][]string{}
+		for s := range sides {
+			region[s] = apply(base, lo, hi, sides[s].lines, sides[s].changes[start[s]:next[s]])
+		}
+		switch {
+		case start[1] == next[1]:
+			out = append(out, region[0]...)
+		case start[0] == next[0]:
+			out = append(out, region[1]...)
+		case equal(region[0], region[1]):
+			out = append(out, region[0]...)
+		default:
+			conflicts++
+			out = append(out, "<<<<<<< "+labels.Ours+"\n")
+			out = appendTerminated(out, region[0])
+			out = append(out, "=======\n")
+			out = appendTerminated(out, region[1])
+			out = append(out, ">>>>>>> "+labels.Theirs+"\n")
+		}
+		pos = hi
+	}
+	return append(out, base[pos:]...), conflicts
+}
+
+// apply returns what base[lo:hi] became on one side given its changes
+// within that range.
+func apply(base []string, lo, hi int, lines []string, changes []Change) []string {
+	var out []string
+	pos := lo
+	for _, c := range changes {
+		out = append(out, base[pos:c.A0]...)
+		out = append(out, lines[c.B0:c.B1]...)
+		pos = c.A1
+	}
+	return append(out, base[pos:hi]...)
+}
+
+// appendTerminated appends lines, making sure the last ends in a newline so
+// the marker after it starts a line of its own.
+func appendTerminated(out, lines []string) []string {
+	out = append(out, lines...)
+	if n := len(out); n > 0 && !strings.HasSuffix(out[n-1], "\n") {
+		out[n-1] += "\n"
+	}
+	return out
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,110 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMerge3(t *testing.T) {
+	labels := Labels{Ours: "project", Theirs: "template 1.1.0"}
+	tests := []struct {
+		name               string
+		base, ours, theirs string
+		want               string
+		conflicts          int
+	}{
+		{
+			name: "identical",
+			base: "a\nb\n", ours: "a\nb\n", theirs: "a\nb\n",
+			want: "a\nb\n",
+		},
+		{
+			name: "only ours",
+			base: "a\nb\nc\n", ours: "a\nB\nc\n", theirs: "a\nb\nc\n",
+			want: "a\nB\nc\n",
+		},
+		{
+			name: "only theirs",
+			base: "a\nb\nc\n", ours: "a\nb\nc\n", theirs: "a\nb\nC\n",
+			want: "a\nb\nC\n",
+		},
+		{
+			name: "different lines",
+			base: "a\nb\nc\nd\ne\n", ours: "A\nb\nc\nd\ne\n", theirs: "a\nb\nc\nd\nE\n",
+			want: "A\nb\nc\nd\nE\n",
+		},
+		{
+			name: "same edit on both sides",
+			base: "a\nb\nc\n", ours: "a\nX\nc\n", theirs: "a\nX\nc\n",
+			want: "a\nX\nc\n",
+		},
+		{
+			name: "empty base",
+			base: "", ours: "", theirs: "a\nb\n",
+			want: "a\nb\n",
+		},
+		{
+			name: "both add to empty base",
+			base: "", ours: "a\n", theirs: "b\n",
+			want:      "<<<<<<< project\na\n=======\nb\n>>>>>>> template 1.1.0\n",
+			conflicts: 1,
+		},
+		{
+			name: "insert at start and end",
+			base: "b\nc\n", ours: "a\nb\nc\n", theirs: "b\nc\nd\n",
+			want: "a\nb\nc\nd\n",
+		},
+		{
+			name: "delete at start and end",
+			base: "a\nb\nc\nd\n", ours: "b\nc\nd\n", theirs: "a\nb\nc\n",
+			want: "b\nc\n",
+		},
+		{
+			name: "conflict",
+			base: "a\nb\nc\n", ours: "a\nours\nc\n", theirs: "a\ntheirs\nc\n",
+			want:      "a\n<<<<<<< project\nours\n=======\ntheirs\n>>>>>>> template 1.1.0\nc\n",
+			conflicts: 1,
+		},
+		{
+			name: "overlapping hunks",
+			base: "a\nb\nc\nd\ne\n", ours: "a\nB\nC\nd\ne\n", theirs: "a\nb\nX\nD\ne\n",
+			want:      "a\n<<<<<<< project\nB\nC\nd\n=======\nb\nX\nD\n>>>>>>> template 1.1.0\ne\n",
+			conflicts: 1,
+		},
+		{
+			name: "deleted on one side, edited on the other",
+			base: "a\nb\nc\n", ours: "a\nc\n", theirs: "a\nB\nc\n",
+			want:      "a\n<<<<<<< project\n=======\nB\n>>>>>>> template 1.1.0\nc\n",
+			conflicts: 1,
+		},
+		{
+			name: "two conflicts",
+			base: "a\nb\nc\nd\ne\n", ours: "A1\nb\nc\nd\nE1\n", theirs: "A2\nb\nc\nd\nE2\n",
+			want: "<<<<<<< project\nA1\n=======\nA2\n>>>>>>> template 1.1.0\nb\nc\nd\n" +
+				"<<<<<<< project\nE1\n=======\nE2\n>>>>>>> template 1.1.0\n",
+			conflicts: 2,
+		},
+		{
+			name: "missing trailing newline",
+			base: "a\nb", ours: "a\nb", theirs: "x\nb",
+			want: "x\nb",
+		},
+		{
+			name: "conflict without trailing newline",
+			base: "a\nb", ours: "a\nours", theirs: "a\ntheirs",
+			want:      "a\n<<<<<<< project\nours\n=======\ntheirs\n>>>>>>> template 1.1.0\n",
+			conflicts: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, conflicts := Merge3(Lines([]byte(tt.base)), Lines([]byte(tt.ours)), Lines([]byte(tt.theirs)), labels)
+			if got := strings.Join(merged, ""); got != tt.want {
+				t.Errorf("Merge3:\n%s\nwant:\n%s", got, tt.want)
+			}
+			if conflicts != tt.conflicts {
+				t.Errorf("Merge3 reports %d conflicts, want %d", conflicts, tt.conflicts)
+			}
+		})
+	}
+}
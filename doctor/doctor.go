@@ -0,0 +1,167 @@
+// Package doctor checks that the tools a template needs are installed and
+// that a generated project is in working order.
+//
+// Checks never change anything. Each finding says what is wrong and, where
+// it can, the command or edit that fixes it.
+package doctor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go/build"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/mod/semver"
+
+	"github.com/CeoFred/nturu/manifest"
+)
+
+// Status grades a finding.
+type Status int
+
+const (
+	OK Status = iota
+	// Warning is a problem that does not stop a project from building, or a
+	// missing optional tool.
+	Warning
+	// Failure is a missing required tool or a broken project.
+	Failure
+)
+
+func (s Status) String() string {
+	switch s {
+	case OK:
+		return "ok"
+	case Warning:
+		return "warning"
+	}
+	return "failure"
+}
+
+// Finding is the outcome of one check.
+type Finding struct {
+	// Check names what was checked, such as a tool or a file.
+	Check  string
+	Status Status
+	Detail string
+	// Fix is what to do about a warning or failure, when known.
+	Fix string
+}
+
+// versionTimeout bounds how long a tool may take to print its version.
+const versionTimeout = 10 * time.Second
+
+// Tools checks that every tool enabled with features is on the PATH and
+// recent enough.
+func Tools(ctx context.Context, tools []manifest.Tool, features map[string]bool) []Finding {
+	var findings []Finding
+	for _, t := range tools {
+		if t.Enabled(features) {
+			findings = append(findings, checkTool(ctx, t))
+		}
+	}
+	return findings
+}
+
+func checkTool(ctx context.Context, t manifest.Tool) Finding {
+	f := Finding{Check: t.Name}
+	missing := Failure
+	if t.Optional {
+		missing = Warning
+	}
+
+	path, err := exec.LookPath(t.Name)
+	if err != nil {
+		f.Status, f.Detail = missing, "not found on the PATH"
+		// go install puts tools in $GOPATH/bin, which is often not on the
+		// PATH of a fresh setup.
+		bin := filepath.Join(build.Default.GOPATH, "bin")
+		if _, err := exec.LookPath(filepath.Join(bin, t.Name)); err == nil {
+			f.Detail = "installed in " + bin + ", which is not on the PATH"
+			f.Fix = `export PATH="$PATH:` + bin + `"`
+			return f
+		}
+		f.Fix = installHint(t)
+		return f
+	}
+
+	f.Detail = path
+	if t.Version == "" {
+		return f
+	}
+	ctx, cancel := context.WithTimeout(ctx, versionTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, path, t.VersionArgs()...)
+	cmd.Env = localToolchain
+	out, err := cmd.CombinedOutput()
+	have := Version(string(out))
+	if have == "" {
+		if err == nil {
+			err = errors.New("no version in its output")
+		}
+		f.Status = Warning
+		f.Detail = fmt.Sprintf("%s: cannot tell the version (%v); need %s or newer", path, err, t.Version)
+		return f
+	}
+	f.Detail = fmt.Sprintf("%s %s", path, have)
+	if Older(have, t.Version) {
+		f.Status = missing
+		f.Detail = fmt.Sprintf("%s is version %s; need %s or newer", path, have, t.Version)
+		f.Fix = installHint(t)
+	}
+	return f
+}
+
+func installHint(t manifest.Tool) string {
+	hint := "install " + t.Name
+	if t.Version != "" {
+		hint += " " + t.Version + " or newer"
+	}
+	if t.Install != "" {
+		hint += ": " + t.Install
+	}
+	return hint
+}
+
+// versionNumber finds the first dotted version number in a tool's output,
+// such as 1.21.2 in "go version go1.21.2 linux/amd64".
+var versionNumber = regexp.MustCompile(`\d+(\.\d+){1,2}`)
+
+// Version extracts the version a tool printed, or "" when it printed none.
+func Version(output string) string {
+	return versionNumber.FindString(output)
+}
+
+// Older reports whether the dotted version have is older than want.
+func Older(have, want string) bool {
+	return semver.Compare("v"+have, "v"+want) < 0
+}
+
+// localToolchain keeps the go command from switching to the toolchain a
+// go.mod in the working directory asks for, so it reports what is installed.
+var localToolchain = append(os.Environ(), "GOTOOLCHAIN=local")
+
+// goVersion returns the version of the go command on the PATH, or "".
+func goVersion(ctx context.Context) string {
+	ctx, cancel := context.WithTimeout(ctx, versionTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "go", "env", "GOVERSION")
+	cmd.Env = localToolchain
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	return Version(strings.TrimSpace(string(out)))
+}
+
+// exists reports whether name is there, whatever it is.
+func exists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
@@ -0,0 +1,66 @@
+package doctor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVersion(t *testing.T) {
+	for output, want := range map[string]string{
+		"go version go1.21.2 linux/amd64":      "1.21.2",
+		"libprotoc 3.21.12":                    "3.21.12",
+		"swag version v1.16.2":                 "1.16.2",
+		"Docker version 24.0.7, build afdd53b": "24.0.7",
+		"air: unknown flag":                    "",
+	} {
+		if got := Version(output); got != want {
+			t.Errorf("Version(%q) = %q, want %q", output, got, want)
+		}
+	}
+
+	if !Older("1.19.13", "1.21") || Older("1.21.0", "1.21") || Older("1.22", "1.21.5") {
+		t.Error("Older compares versions wrongly")
+	}
+}
+
+func TestProject(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		t.Helper()
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(".env.example", "# database\nDB_HOST=localhost\nexport DB_PORT=5432\n")
+	write(".env", "DB_HOST=db\n")
+	write("go.mod", "module example.com/orders\n\ngo 1.19\n")
+	write("main.go", "package main\n\nimport _ \"github.com/nturu/microservice-template/database\"\n")
+	write("vendor/x/x.go", "package x\n\nimport _ \"github.com/nturu/microservice-template/database\"\n")
+
+	p := &Project{Dir: dir, Module: "example.com/other", TemplateModules: []string{"github.com/nturu/microservice-template"}}
+	findings, err := p.Check(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]Finding{}
+	for _, f := range findings {
+		got[f.Check] = f
+	}
+
+	if f := got[".env"]; f.Status != Warning || f.Detail != "does not set DB_PORT" {
+		t.Errorf(".env finding = %+v", f)
+	}
+	if f := got["go.mod"]; f.Status != Warning || !strings.Contains(f.Detail, "example.com/other") {
+		t.Errorf("go.mod finding = %+v", f)
+	}
+	if f := got["imports"]; f.Status != Failure || !strings.HasSuffix(f.Detail, "imported by main.go") {
+		t.Errorf("imports finding = %+v", f)
+	}
+}
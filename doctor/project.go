@@ -0,0 +1,270 @@
+package doctor
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+
+	"github.com/CeoFred/nturu/modpath"
+)
+
+// Project describes the project a Check looks at.
+type Project struct {
+	Dir string
+	// Module is the module path the project should have, such as the one
+	// recorded in its lock; empty skips the comparison.
+	Module string
+	// TemplateModules are module paths of the templates the project may
+	// come from. Imports of them are leftovers of a botched rename.
+	TemplateModules []string
+}
+
+// Check runs every project check.
+func (p *Project) Check(ctx context.Context) ([]Finding, error) {
+	var findings []Finding
+	env, err := p.checkEnv()
+	if err != nil {
+		return nil, err
+	}
+	findings = append(findings, env...)
+
+	mods, err := p.checkGoMod(ctx)
+	if err != nil {
+		return nil, err
+	}
+	findings = append(findings, mods...)
+
+	imports, err := p.checkImports()
+	if err != nil {
+		return nil, err
+	}
+	return append(findings, imports...), nil
+}
+
+// checkEnv compares .env with .env.example: every variable the example
+// declares should be set.
+func (p *Project) checkEnv() ([]Finding, error) {
+	example := filepath.Join(p.Dir, ".env.example")
+	if !exists(example) {
+		return nil, nil
+	}
+	want, err := envKeys(example)
+	if err != nil {
+		return nil, err
+	}
+	env := filepath.Join(p.Dir, ".env")
+	if !exists(env) {
+		return []Finding{{Check: ".env", Status: Warning, Detail: "missing", Fix: "cp .env.example .env and fill in the values"}}, nil
+	}
+	have, err := envKeys(env)
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	for _, key := range want {
+		if !contains(have, key) {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) == 0 {
+		return []Finding{{Check: ".env", Detail: "sets every variable in .env.example"}}, nil
+	}
+	return []Finding{{
+		Check:  ".env",
+		Status: Warning,
+		Detail: "does not set " + list(missing, 5),
+		Fix:    "copy the missing variables from .env.example into .env",
+	}}, nil
+}
+
+// envKeys lists the variables a dotenv file assigns, in order.
+func envKeys(name string) ([]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var keys []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		if key, _, ok := strings.Cut(line, "="); ok {
+			keys = append(keys, strings.TrimSpace(key))
+		}
+	}
+	return keys, s.Err()
+}
+
+// checkGoMod checks every go.mod in the project: it parses, declares a
+// valid module path, needs no newer Go than installed, and has a go.sum for
+// its requirements. The outermost one should declare the expected module.
+func (p *Project) checkGoMod(ctx context.Context) ([]Finding, error) {
+	var mods []string
+	err := p.walkGo(func(rel string) {
+		if path.Base(rel) == "go.mod" {
+			mods = append(mods, rel)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(mods) == 0 {
+		return []Finding{{Check: "go.mod", Status: Warning, Detail: "no go.mod in the project", Fix: "go mod init <module path>"}}, nil
+	}
+	// Outermost first.
+	sort.SliceStable(mods, func(i, j int) bool {
+		return strings.Count(mods[i], "/") < strings.Count(mods[j], "/")
+	})
+
+	installed := goVersion(ctx)
+	var findings []Finding
+	for i, rel := range mods {
+		data, err := os.ReadFile(filepath.Join(p.Dir, filepath.FromSlash(rel)))
+		if err != nil {
+			return nil, err
+		}
+		f, err := modfile.Parse(rel, data, nil)
+		if err != nil {
+			findings = append(findings, Finding{Check: rel, Status: Failure, Detail: err.Error(), Fix: "fix the syntax error, then run go mod tidy"})
+			continue
+		}
+
+		module := ""
+		if f.Module != nil {
+			module = f.Module.Mod.Path
+		}
+		finding := Finding{Check: rel, Detail: "module " + module}
+		switch {
+		case module == "":
+			finding.Status = Failure
+			finding.Detail = "declares no module"
+			finding.Fix = "add a module directive: module <path>"
+		case modpath.Check(module) != nil:
+			finding.Status = Failure
+			finding.Detail = modpath.Check(module).Error()
+			finding.Fix = "nturu rename-module <valid path>"
+		case i == 0 && p.Module != "" && module != p.Module:
+			finding.Status = Warning
+			finding.Detail = fmt.Sprintf("declares module %s, but the project was generated as %s", module, p.Module)
+			// rename-module records the new path; a hand edit does not.
+			finding.Fix = "nturu rename-module " + p.Module + " moves it back; move projects with rename-module so the lock follows"
+		case f.Go != nil && installed != "" && Older(installed, f.Go.Version):
+			finding.Status = Failure
+			finding.Detail = fmt.Sprintf("needs Go %s, but go is version %s", f.Go.Version, installed)
+			finding.Fix = "install Go " + f.Go.Version + " or newer: https://go.dev/dl/"
+		case len(f.Require) > 0 && !exists(filepath.Join(p.Dir, filepath.FromSlash(path.Dir(rel)), "go.sum")):
+			finding.Status = Warning
+			finding.Detail = "requires modules but has no go.sum"
+			finding.Fix = "go mod tidy"
+		}
+		findings = append(findings, finding)
+	}
+	return findings, nil
+}
+
+// checkImports finds Go files still importing a template's own module,
+// which does not exist outside the template.
+func (p *Project) checkImports() ([]Finding, error) {
+	var findings []Finding
+	for _, module := range p.TemplateModules {
+		if module == "" || module == p.Module {
+			continue
+		}
+		var files []string
+		err := p.walkGo(func(rel string) {
+			if path.Ext(rel) == ".go" && imports(filepath.Join(p.Dir, filepath.FromSlash(rel)), module) {
+				files = append(files, rel)
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(files) == 0 {
+			continue
+		}
+		detail := fmt.Sprintf("%s imported by %s", module, list(files, 5))
+		fix := "import the project's own packages instead"
+		if p.Module != "" {
+			fix = fmt.Sprintf("import %s/... instead of %s/...", p.Module, module)
+		}
+		findings = append(findings, Finding{Check: "imports", Status: Failure, Detail: detail, Fix: fix})
+	}
+	return findings, nil
+}
+
+// imports reports whether the Go file at name imports a package of module.
+// Files that do not parse are left to the compiler.
+func imports(name, module string) bool {
+	f, err := parser.ParseFile(token.NewFileSet(), name, nil, parser.ImportsOnly)
+	if err != nil {
+		return false
+	}
+	for _, spec := range f.Imports {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		if _, ok := modpath.Move(path, module, module); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// walkGo calls visit with the slash-separated path of every file the go
+// command would look at: hidden, vendor and testdata directories are
+// skipped.
+func (p *Project) walkGo(visit func(rel string)) error {
+	return filepath.WalkDir(p.Dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			base := d.Name()
+			if name != p.Dir && (strings.HasPrefix(base, ".") || strings.HasPrefix(base, "_") || base == "vendor" || base == "testdata") {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(p.Dir, name)
+		if err != nil {
+			return err
+		}
+		visit(filepath.ToSlash(rel))
+		return nil
+	})
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// list joins the first n items, counting the rest.
+func list(items []string, n int) string {
+	if len(items) <= n {
+		return strings.Join(items, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(items[:n], ", "), len(items)-n)
+}
@@ -0,0 +1,369 @@
+// Package generator writes a new project from a template.
+//
+// Template files are copied into the project, with .tmpl files rendered and
+// the template's module path moved to the answer in go.mod files and Go
+// imports. Files matching the patterns in the template's IgnoreFile are never
+// copied; files matching the manifest's verbatim patterns, and files that
+// look binary, are copied byte for byte.
+package generator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go/format"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/CeoFred/nturu/archive"
+	"github.com/CeoFred/nturu/diff"
+	"github.com/CeoFred/nturu/glob"
+	"github.com/CeoFred/nturu/lock"
+	"github.com/CeoFred/nturu/manifest"
+	"github.com/CeoFred/nturu/modpath"
+	"github.com/CeoFred/nturu/render"
+)
+
+// IgnoreFile at the root of a template lists, one glob pattern per line,
+// files that are never copied into a project. Blank lines and lines starting
+// with # are ignored.
+const IgnoreFile = ".nturuignore"
+
+type Generator struct {
+	template fs.FS
+	manifest *manifest.Manifest
+	features map[string]bool
+	data     map[string]any
+	renderer *render.Renderer
+	// module replaces manifest.Module in go.mod files and Go imports.
+	module string
+	// workers bounds how many files Generate renders and writes at once.
+	workers int
+}
+
+// New returns a Generator for the template rooted at template, rendering it
+// with the resolved variable values and enabled features.
+func New(template fs.FS, m *manifest.Manifest, values map[string]any, features map[string]bool) *Generator {
+	data := map[string]any{manifest.Features: features}
+	for k, v := range values {
+		data[k] = v
+	}
+
+	left, right := m.Delims()
+	module, _ := values[manifest.ModulePath].(string)
+	return &Generator{
+		template: template,
+		manifest: m,
+		features: features,
+		data:     data,
+		renderer: render.New(data, left, right),
+		module:   module,
+		workers:  runtime.GOMAXPROCS(0),
+	}
+}
+
+// File is one file of the generated project.
+type File struct {
+	// Source is the path of the file inside the template.
+	Source string
+	// Path is where the file lands, slash separated and relative to the
+	// project root.
+	Path string
+	// Mode is 0755 for files the template marks executable and 0644 for
+	// the others.
+	Mode fs.FileMode
+	// Sum is the lock.Sum of the generated content, set by Generate.
+	Sum string
+}
+
+// Skipped is a template file or directory left out of the project.
+type Skipped struct {
+	Source string
+	// Path is where the entry would have landed.
+	Path string
+	// Reason says why it was left out.
+	Reason string
+}
+
+// Files lists the files the template produces with the current answers, in
+// template order, without rendering their contents.
+func (g *Generator) Files() ([]File, error) {
+	var files []File
+	err := g.walk(func(f File) {
+		files = append(files, f)
+	}, func(Skipped) {})
+	return files, err
+}
+
+// Skipped lists the template entries left out with the current answers. A
+// skipped directory is listed without its contents.
+func (g *Generator) Skipped() ([]Skipped, error) {
+	var skipped []Skipped
+	err := g.walk(func(File) {}, func(s Skipped) {
+		skipped = append(skipped, s)
+	})
+	return skipped, err
+}
+
+func (g *Generator) walk(file func(File), skip func(Skipped)) error {
+	ignored, err := g.ignored()
+	if err != nil {
+		return err
+	}
+	return fs.WalkDir(g.template, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if name == "." || name == manifest.File || name == IgnoreFile {
+			return nil
+		}
+		// Litter from the archiver is no part of the template, not even a
+		// skipped one.
+		if glob.Any(archive.DefaultExclude, name) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if glob.Any(ignored, name) {
+			skip(Skipped{Source: name, Path: name, Reason: "ignored by " + IgnoreFile})
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if glob.Any(g.manifest.Exclude, name) {
+			skip(Skipped{Source: name, Path: name, Reason: "excluded by " + manifest.File})
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if feature := g.manifest.ExcludedBy(name, g.features); feature != "" {
+			target, err := g.renderer.Path(name)
+			if err != nil {
+				// The path may depend on answers the feature would have asked.
+				target = name
+			}
+			skip(Skipped{Source: name, Path: target, Reason: "feature " + feature + " disabled"})
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		// Directories are created as files land in them, so a directory whose
+		// contents all belong to disabled features is not left behind empty.
+		if d.IsDir() {
+			return nil
+		}
+
+		target, err := g.path(name)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		mode := fs.FileMode(0644)
+		if info.Mode()&0111 != 0 {
+			mode = 0755
+		}
+		file(File{Source: name, Path: target, Mode: mode})
+		return nil
+	})
+}
+
+// ignored reads the patterns in the template's IgnoreFile, if it has one.
+func (g *Generator) ignored() ([]string, error) {
+	data, err := fs.ReadFile(g.template, IgnoreFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var patterns []string
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !glob.Valid(line) {
+			return nil, fmt.Errorf("%s:%d: malformed pattern %q", IgnoreFile, i+1, line)
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns, nil
+}
+
+// verbatim reports whether the template file name is copied without being
+// rendered, because the manifest says so.
+func (g *Generator) verbatim(name string) bool {
+	return glob.Any(g.manifest.Verbatim, name)
+}
+
+// path returns where the template file name lands. Verbatim files keep
+// their name, suffix included; only their directories are rendered.
+func (g *Generator) path(name string) (string, error) {
+	if !g.verbatim(name) {
+		return g.renderer.Path(name)
+	}
+	dir, base := path.Split(name)
+	if dir == "" {
+		return base, nil
+	}
+	dir, err := g.renderer.Path(strings.TrimSuffix(dir, "/"))
+	if err != nil {
+		return "", err
+	}
+	return dir + "/" + base, nil
+}
+
+// Generate writes the project into dst, which must already exist, and
+// returns the files written. Files are rendered and written by a bounded
+// pool of workers, each file in a single write. Generate stops at the first
+// error or when ctx is cancelled, leaving whatever was written in dst.
+func (g *Generator) Generate(ctx context.Context, dst string) ([]File, error) {
+	files, err := g.Files()
+	if err != nil {
+		return nil, err
+	}
+
+	// Directories are made once up front rather than by every file.
+	dirs := map[string]bool{}
+	for _, f := range files {
+		dir := path.Dir(f.Path)
+		if dirs[dir] {
+			continue
+		}
+		dirs[dir] = true
+		if err := os.MkdirAll(filepath.Join(dst, filepath.FromSlash(dir)), 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		once     sync.Once
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	jobs := make(chan int)
+	for n := min(g.workers, len(files)); n > 0; n-- {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if err := g.write(dst, &files[i]); err != nil {
+					once.Do(func() { firstErr = err })
+					cancel()
+				}
+			}
+		}()
+	}
+	for i := range files {
+		if ctx.Err() != nil {
+			break
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// write renders f into dst, whose directories exist, and records its sum.
+func (g *Generator) write(dst string, f *File) error {
+	content, err := g.Render(*f)
+	if err != nil {
+		return err
+	}
+	dest := filepath.Join(dst, filepath.FromSlash(f.Path))
+	if err := os.WriteFile(dest, content, f.Mode); err != nil {
+		return err
+	}
+	f.Sum = lock.Sum(content)
+	return nil
+}
+
+// Render returns the generated contents of f.
+func (g *Generator) Render(f File) ([]byte, error) {
+	content, err := fs.ReadFile(g.template, f.Source)
+	if err != nil {
+		return nil, err
+	}
+	// Images, fonts and the like would be corrupted by rendering.
+	if g.verbatim(f.Source) || isBinary(content) {
+		return content, nil
+	}
+	if render.IsTemplate(f.Source) {
+		content, err = g.renderer.File(f.Source, content)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// Conditional blocks leave blank lines and unsorted imports behind.
+	if render.IsTemplate(f.Source) && path.Ext(f.Path) == ".go" {
+		content, err = format.Source(content)
+		if err != nil {
+			return nil, fmt.Errorf("%s: rendered Go source does not parse: %w", f.Source, err)
+		}
+	}
+	return g.moveModule(f, content)
+}
+
+// moveModule rewrites the template's module path to the ModulePath answer
+// in go.mod files and Go imports.
+func (g *Generator) moveModule(f File, content []byte) ([]byte, error) {
+	from, to := g.manifest.Module, g.module
+	if from == "" || to == "" || from == to {
+		return content, nil
+	}
+	var err error
+	switch {
+	case path.Base(f.Path) == "go.mod":
+		content, err = modpath.GoMod(f.Path, content, from, to)
+	case path.Ext(f.Path) == ".go":
+		content, err = modpath.GoFile(content, from, to)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", f.Source, err)
+	}
+	return content, nil
+}
+
+// isBinary reports whether content looks like binary data: it has a NUL
+// byte or is not UTF-8 in its first 8 KB.
+func isBinary(content []byte) bool {
+	if diff.IsBinary(content) {
+		return true
+	}
+	if len(content) > 8000 {
+		content = content[:8000]
+		// The cut may split the last character; drop what is left of it.
+		for i := len(content) - 1; i >= len(content)-utf8.UTFMax; i-- {
+			if utf8.RuneStart(content[i]) {
+				if !utf8.FullRune(content[i:]) {
+					content = content[:i]
+				}
+				break
+			}
+		}
+	}
+	return !utf8.Valid(content)
+}
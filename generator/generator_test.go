@@ -0,0 +1,371 @@
+package generator
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/CeoFred/nturu/manifest"
+)
+
+// testTemplate returns a template of many small files importing the
+// template's module, a script and whatever extra files are given.
+func testTemplate(extra fstest.MapFS) fstest.MapFS {
+	fsys := fstest.MapFS{
+		manifest.File: {Data: []byte("name: service\nmodule: example.com/template\nvariables:\n  - name: AppName\n  - name: ModulePath\n")},
+		"go.mod":      {Data: []byte("module example.com/template\n\ngo 1.21\n")},
+		"run.sh":      {Data: []byte("#!/bin/sh\n"), Mode: 0755},
+	}
+	for i := 0; i < 50; i++ {
+		fsys[fmt.Sprintf("pkg/p%d/p%d.go.tmpl", i, i)] = &fstest.MapFile{
+			Data: []byte(fmt.Sprintf("package p%d\n\nimport _ \"example.com/template/pkg\"\n\n// {{.AppName}} %d\n", i, i)),
+		}
+	}
+	for name, f := range extra {
+		fsys[name] = f
+	}
+	return fsys
+}
+
+// newGenerator returns a Generator for fsys answering orders and
+// example.com/orders.
+func newGenerator(tb testing.TB, fsys fs.FS) *Generator {
+	tb.Helper()
+	m, err := manifest.Load(fsys)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	values, err := m.Resolve(map[string]string{manifest.AppName: "orders", manifest.ModulePath: "example.com/orders"}, nil)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	features, err := m.SelectFeatures(nil, nil, nil)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return New(fsys, m, values, features)
+}
+
+// readTree returns the contents and modes of every file under dir.
+func readTree(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	tree := map[string]string{}
+	err := filepath.WalkDir(dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, name)
+		tree[filepath.ToSlash(rel)] = fmt.Sprintf("%v %s", info.Mode().Perm(), data)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+func TestGenerateDeterministic(t *testing.T) {
+	fsys := testTemplate(nil)
+	var (
+		first     []File
+		firstTree map[string]string
+	)
+	for _, workers := range []int{1, 4, 64, 1, 4} {
+		g := newGenerator(t, fsys)
+		g.workers = workers
+		dst := t.TempDir()
+		files, err := g.Generate(context.Background(), dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree := readTree(t, dst)
+		if first == nil {
+			first, firstTree = files, tree
+			continue
+		}
+		// Files come back in template order, whichever worker wrote them.
+		if !reflect.DeepEqual(files, first) {
+			t.Errorf("workers=%d: Generate returned %v, want %v", workers, files, first)
+		}
+		if !reflect.DeepEqual(tree, firstTree) {
+			t.Errorf("workers=%d: generated tree differs from the first run", workers)
+		}
+	}
+
+	if len(first) != 52 {
+		t.Fatalf("generated %d files, want 52", len(first))
+	}
+	for _, f := range first {
+		if f.Sum == "" {
+			t.Errorf("%s has no sum", f.Path)
+		}
+	}
+	if got := firstTree["pkg/p7/p7.go"]; !strings.Contains(got, `"example.com/orders/pkg"`) || !strings.Contains(got, "// orders 7") {
+		t.Errorf("pkg/p7/p7.go = %q", got)
+	}
+	if got := firstTree["run.sh"]; !strings.HasPrefix(got, "-rwxr-xr-x ") {
+		t.Errorf("run.sh = %q, want it executable", got)
+	}
+}
+
+func TestGenerateRenderError(t *testing.T) {
+	fsys := testTemplate(fstest.MapFS{
+		"pkg/broken.txt.tmpl": {Data: []byte("fine\n{{template \"missing\"}}\n")},
+	})
+	for _, workers := range []int{1, 8} {
+		g := newGenerator(t, fsys)
+		g.workers = workers
+		files, err := g.Generate(context.Background(), t.TempDir())
+		if err == nil || !strings.HasPrefix(err.Error(), "pkg/broken.txt.tmpl:2:") {
+			t.Errorf("workers=%d: Generate error = %v, want the broken file's", workers, err)
+		}
+		if files != nil {
+			t.Errorf("workers=%d: Generate returned %d files along with its error", workers, len(files))
+		}
+	}
+}
+
+func TestGenerateCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := newGenerator(t, testTemplate(nil)).Generate(ctx, t.TempDir()); err != context.Canceled {
+		t.Errorf("Generate with a cancelled context = %v", err)
+	}
+}
+
+func TestGenerateIgnored(t *testing.T) {
+	fsys := testTemplate(fstest.MapFS{
+		IgnoreFile:             {Data: []byte("# the template's own CI\n\n.github/\n*.orig\n")},
+		".github/workflows/ci": {Data: []byte("on: push\n")},
+		"pkg/p3/p3.go.orig":    {Data: []byte("package p3\n")},
+		"README.md":            {Data: []byte("# orders\n")},
+	})
+	g := newGenerator(t, fsys)
+	dst := t.TempDir()
+	if _, err := g.Generate(context.Background(), dst); err != nil {
+		t.Fatal(err)
+	}
+	tree := readTree(t, dst)
+	for _, name := range []string{IgnoreFile, ".github/workflows/ci", "pkg/p3/p3.go.orig"} {
+		if _, ok := tree[name]; ok {
+			t.Errorf("%s was generated", name)
+		}
+	}
+	if _, ok := tree["README.md"]; !ok {
+		t.Error("README.md was not generated")
+	}
+
+	skipped, err := g.Skipped()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Skipped{
+		{Source: ".github", Path: ".github", Reason: "ignored by " + IgnoreFile},
+		{Source: "pkg/p3/p3.go.orig", Path: "pkg/p3/p3.go.orig", Reason: "ignored by " + IgnoreFile},
+	}
+	if !reflect.DeepEqual(skipped, want) {
+		t.Errorf("Skipped() = %v, want %v", skipped, want)
+	}
+
+	fsys[IgnoreFile] = &fstest.MapFile{Data: []byte("# fine\n[\n")}
+	if _, err := newGenerator(t, fsys).Files(); err == nil || err.Error() != IgnoreFile+`:2: malformed pattern "["` {
+		t.Errorf("Files with a malformed pattern = %v", err)
+	}
+}
+
+func TestGenerateVerbatim(t *testing.T) {
+	files := map[string]string{
+		// A project's own templates keep their delimiters and suffix.
+		"web/templates/index.html.tmpl": "<h1>{{.AppName}}</h1>\n",
+		// Binary files are copied whatever their name.
+		"assets/logo.png":        "\x89PNG\r\n\x1a\n\x00{{.AppName}}",
+		"assets/latin1.txt.tmpl": "caf\xe9 {{.AppName}}\n",
+	}
+	extra := fstest.MapFS{
+		manifest.File:   {Data: []byte("name: service\nmodule: example.com/template\nverbatim: ['web/templates/']\nvariables:\n  - name: AppName\n  - name: ModulePath\n")},
+		"notes.md.tmpl": {Data: []byte("café {{.AppName}}\n")},
+	}
+	for name, content := range files {
+		extra[name] = &fstest.MapFile{Data: []byte(content)}
+	}
+	dst := t.TempDir()
+	if _, err := newGenerator(t, testTemplate(extra)).Generate(context.Background(), dst); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, target := range map[string]string{
+		"web/templates/index.html.tmpl": "web/templates/index.html.tmpl",
+		"assets/logo.png":               "assets/logo.png",
+		"assets/latin1.txt.tmpl":        "assets/latin1.txt",
+	} {
+		got, err := os.ReadFile(filepath.Join(dst, filepath.FromSlash(target)))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if string(got) != files[name] {
+			t.Errorf("%s = %q, want it copied as %q", target, got, files[name])
+		}
+	}
+	if got, err := os.ReadFile(filepath.Join(dst, "notes.md")); err != nil || string(got) != "café orders\n" {
+		t.Errorf("notes.md = %q, %v; want it rendered", got, err)
+	}
+}
+
+func TestIsBinary(t *testing.T) {
+	// An é split by the 8000 byte cut is still text.
+	split := strings.Repeat("a", 7999) + "é" + strings.Repeat("a", 100)
+	for _, tt := range []struct {
+		name    string
+		content string
+		want    bool
+	}{
+		{"empty", "", false},
+		{"ascii", "package main\n", false},
+		{"utf-8", "café ☕\n", false},
+		{"nul", "text\x00text", true},
+		{"invalid utf-8", "caf\xe9\n", true},
+		{"split at the cut", split, false},
+		{"invalid after the cut", split + "\xff", false},
+		{"invalid before the cut", "\xff" + split, true},
+	} {
+		if got := isBinary([]byte(tt.content)); got != tt.want {
+			t.Errorf("isBinary(%s) = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+// fiberZip returns the built-in fiber template archive.
+func fiberZip(b *testing.B) []byte {
+	b.Helper()
+	data, err := os.ReadFile("../cmd/templates/fiber/fiber.zip")
+	if err != nil {
+		b.Fatal(err)
+	}
+	return data
+}
+
+// BenchmarkGenerate runs the built-in fiber template, opened the way the
+// catalog does, straight from the zip bytes.
+func BenchmarkGenerate(b *testing.B) {
+	data := fiberZip(b)
+	for _, workers := range []int{1, 0} {
+		name := "workers=GOMAXPROCS"
+		if workers != 0 {
+			name = fmt.Sprintf("workers=%d", workers)
+		}
+		b.Run(name, func(b *testing.B) {
+			zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				b.Fatal(err)
+			}
+			g := newGenerator(b, zr)
+			if workers != 0 {
+				g.workers = workers
+			}
+			for i := 0; i < b.N; i++ {
+				if _, err := g.Generate(context.Background(), b.TempDir()); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkCopyUnzip generates the fiber template the way nturu used to,
+// for comparison with BenchmarkGenerate: copy the archive into the
+// project, unzip it there, delete it and rewrite the module path in every
+// file.
+func BenchmarkCopyUnzip(b *testing.B) {
+	data := fiberZip(b)
+	for i := 0; i < b.N; i++ {
+		dst := b.TempDir()
+		archive := filepath.Join(dst, "fiber.zip")
+		if err := os.WriteFile(archive, data, os.ModePerm); err != nil {
+			b.Fatal(err)
+		}
+		if err := unzip(archive, dst); err != nil {
+			b.Fatal(err)
+		}
+		if err := os.Remove(archive); err != nil {
+			b.Fatal(err)
+		}
+		if err := replaceInDirectory(dst, "github.com/nturu/microservice-template", "example.com/orders"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// unzip extracts archive into dst as nturu used to.
+func unzip(archive, dst string) error {
+	zr, err := zip.OpenReader(archive)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		target := filepath.Join(dst, f.Name)
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(target, os.ModePerm); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+			return err
+		}
+		if err := extract(f, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func extract(f *zip.File, target string) error {
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	w, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// replaceInDirectory replaces old with new in every file below dir as nturu
+// used to, rewriting each with os.ModePerm.
+func replaceInDirectory(dir, old, new string) error {
+	return filepath.WalkDir(dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		content, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(name, bytes.ReplaceAll(content, []byte(old), []byte(new)), os.ModePerm)
+	})
+}
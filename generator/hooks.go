@@ -0,0 +1,97 @@
+package generator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/CeoFred/nturu/manifest"
+	"github.com/CeoFred/nturu/render"
+)
+
+// Hooks returns the manifest's hooks that apply with the enabled features,
+// in order, with their commands and directories rendered.
+func (g *Generator) Hooks() ([]manifest.Hook, error) {
+	r := render.New(g.data, "", "")
+	var hooks []manifest.Hook
+	for _, h := range g.manifest.Hooks {
+		if !h.Enabled(g.features) {
+			continue
+		}
+		name := manifest.File + ": hook " + h.Name
+		run := make([]string, len(h.Run))
+		for i, arg := range h.Run {
+			out, err := r.File(name, []byte(arg))
+			if err != nil {
+				return nil, err
+			}
+			run[i] = string(out)
+		}
+		h.Run = run
+		if h.Dir != "" {
+			dir, err := r.File(name, []byte(h.Dir))
+			if err != nil {
+				return nil, err
+			}
+			h.Dir = path.Clean(string(dir))
+			if path.IsAbs(h.Dir) || h.Dir == ".." || strings.HasPrefix(h.Dir, "../") {
+				return nil, fmt.Errorf("%s: dir %q is outside the project", name, h.Dir)
+			}
+		}
+		hooks = append(hooks, h)
+	}
+	return hooks, nil
+}
+
+// HookError reports a hook that failed.
+type HookError struct {
+	Hook string
+	// ExitCode is the command's exit status, or -1 when it did not exit on
+	// its own: it could not be started, timed out or was interrupted.
+	ExitCode int
+	Err      error
+}
+
+func (e *HookError) Error() string {
+	if e.ExitCode >= 0 {
+		return fmt.Sprintf("hook %s failed with exit code %d", e.Hook, e.ExitCode)
+	}
+	return fmt.Sprintf("hook %s failed: %v", e.Hook, e.Err)
+}
+
+func (e *HookError) Unwrap() error { return e.Err }
+
+// RunHook runs h, as returned by Hooks, in the project at dir, streaming its
+// output to stdout and stderr.
+func RunHook(ctx context.Context, dir string, h manifest.Hook, stdout, stderr io.Writer) error {
+	timeout, err := h.Duration()
+	if err != nil {
+		return &HookError{Hook: h.Name, ExitCode: -1, Err: err}
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, h.Run[0], h.Run[1:]...)
+	cmd.Dir = filepath.Join(dir, filepath.FromSlash(h.Dir))
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	err = cmd.Run()
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return &HookError{Hook: h.Name, ExitCode: -1, Err: fmt.Errorf("timed out after %s", timeout)}
+	case ctx.Err() != nil:
+		return &HookError{Hook: h.Name, ExitCode: -1, Err: ctx.Err()}
+	}
+	var exit *exec.ExitError
+	if errors.As(err, &exit) && exit.ExitCode() >= 0 {
+		return &HookError{Hook: h.Name, ExitCode: exit.ExitCode(), Err: err}
+	}
+	return &HookError{Hook: h.Name, ExitCode: -1, Err: err}
+}
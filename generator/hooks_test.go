@@ -0,0 +1,68 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/CeoFred/nturu/manifest"
+)
+
+func TestRunHook(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hooks are run with sh and sleep")
+	}
+	for _, name := range []string{"sh", "sleep"} {
+		if _, err := exec.LookPath(name); err != nil {
+			t.Skipf("%s is not installed", name)
+		}
+	}
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "web"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	h := manifest.Hook{Name: "pwd", Run: []string{"sh", "-c", "basename $PWD; echo oops >&2"}, Dir: "web"}
+	if err := RunHook(context.Background(), dir, h, &stdout, &stderr); err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "web\n" || stderr.String() != "oops\n" {
+		t.Errorf("hook wrote %q and %q, want web and oops", stdout.String(), stderr.String())
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, tt := range []struct {
+		name string
+		ctx  context.Context
+		hook manifest.Hook
+		code int
+		msg  string
+	}{
+		{"exit", context.Background(), manifest.Hook{Name: "tidy", Run: []string{"sh", "-c", "exit 3"}}, 3, "hook tidy failed with exit code 3"},
+		{"timeout", context.Background(), manifest.Hook{Name: "slow", Run: []string{"sleep", "10"}, Timeout: "50ms"}, -1, "hook slow failed: timed out after 50ms"},
+		{"cancelled", cancelled, manifest.Hook{Name: "slow", Run: []string{"sleep", "10"}}, -1, "hook slow failed: context canceled"},
+		{"missing", context.Background(), manifest.Hook{Name: "lint", Run: []string{"nturu-no-such-command"}}, -1, ""},
+		{"bad timeout", context.Background(), manifest.Hook{Name: "slow", Run: []string{"true"}, Timeout: "soon"}, -1, ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := RunHook(tt.ctx, dir, tt.hook, &stdout, &stderr)
+			var hookErr *HookError
+			if !errors.As(err, &hookErr) {
+				t.Fatalf("RunHook = %v, want a HookError", err)
+			}
+			if hookErr.Hook != tt.hook.Name || hookErr.ExitCode != tt.code {
+				t.Errorf("HookError is hook %s, exit code %d; want %s, %d", hookErr.Hook, hookErr.ExitCode, tt.hook.Name, tt.code)
+			}
+			if tt.msg != "" && err.Error() != tt.msg {
+				t.Errorf("RunHook = %q, want %q", err, tt.msg)
+			}
+		})
+	}
+}
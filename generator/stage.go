@@ -0,0 +1,143 @@
+package generator
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Stage is a scratch directory next to a project's destination. The project
+// is assembled there and only moved into place once complete, so a failed or
+// interrupted generation never leaves a half-written project behind.
+type Stage struct {
+	// Dir is where the project is assembled. It is on the same file system
+	// as the destination, so moving it is a rename.
+	Dir  string
+	dest string
+}
+
+// NewStage creates a stage for a project to be moved to dest. The parent of
+// dest must exist.
+func NewStage(dest string) (*Stage, error) {
+	dir, err := os.MkdirTemp(filepath.Dir(dest), "."+filepath.Base(dest)+".nturu-")
+	if err != nil {
+		return nil, err
+	}
+	// MkdirTemp is private to the user; the project should not be.
+	if err := os.Chmod(dir, 0755); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return &Stage{Dir: dir, dest: dest}, nil
+}
+
+// Commit moves the staged project to its destination. A missing destination
+// is replaced in a single rename. An existing one, allowed only with
+// overwrite, receives the staged files one by one: files of the same name,
+// and files or directories standing where the stage has the other, are
+// moved aside and removed once every staged file is in place. Should a move
+// fail, the ones already made are undone, so the destination is left as it
+// was; only a crash part way through leaves it half updated.
+//
+// Repository metadata is never merged: a staged .git, such as one a git
+// init hook made, is dropped wherever the destination already has a .git,
+// so an existing repository keeps its config, HEAD and remotes.
+func (s *Stage) Commit(overwrite bool) error {
+	info, err := os.Stat(s.dest)
+	if errors.Is(err, fs.ErrNotExist) {
+		return rename(s.Dir, s.dest)
+	}
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() || !overwrite {
+		return &fs.PathError{Op: "generate", Path: s.dest, Err: fs.ErrExist}
+	}
+
+	// The old files are moved aside next to the stage, on the same file
+	// system, rather than removed, so they can be put back.
+	old := s.Dir + ".old"
+	if err := os.Mkdir(old, 0700); err != nil {
+		return err
+	}
+	defer os.RemoveAll(old)
+
+	var j journal
+	err = filepath.WalkDir(s.Dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(s.Dir, name)
+		if err != nil || rel == "." {
+			return err
+		}
+		target := filepath.Join(s.dest, rel)
+		existing, err := os.Lstat(target)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		if existing != nil && d.Name() == ".git" {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if existing != nil && d.IsDir() && existing.IsDir() {
+			return nil
+		}
+		if existing != nil {
+			aside := filepath.Join(old, rel)
+			if err := os.MkdirAll(filepath.Dir(aside), 0700); err != nil {
+				return err
+			}
+			if err := j.rename(target, aside); err != nil {
+				return err
+			}
+		}
+		if d.IsDir() {
+			return j.mkdir(target)
+		}
+		return j.rename(name, target)
+	})
+	if err != nil {
+		j.undo()
+		return err
+	}
+	return s.Discard()
+}
+
+// rename is os.Rename, replaced in tests to make a move fail.
+var rename = os.Rename
+
+// journal records the changes Commit makes to a destination so they can be
+// undone, last first.
+type journal []func() error
+
+func (j *journal) rename(from, to string) error {
+	if err := rename(from, to); err != nil {
+		return err
+	}
+	*j = append(*j, func() error { return os.Rename(to, from) })
+	return nil
+}
+
+func (j *journal) mkdir(dir string) error {
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return err
+	}
+	*j = append(*j, func() error { return os.Remove(dir) })
+	return nil
+}
+
+func (j journal) undo() {
+	for i := len(j) - 1; i >= 0; i-- {
+		j[i]()
+	}
+}
+
+// Discard removes the stage and everything in it. It is safe to call after
+// Commit.
+func (s *Stage) Discard() error {
+	return os.RemoveAll(s.Dir)
+}
@@ -0,0 +1,180 @@
+package generator
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// stage returns a stage for dest holding files, keyed by slash-separated
+// path.
+func stage(t *testing.T, dest string, files map[string]string) *Stage {
+	t.Helper()
+	s, err := NewStage(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Discard() })
+	writeFiles(t, s.Dir, files)
+	return s
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// contents returns the content of every file under dir, keyed by
+// slash-separated path.
+func contents(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	tree := map[string]string{}
+	err := filepath.WalkDir(dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, name)
+		tree[filepath.ToSlash(rel)] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+// checkClean fails unless dest is the only entry left in its parent.
+func checkClean(t *testing.T, dest string) {
+	t.Helper()
+	entries, err := os.ReadDir(filepath.Dir(dest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if !reflect.DeepEqual(names, []string{filepath.Base(dest)}) {
+		t.Errorf("left next to the destination: %v", names)
+	}
+}
+
+func TestStageCommitNew(t *testing.T) {
+	dest := filepath.Join(t.TempDir(), "orders")
+	files := map[string]string{"main.go": "package main\n", "internal/app/app.go": "package app\n"}
+	s := stage(t, dest, files)
+	if err := s.Commit(false); err != nil {
+		t.Fatal(err)
+	}
+	if got := contents(t, dest); !reflect.DeepEqual(got, files) {
+		t.Errorf("committed %v, want %v", got, files)
+	}
+	info, err := os.Stat(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0755 {
+		t.Errorf("destination mode = %v, want 0755", info.Mode().Perm())
+	}
+	checkClean(t, dest)
+}
+
+func TestStageCommitExisting(t *testing.T) {
+	dest := filepath.Join(t.TempDir(), "orders")
+	writeFiles(t, dest, map[string]string{
+		"main.go":         "package main // old\n",
+		"notes.txt":       "mine\n",
+		"docs/index.md":   "old docs\n",
+		"config/app.yaml": "old config\n",
+		"web":             "a file where the template has a directory\n",
+		".git/HEAD":       "ref: refs/heads/trunk\n",
+	})
+	s := stage(t, dest, map[string]string{
+		"main.go":        "package main\n",
+		"docs/index.md":  "docs\n",
+		"config":         "a file where the project has a directory\n",
+		"web/index.html": "<html>\n",
+		".git/HEAD":      "ref: refs/heads/main\n",
+	})
+
+	if err := s.Commit(false); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("Commit without overwrite = %v, want fs.ErrExist", err)
+	}
+	if err := s.Commit(true); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"main.go":        "package main\n",
+		"notes.txt":      "mine\n",
+		"docs/index.md":  "docs\n",
+		"config":         "a file where the project has a directory\n",
+		"web/index.html": "<html>\n",
+		".git/HEAD":      "ref: refs/heads/trunk\n",
+	}
+	if got := contents(t, dest); !reflect.DeepEqual(got, want) {
+		t.Errorf("committed %v, want %v", got, want)
+	}
+	checkClean(t, dest)
+}
+
+// TestStageCommitUndo makes a move fail part way through Commit, which must
+// leave the destination as it was.
+func TestStageCommitUndo(t *testing.T) {
+	dest := filepath.Join(t.TempDir(), "orders")
+	old := map[string]string{
+		"a.go":     "package a // old\n",
+		"b":        "a file where the template has a directory\n",
+		"mine.txt": "mine\n",
+		"z.go":     "package z // old\n",
+	}
+	writeFiles(t, dest, old)
+	s := stage(t, dest, map[string]string{
+		"a.go":     "package a\n",
+		"b/b.go":   "package b\n",
+		"new/n.go": "package n\n",
+		"z.go":     "package z\n",
+	})
+
+	failing := errors.New("disk full")
+	defer func() { rename = os.Rename }()
+	rename = func(from, to string) error {
+		if to == filepath.Join(dest, "z.go") {
+			return failing
+		}
+		return os.Rename(from, to)
+	}
+	if err := s.Commit(true); err != failing {
+		t.Fatalf("Commit = %v, want %v", err, failing)
+	}
+	if got := contents(t, dest); !reflect.DeepEqual(got, old) {
+		t.Errorf("destination after a failed Commit = %v, want %v", got, old)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "new")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("directory made by a failed Commit is left: %v", err)
+	}
+
+	// Everything is still staged, so a second attempt can succeed.
+	rename = os.Rename
+	if err := s.Commit(true); err != nil {
+		t.Fatal(err)
+	}
+	if got := contents(t, dest)["b/b.go"]; got != "package b\n" {
+		t.Errorf("b/b.go = %q after the second Commit", got)
+	}
+	checkClean(t, dest)
+}
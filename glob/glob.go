@@ -0,0 +1,86 @@
+// Package glob matches slash-separated paths against gitignore-style
+// patterns.
+//
+// Patterns use path.Match syntax per segment, plus:
+//
+//   - "**" matches any number of segments, including none;
+//   - a pattern without a slash matches the base name at any depth;
+//   - a trailing slash matches a directory and everything below it.
+//
+// Lists of patterns apply in order, and a pattern starting with "!"
+// re-includes what earlier ones matched. As with gitignore, nothing below a
+// directory left out can be brought back, since the directory is skipped.
+package glob
+
+import (
+	"path"
+	"strings"
+)
+
+// Match reports whether the slash-separated name matches pattern.
+// Malformed patterns never match.
+func Match(pattern, name string) bool {
+	pattern = strings.TrimPrefix(pattern, "/")
+	name = strings.Trim(name, "/")
+
+	if strings.HasSuffix(pattern, "/") {
+		pattern += "**"
+	} else if !strings.Contains(pattern, "/") {
+		pattern = "**/" + pattern
+	}
+	return match(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+// Any reports whether name is matched by patterns: the last pattern
+// matching it decides, and a negated one clears the match.
+func Any(patterns []string, name string) bool {
+	matched := false
+	for _, p := range patterns {
+		if negated, ok := strings.CutPrefix(p, "!"); ok {
+			if matched && Match(negated, name) {
+				matched = false
+			}
+		} else if !matched && Match(p, name) {
+			matched = true
+		}
+	}
+	return matched
+}
+
+// Valid reports whether every segment of pattern, negated or not, is well
+// formed.
+func Valid(pattern string) bool {
+	pattern = strings.TrimPrefix(pattern, "!")
+	if pattern == "" {
+		return false
+	}
+	for _, segment := range strings.Split(pattern, "/") {
+		if _, err := path.Match(segment, ""); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func match(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			rest := pattern[1:]
+			for i := 0; i <= len(name); i++ {
+				if match(rest, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		ok, err := path.Match(pattern[0], name[0])
+		if err != nil || !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
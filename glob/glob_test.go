@@ -0,0 +1,97 @@
+package glob
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		// A pattern without a slash matches the base name at any depth.
+		{"*.orig", "main.go.orig", true},
+		{"*.orig", "internal/db/db.go.orig", true},
+		{"*.orig", "main.go", false},
+		{".DS_Store", "web/static/.DS_Store", true},
+		// With a slash, it is anchored at the root.
+		{"scripts/release.sh", "scripts/release.sh", true},
+		{"scripts/release.sh", "tools/scripts/release.sh", false},
+		{"/scripts/release.sh", "scripts/release.sh", true},
+		{"cmd/*.go", "cmd/root.go", true},
+		{"cmd/*.go", "cmd/sub/root.go", false},
+		// A trailing slash matches the directory and everything below it.
+		{".github/", ".github", true},
+		{".github/", ".github/workflows/ci.yaml", true},
+		{".github/", "docs/.github", false},
+		{"docs/internal/", "docs/internal/notes.md", true},
+		{"docs/internal/", "docs/public/notes.md", false},
+		// ** matches any number of segments, none included.
+		{"**/testdata/**", "testdata/a.json", true},
+		{"**/testdata/**", "pkg/x/testdata/a.json", true},
+		{"**/testdata/**", "pkg/x/a.json", false},
+		{"a/**/b", "a/b", true},
+		{"a/**/b", "a/x/y/b", true},
+		{"a/**/b", "a/x/y/c", false},
+		{"**", "anything/at/all", true},
+		// Leading and trailing slashes of the name do not matter.
+		{"docs/", "/docs/a.md/", true},
+		// Malformed patterns never match.
+		{"[", "[", false},
+		{"a/[b", "a/[b", false},
+	}
+	for _, tt := range tests {
+		if got := Match(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAny(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		name     string
+		want     bool
+	}{
+		{nil, "main.go", false},
+		{[]string{"*.psd", "docs/"}, "docs/a.md", true},
+		{[]string{"*.psd", "docs/"}, "main.go", false},
+		// A negated pattern re-includes what earlier ones matched.
+		{[]string{"*.md", "!README.md"}, "README.md", false},
+		{[]string{"*.md", "!README.md"}, "docs/a.md", true},
+		{[]string{"*.md", "!README.md"}, "main.go", false},
+		// The last matching pattern decides.
+		{[]string{"*.md", "!README.md", "README.md"}, "README.md", true},
+		{[]string{"!README.md", "*.md"}, "README.md", true},
+		// The file is re-included, but the directory stays matched, so a
+		// walk skipping it never gets to the file.
+		{[]string{"docs/", "!docs/keep.md"}, "docs", true},
+		{[]string{"docs/", "!docs/keep.md"}, "docs/keep.md", false},
+		{[]string{"docs/", "!docs/"}, "docs/keep.md", false},
+	}
+	for _, tt := range tests {
+		if got := Any(tt.patterns, tt.name); got != tt.want {
+			t.Errorf("Any(%q, %q) = %v, want %v", tt.patterns, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    bool
+	}{
+		{"*.go", true},
+		{"**/testdata/", true},
+		{"[a-z]*.txt", true},
+		{"!README.md", true},
+		{"[", false},
+		{"docs/[b", false},
+		{"![", false},
+		{"!", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := Valid(tt.pattern); got != tt.want {
+			t.Errorf("Valid(%q) = %v, want %v", tt.pattern, got, tt.want)
+		}
+	}
+}
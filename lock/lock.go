@@ -0,0 +1,100 @@
+// Package lock reads and writes .nturu.lock, the record `nturu generate`
+// leaves in a project of how it was produced: the template and its version,
+// every answer, the enabled features and a digest of each generated file.
+//
+// Later commands use it to render the same template again and to tell
+// generated content from local edits.
+package lock
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// File is the lockfile name, at the root of a generated project.
+const File = ".nturu.lock"
+
+// CurrentVersion is the lockfile format version written today.
+const CurrentVersion = 1
+
+// Lock holds nothing that changes from one run to the next, such as a
+// time, so generating a project again with the same answers gives the
+// same lockfile.
+type Lock struct {
+	Version int `json:"version"`
+	// Nturu is the version of nturu that generated the project.
+	Nturu    string   `json:"nturu"`
+	Template Template `json:"template"`
+	// Answers holds every variable value, defaults included, in the form
+	// generate accepts them.
+	Answers  map[string]string `json:"answers"`
+	Features []string          `json:"features"`
+	// Files maps the slash-separated path of every generated file to the
+	// Sum of the content generated for it.
+	Files map[string]string `json:"files"`
+}
+
+// Template identifies the template a project was generated from.
+type Template struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	// Source is where the template came from: embedded, local, directory,
+	// git or cached.
+	Source string `json:"source"`
+	// Ref is what generate --template was given to find it again.
+	Ref string `json:"ref"`
+	// Commit is the SHA a git template was checked out at.
+	Commit string `json:"commit,omitempty"`
+	// Digest is "sha256:<hex>" of the archive a cached template came from.
+	Digest string `json:"digest,omitempty"`
+}
+
+// Sum returns the digest recorded for a file with the given content.
+func Sum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// ErrNotFound is returned by Read when the directory holds no lockfile.
+var ErrNotFound = errors.New("no " + File + " found; was the project generated by nturu?")
+
+// Read loads the lockfile at the root of the project in dir.
+func Read(dir string) (*Lock, error) {
+	name := filepath.Join(dir, File)
+	data, err := os.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Lock{}
+	if err := json.Unmarshal(data, l); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if l.Version != CurrentVersion {
+		return nil, fmt.Errorf("%s: unsupported lockfile version %d, want %d", name, l.Version, CurrentVersion)
+	}
+	return l, nil
+}
+
+// Write stores l at the root of the project in dir.
+func Write(dir string, l *Lock) error {
+	l.Version = CurrentVersion
+	if l.Features == nil {
+		// No features is an empty list, not null.
+		l.Features = []string{}
+	}
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, File), append(data, '\n'), 0644)
+}
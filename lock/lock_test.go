@@ -0,0 +1,98 @@
+package lock
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWriteRead(t *testing.T) {
+	dir := t.TempDir()
+	l := &Lock{
+		Nturu: "1.2.0",
+		Template: Template{
+			Name:    "fiber",
+			Version: "1.0.0",
+			Source:  "git",
+			Ref:     "git+https://example.com/templates//fiber@v1.0.0",
+			Commit:  "0123456789abcdef0123456789abcdef01234567",
+		},
+		Answers:  map[string]string{"AppName": "orders", "Port": "3009"},
+		Features: []string{"otp", "swagger"},
+		Files:    map[string]string{"main.go": Sum([]byte("package main\n"))},
+	}
+	if err := Write(dir, l); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Read(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := *l
+	want.Version = CurrentVersion
+	if !reflect.DeepEqual(got, &want) {
+		t.Errorf("Read = %+v, want %+v", got, &want)
+	}
+
+	// Writing the same lock again gives the same bytes.
+	first, err := os.ReadFile(filepath.Join(dir, File))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Write(dir, got); err != nil {
+		t.Fatal(err)
+	}
+	if second, _ := os.ReadFile(filepath.Join(dir, File)); string(second) != string(first) {
+		t.Errorf("second Write gave\n%s\nwant\n%s", second, first)
+	}
+}
+
+func TestWriteNoFeatures(t *testing.T) {
+	dir := t.TempDir()
+	if err := Write(dir, &Lock{Template: Template{Name: "default"}}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, File))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"features": []`) {
+		t.Errorf("lockfile without features:\n%s\nwant \"features\": []", data)
+	}
+	l, err := Read(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Features == nil || len(l.Features) != 0 {
+		t.Errorf("Features = %#v, want an empty list", l.Features)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	if _, err := Read(t.TempDir()); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Read of a directory without a lockfile = %v, want ErrNotFound", err)
+	}
+
+	tests := []struct {
+		name, data, want string
+	}{
+		{"not json", "version: 1\n", "invalid character"},
+		{"old version", `{"version": 0}`, "unsupported lockfile version 0, want 1"},
+		{"new version", `{"version": 2}`, "unsupported lockfile version 2, want 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, File), []byte(tt.data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := Read(dir)
+			if err == nil || !strings.HasPrefix(err.Error(), filepath.Join(dir, File)+": ") || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Read = %v, want an error about %s", err, tt.want)
+			}
+		})
+	}
+}
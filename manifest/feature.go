@@ -0,0 +1,149 @@
+package manifest
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/CeoFred/nturu/glob"
+)
+
+// Features is the render data key holding the enabled features, so templates
+// can write {{if .Features.swagger}}.
+const Features = "Features"
+
+// Feature is an optional part of a template that can be left out.
+type Feature struct {
+	Name        string `yaml:"name" json:"name"`
+	Description string `yaml:"description" json:"description,omitempty"`
+	Default     bool   `yaml:"default" json:"default,omitempty"`
+	// Requires lists features that must be enabled alongside this one.
+	Requires []string `yaml:"requires" json:"requires,omitempty"`
+	// Files are glob patterns of template paths shipped only with the
+	// feature. Code shared with the rest of the template is guarded with
+	// conditional blocks in .tmpl files instead.
+	Files []string `yaml:"files" json:"files,omitempty"`
+}
+
+func (f *Feature) validate(m *Manifest) error {
+	if !identifier.MatchString(f.Name) {
+		return fmt.Errorf("name %q is not a valid identifier", f.Name)
+	}
+	for _, r := range f.Requires {
+		if r == f.Name {
+			return errors.New("requires itself")
+		}
+		if m.Feature(r) == nil {
+			return fmt.Errorf("requires unknown feature %q", r)
+		}
+	}
+	for _, p := range f.Files {
+		if !glob.Valid(p) {
+			return fmt.Errorf("malformed files pattern %q", p)
+		}
+	}
+	return nil
+}
+
+// Feature returns the feature called name, or nil.
+func (m *Manifest) Feature(name string) *Feature {
+	for i := range m.Features {
+		if m.Features[i].Name == name {
+			return &m.Features[i]
+		}
+	}
+	return nil
+}
+
+// FeatureAsker is called for every feature neither enabled nor disabled
+// explicitly.
+type FeatureAsker func(f *Feature) (bool, error)
+
+// SelectFeatures decides which features are enabled. Explicit choices win,
+// then answers from ask, then each feature's default. Features required by
+// an enabled feature are switched on unless they were explicitly disabled,
+// which is an error.
+func (m *Manifest) SelectFeatures(with, without []string, ask FeatureAsker) (map[string]bool, error) {
+	explicit := map[string]bool{}
+	for _, name := range with {
+		if m.Feature(name) == nil {
+			return nil, fmt.Errorf("template %s has no feature %q", m.Name, name)
+		}
+		explicit[name] = true
+	}
+	for _, name := range without {
+		if m.Feature(name) == nil {
+			return nil, fmt.Errorf("template %s has no feature %q", m.Name, name)
+		}
+		if explicit[name] {
+			return nil, fmt.Errorf("feature %q is both enabled and disabled", name)
+		}
+		explicit[name] = false
+	}
+
+	enabled := map[string]bool{}
+	for i := range m.Features {
+		f := &m.Features[i]
+		on, ok := explicit[f.Name]
+		if !ok && ask != nil {
+			var err error
+			on, err = ask(f)
+			if err != nil {
+				return nil, err
+			}
+		} else if !ok {
+			on = f.Default
+		}
+		enabled[f.Name] = on
+	}
+
+	// Requirements can chain, so settle them until nothing changes.
+	for changed := true; changed; {
+		changed = false
+		for _, f := range m.Features {
+			if !enabled[f.Name] {
+				continue
+			}
+			for _, r := range f.Requires {
+				if enabled[r] {
+					continue
+				}
+				if on, ok := explicit[r]; ok && !on {
+					return nil, fmt.Errorf("feature %q requires %q, which is disabled", f.Name, r)
+				}
+				enabled[r] = true
+				changed = true
+			}
+		}
+	}
+	return enabled, nil
+}
+
+// Excluded reports whether the template path name belongs to a feature that
+// is not enabled.
+func (m *Manifest) Excluded(name string, enabled map[string]bool) bool {
+	return m.ExcludedBy(name, enabled) != ""
+}
+
+// ExcludedBy returns the disabled feature owning the template path name, or
+// "" when the path is generated.
+func (m *Manifest) ExcludedBy(name string, enabled map[string]bool) string {
+	for _, f := range m.Features {
+		if !enabled[f.Name] && glob.Any(f.Files, name) {
+			return f.Name
+		}
+	}
+	return ""
+}
+
+// EnabledFeatures lists the names of the enabled features in order.
+func EnabledFeatures(enabled map[string]bool) []string {
+	var names []string
+	for name, on := range enabled {
+		if on {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
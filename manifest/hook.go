@@ -0,0 +1,96 @@
+package manifest
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+// DefaultHookTimeout bounds hooks that do not set a timeout.
+const DefaultHookTimeout = 5 * time.Minute
+
+// Hook is a command run in a newly generated project, such as go mod tidy or
+// git init. Hooks run in declaration order.
+type Hook struct {
+	Name string `yaml:"name" json:"name"`
+	// Run is the command and its arguments. They are rendered with the
+	// answers, always with the default delimiters, and run without a shell.
+	Run []string `yaml:"run" json:"run"`
+	// Dir is the directory to run in, relative to the project root.
+	Dir string `yaml:"dir" json:"dir,omitempty"`
+	// When ties the hook to a feature: its name runs the hook only when the
+	// feature is enabled, "!name" only when it is disabled.
+	When string `yaml:"when" json:"when,omitempty"`
+	// Timeout is a duration such as "30s" or "2m"; DefaultHookTimeout when
+	// empty.
+	Timeout string `yaml:"timeout" json:"timeout,omitempty"`
+	// Optional hooks only warn when they fail, for tools a user may not
+	// have installed.
+	Optional bool `yaml:"optional" json:"optional,omitempty"`
+}
+
+func (h *Hook) validate(m *Manifest) error {
+	if h.Name == "" {
+		return errors.New("name is required")
+	}
+	if len(h.Run) == 0 || h.Run[0] == "" {
+		return errors.New("run must name a command")
+	}
+	if h.Dir != "" {
+		dir := path.Clean(h.Dir)
+		if path.IsAbs(dir) || dir == ".." || strings.HasPrefix(dir, "../") {
+			return fmt.Errorf("dir %q is outside the project", h.Dir)
+		}
+	}
+	if err := checkFeatureCondition(m, h.When); err != nil {
+		return err
+	}
+	if _, err := h.Duration(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Duration returns how long the hook may run.
+func (h *Hook) Duration() (time.Duration, error) {
+	if h.Timeout == "" {
+		return DefaultHookTimeout, nil
+	}
+	d, err := time.ParseDuration(h.Timeout)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("timeout %q is not a positive duration such as 30s or 2m", h.Timeout)
+	}
+	return d, nil
+}
+
+// Enabled reports whether the hook runs with the enabled features.
+func (h *Hook) Enabled(features map[string]bool) bool {
+	return featureCondition(h.When, features)
+}
+
+// featureCondition evaluates the when of a hook or tool: a feature name,
+// "!" and a feature name, or empty for always.
+func featureCondition(when string, features map[string]bool) bool {
+	when = strings.TrimSpace(when)
+	if when == "" {
+		return true
+	}
+	if name, ok := strings.CutPrefix(when, "!"); ok {
+		return !features[name]
+	}
+	return features[when]
+}
+
+// checkFeatureCondition reports a when referring to an undeclared feature.
+func checkFeatureCondition(m *Manifest, when string) error {
+	if when == "" {
+		return nil
+	}
+	name := strings.TrimPrefix(strings.TrimSpace(when), "!")
+	if m.Feature(name) == nil {
+		return fmt.Errorf("when refers to unknown feature %q", name)
+	}
+	return nil
+}
@@ -0,0 +1,278 @@
+// Package manifest describes the template.yaml file shipped at the root of
+// every nturu template.
+//
+// The manifest tells the CLI what a template is and which questions to ask
+// before generating from it:
+//
+//	name: fiber
+//	version: 1.0.0
+//	description: Microservice template using the Fiber framework
+//	module: github.com/nturu/microservice-template
+//	variables:
+//	  - name: AppName
+//	    prompt: What is your application name?
+//	    required: true
+//	    pattern: '^[a-zA-Z][a-zA-Z0-9_-]*$'
+//	  - name: ModulePath
+//	    prompt: What is your preferred module path?
+//	    default: '{{.AppName}}'
+//	features:
+//	  - name: swagger
+//	    description: Swagger UI and generated API docs
+//	    default: true
+//	    files: ['docs/']
+//	exclude: ['scripts/release.sh', '*.orig']
+//	verbatim: ['web/templates/']
+//	hooks:
+//	  - name: tidy
+//	    run: [go, mod, tidy]
+//	    timeout: 2m
+package manifest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/CeoFred/nturu/glob"
+)
+
+// File is the name of the manifest at the root of a template.
+const File = "template.yaml"
+
+// Well-known variables every template declares. AppName names the output
+// directory and ModulePath replaces the template's own module path.
+const (
+	AppName    = "AppName"
+	ModulePath = "ModulePath"
+)
+
+type Manifest struct {
+	Name        string `yaml:"name"`
+	Version     string `yaml:"version"`
+	Description string `yaml:"description"`
+	// Module is the Go module path the template is written against. It is
+	// rewritten to the ModulePath answer in generated projects.
+	Module string `yaml:"module"`
+	// Delimiters replace "{{" and "}}" when rendering the template's files,
+	// for templates whose sources use Go template actions themselves.
+	Delimiters []string   `yaml:"delimiters"`
+	Variables  []Variable `yaml:"variables"`
+	Features   []Feature  `yaml:"features"`
+	// Exclude holds glob patterns of template files that are never
+	// generated, such as the template's own CI configuration.
+	Exclude []string `yaml:"exclude"`
+	// Verbatim holds glob patterns of template files copied byte for byte:
+	// neither rendered nor rewritten, and keeping a .tmpl suffix.
+	Verbatim []string `yaml:"verbatim"`
+	Hooks    []Hook   `yaml:"hooks"`
+	// Tools lists the programs generated projects need, for nturu doctor.
+	Tools []Tool `yaml:"tools"`
+}
+
+// Load reads and validates the manifest at the root of a template.
+func Load(fsys fs.FS) (*Manifest, error) {
+	data, err := fs.ReadFile(fsys, File)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse decodes and validates a manifest. Unknown keys are rejected so typos
+// surface when the template is authored rather than when it is used.
+func Parse(data []byte) (*Manifest, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+
+	m := &Manifest{}
+	if err := dec.Decode(m); err != nil {
+		return nil, fmt.Errorf("%s: %w", File, err)
+	}
+	if err := m.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", File, err)
+	}
+	return m, nil
+}
+
+// Validate checks the manifest is self-consistent: variables are well typed
+// and only depend on variables declared before them.
+func (m *Manifest) Validate() error {
+	var errs []error
+	if m.Name == "" {
+		errs = append(errs, errors.New("name is required"))
+	}
+	if len(m.Delimiters) != 0 && (len(m.Delimiters) != 2 || m.Delimiters[0] == "" || m.Delimiters[1] == "") {
+		errs = append(errs, errors.New("delimiters must be a left and a right delimiter"))
+	}
+
+	declared := map[string]bool{}
+	flags := map[string]string{}
+	for i := range m.Variables {
+		v := &m.Variables[i]
+		if err := v.validate(declared); err != nil {
+			errs = append(errs, fmt.Errorf("variable %s: %w", v.Name, err))
+		}
+		if other, ok := flags[v.FlagName()]; ok {
+			errs = append(errs, fmt.Errorf("variable %s: flag --%s already used by %s", v.Name, v.FlagName(), other))
+		}
+		flags[v.FlagName()] = v.Name
+		declared[v.Name] = true
+	}
+	if !declared[AppName] {
+		errs = append(errs, fmt.Errorf("variable %s must be declared", AppName))
+	}
+	if declared[Features] {
+		errs = append(errs, fmt.Errorf("variable %s is reserved for feature toggles", Features))
+	}
+
+	for _, p := range m.Exclude {
+		if !glob.Valid(p) {
+			errs = append(errs, fmt.Errorf("malformed exclude pattern %q", p))
+		}
+	}
+	for _, p := range m.Verbatim {
+		if !glob.Valid(p) {
+			errs = append(errs, fmt.Errorf("malformed verbatim pattern %q", p))
+		}
+	}
+
+	features := map[string]bool{}
+	for i := range m.Features {
+		f := &m.Features[i]
+		if err := f.validate(m); err != nil {
+			errs = append(errs, fmt.Errorf("feature %s: %w", f.Name, err))
+		}
+		if features[f.Name] {
+			errs = append(errs, fmt.Errorf("feature %s: declared twice", f.Name))
+		}
+		features[f.Name] = true
+	}
+	hooks := map[string]bool{}
+	for i := range m.Hooks {
+		h := &m.Hooks[i]
+		if err := h.validate(m); err != nil {
+			errs = append(errs, fmt.Errorf("hook %s: %w", h.Name, err))
+		}
+		if hooks[h.Name] {
+			errs = append(errs, fmt.Errorf("hook %s: declared twice", h.Name))
+		}
+		hooks[h.Name] = true
+	}
+	for i := range m.Tools {
+		t := &m.Tools[i]
+		if err := t.validate(m); err != nil {
+			errs = append(errs, fmt.Errorf("tool %s: %w", t.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Delims returns the left and right delimiters used to render the template,
+// empty when the defaults apply.
+func (m *Manifest) Delims() (left, right string) {
+	if len(m.Delimiters) == 2 {
+		return m.Delimiters[0], m.Delimiters[1]
+	}
+	return "", ""
+}
+
+// Variable returns the variable called name, or nil.
+func (m *Manifest) Variable(name string) *Variable {
+	for i := range m.Variables {
+		if m.Variables[i].Name == name {
+			return &m.Variables[i]
+		}
+	}
+	return nil
+}
+
+// Asker is called for every variable without a supplied answer. def is the
+// rendered default, used when the returned answer is empty.
+type Asker func(v *Variable, def string) (string, error)
+
+// Resolve turns raw answers into typed template values. Variables are
+// visited in declaration order so defaults and conditions can refer to
+// earlier answers. Missing answers are asked for when ask is non-nil and
+// otherwise fall back to the default.
+func (m *Manifest) Resolve(answers map[string]string, ask Asker) (map[string]any, error) {
+	for name := range answers {
+		if m.Variable(name) == nil {
+			return nil, fmt.Errorf("template %s has no variable %q", m.Name, name)
+		}
+	}
+
+	values := map[string]any{}
+	for i := range m.Variables {
+		v := &m.Variables[i]
+
+		enabled, err := v.enabled(values)
+		if err != nil {
+			return nil, err
+		}
+		if !enabled {
+			values[v.Name] = v.zero()
+			continue
+		}
+
+		def, err := v.defaultValue(values)
+		if err != nil {
+			return nil, err
+		}
+
+		raw, ok := answers[v.Name]
+		if !ok && ask != nil {
+			raw, err = ask(v, def)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if raw == "" {
+			raw = def
+		}
+
+		value, err := v.Convert(raw)
+		if err != nil {
+			return nil, err
+		}
+		values[v.Name] = value
+	}
+	return values, nil
+}
+
+// Answers turns resolved values back into the raw answers Resolve accepts,
+// so a project can be rendered again exactly as it was.
+func (m *Manifest) Answers(values map[string]any) map[string]string {
+	answers := map[string]string{}
+	for _, v := range m.Variables {
+		if value, ok := values[v.Name]; ok {
+			answers[v.Name] = fmt.Sprint(value)
+		}
+	}
+	return answers
+}
+
+func execute(text string, values map[string]any) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+	var buf bytes.Buffer
+	t, err := template.New("").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	if err := t.Execute(&buf, values); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+var shorthand = regexp.MustCompile(`^[A-Za-z0-9]$`)
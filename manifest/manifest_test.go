@@ -0,0 +1,231 @@
+package manifest
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseFlags(t *testing.T) {
+	tests := []struct {
+		name      string
+		variables string
+		want      string
+	}{
+		{
+			name:      "default flag",
+			variables: "  - name: Port\n",
+		},
+		{
+			name:      "flag of generate",
+			variables: "  - name: Force\n",
+			want:      "variable Force: flag --force is a flag of nturu generate",
+		},
+		{
+			name:      "declared flag of generate",
+			variables: "  - name: Destination\n    flag: output\n",
+			want:      "variable Destination: flag --output is a flag of nturu generate",
+		},
+		{
+			name:      "shorthand of generate",
+			variables: "  - name: Tag\n    shorthand: t\n",
+			want:      "variable Tag: shorthand -t is a flag of nturu generate",
+		},
+		{
+			name:      "long shorthand",
+			variables: "  - name: Tag\n    shorthand: tg\n",
+			want:      `variable Tag: shorthand "tg" must be a single letter or digit`,
+		},
+		{
+			name:      "shared flag",
+			variables: "  - name: Port\n  - name: HTTPPort\n    flag: port\n",
+			want:      "variable HTTPPort: flag --port already used by Port",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := "name: mini\nvariables:\n  - name: AppName\n" + tt.variables
+			_, err := Parse([]byte(data))
+			switch {
+			case tt.want == "" && err != nil:
+				t.Fatal(err)
+			case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+				t.Errorf("Parse error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFlagName(t *testing.T) {
+	tests := []struct {
+		v    Variable
+		want string
+	}{
+		{Variable{Name: "Port"}, "port"},
+		{Variable{Name: "HTTPPort"}, "http-port"},
+		{Variable{Name: "DatabaseURL"}, "database-url"},
+		{Variable{Name: "HTTPPort", Flag: "listen"}, "listen"},
+		{Variable{Name: AppName, Flag: "app"}, "name"},
+		{Variable{Name: ModulePath}, "module"},
+	}
+	for _, tt := range tests {
+		if got := tt.v.FlagName(); got != tt.want {
+			t.Errorf("FlagName of %+v = %q, want %q", tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		name string
+		v    Variable
+		raw  string
+		want any
+		err  string
+	}{
+		{name: "string", v: Variable{Name: "Owner", Type: String}, raw: " acme ", want: "acme"},
+		{name: "empty", v: Variable{Name: "Owner", Type: String}, want: ""},
+		{name: "required", v: Variable{Name: "Owner", Type: String, Required: true}, err: "Owner is required: pass --owner"},
+		{name: "int", v: Variable{Name: "Port", Type: Int}, raw: "8080", want: 8080},
+		{name: "empty int", v: Variable{Name: "Port", Type: Int}, want: 0},
+		{name: "bad int", v: Variable{Name: "Port", Type: Int}, raw: "80a", err: `Port: "80a" is not an integer`},
+		{name: "bool", v: Variable{Name: "Docker", Type: Bool}, raw: "true", want: true},
+		{name: "bool yes", v: Variable{Name: "Docker", Type: Bool}, raw: "Yes", want: true},
+		{name: "bool off", v: Variable{Name: "Docker", Type: Bool}, raw: "off", want: false},
+		{name: "bad bool", v: Variable{Name: "Docker", Type: Bool}, raw: "maybe", err: `Docker: "maybe" is not a boolean`},
+		{name: "choice", v: Variable{Name: "Database", Type: Enum, Choices: []string{"postgres", "mysql"}}, raw: "mysql", want: "mysql"},
+		{name: "bad choice", v: Variable{Name: "Database", Type: Enum, Choices: []string{"postgres", "mysql"}}, raw: "mongo", err: `Database: "mongo" is not one of postgres, mysql`},
+		{name: "pattern", v: Variable{Name: "Owner", Type: String, Pattern: "^[a-z]+$"}, raw: "acme", want: "acme"},
+		{name: "pattern mismatch", v: Variable{Name: "Owner", Type: String, Pattern: "^[a-z]+$"}, raw: "Acme", err: `Owner: "Acme" does not match ^[a-z]+$`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.v.Convert(tt.raw)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Errorf("Convert(%q) error = %v, want %q", tt.raw, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Convert(%q) = %#v, want %#v", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	m, err := Parse([]byte(`name: mini
+variables:
+  - name: AppName
+  - name: Port
+    type: int
+    default: "3000"
+  - name: Database
+    type: enum
+    choices: [postgres, mysql, none]
+    default: postgres
+  - name: DatabaseName
+    default: '{{.AppName}}_db'
+    when: Database != none
+  - name: Docker
+    type: bool
+  - name: Registry
+    default: ghcr.io
+    when: Docker
+  - name: LocalOnly
+    type: bool
+    default: "true"
+    when: '!Docker'
+  - name: Replicas
+    type: int
+    default: "2"
+    when: Database == postgres
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		answers map[string]string
+		want    map[string]any
+		err     string
+	}{
+		{
+			name:    "defaults",
+			answers: map[string]string{AppName: "orders"},
+			want: map[string]any{
+				AppName: "orders", "Port": 3000, "Database": "postgres", "DatabaseName": "orders_db",
+				"Docker": false, "Registry": "", "LocalOnly": true, "Replicas": 2,
+			},
+		},
+		{
+			name:    "skipped",
+			answers: map[string]string{AppName: "orders", "Database": "none", "Docker": "yes", "DatabaseName": "ignored"},
+			want: map[string]any{
+				AppName: "orders", "Port": 3000, "Database": "none", "DatabaseName": "",
+				"Docker": true, "Registry": "ghcr.io", "LocalOnly": false, "Replicas": 0,
+			},
+		},
+		{
+			name:    "answers",
+			answers: map[string]string{AppName: "orders", "Port": "8080", "Database": "mysql", "DatabaseName": "shop"},
+			want: map[string]any{
+				AppName: "orders", "Port": 8080, "Database": "mysql", "DatabaseName": "shop",
+				"Docker": false, "Registry": "", "LocalOnly": true, "Replicas": 0,
+			},
+		},
+		{
+			name:    "conversion error",
+			answers: map[string]string{AppName: "orders", "Port": "http"},
+			err:     `Port: "http" is not an integer`,
+		},
+		{
+			name:    "bad choice",
+			answers: map[string]string{AppName: "orders", "Database": "mongo"},
+			err:     `Database: "mongo" is not one of postgres, mysql, none`,
+		},
+		{
+			name:    "unknown variable",
+			answers: map[string]string{AppName: "orders", "Cache": "redis"},
+			err:     `template mini has no variable "Cache"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := m.Resolve(tt.answers, nil)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Errorf("Resolve error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Resolve = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Asked variables are offered their default, and a blank answer takes it.
+	asked := map[string]string{}
+	got, err := m.Resolve(map[string]string{AppName: "orders"}, func(v *Variable, def string) (string, error) {
+		asked[v.Name] = def
+		return "", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if asked["DatabaseName"] != "orders_db" || got["DatabaseName"] != "orders_db" {
+		t.Errorf("asked %v and resolved %v, want DatabaseName defaulting to orders_db", asked, got)
+	}
+	if _, ok := asked["Registry"]; ok {
+		t.Errorf("asked for Registry, which is skipped without Docker")
+	}
+}
@@ -0,0 +1,53 @@
+package manifest
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// versionPattern matches the versions tools are required at.
+var versionPattern = regexp.MustCompile(`^\d+(\.\d+){0,2}$`)
+
+// Tool is a program a generated project needs on the PATH to build, run or
+// regenerate code, checked by nturu doctor.
+type Tool struct {
+	// Name is the executable.
+	Name string `yaml:"name" json:"name"`
+	// Version is the oldest version that works, such as "1.21" or "3.21.0";
+	// empty accepts any.
+	Version string `yaml:"version" json:"version,omitempty"`
+	// Args make the tool print its version; ["--version"] when empty.
+	Args []string `yaml:"args" json:"args,omitempty"`
+	// Install tells users how to get the tool: a command or a URL.
+	Install string `yaml:"install" json:"install,omitempty"`
+	// When ties the tool to a feature, as for hooks.
+	When string `yaml:"when" json:"when,omitempty"`
+	// Optional tools are recommended; doctor only warns when they are
+	// missing.
+	Optional bool `yaml:"optional" json:"optional,omitempty"`
+}
+
+func (t *Tool) validate(m *Manifest) error {
+	if t.Name == "" || strings.ContainsAny(t.Name, `/\`) {
+		return errors.New("name must be the name of an executable")
+	}
+	if t.Version != "" && !versionPattern.MatchString(t.Version) {
+		return fmt.Errorf("version %q is not a version such as 1.21 or 3.21.0", t.Version)
+	}
+	return checkFeatureCondition(m, t.When)
+}
+
+// VersionArgs returns the arguments that make the tool print its version.
+func (t *Tool) VersionArgs() []string {
+	if len(t.Args) == 0 {
+		return []string{"--version"}
+	}
+	return t.Args
+}
+
+// Enabled reports whether the tool is needed with the enabled features.
+func (t *Tool) Enabled(features map[string]bool) bool {
+	return featureCondition(t.When, features)
+}
@@ -0,0 +1,268 @@
+package manifest
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/CeoFred/nturu/render"
+)
+
+// Type is the kind of value a variable holds once resolved.
+type Type string
+
+const (
+	String Type = "string"
+	Bool   Type = "bool"
+	Int    Type = "int"
+	Enum   Type = "enum"
+)
+
+type Variable struct {
+	Name string `yaml:"name" json:"name"`
+	// Type defaults to string.
+	Type Type `yaml:"type" json:"type,omitempty"`
+	// Flag is the generate flag setting the variable. It defaults to the
+	// variable name in kebab case; AppName and ModulePath are always set
+	// with --name and --module.
+	Flag      string `yaml:"flag" json:"flag,omitempty"`
+	Shorthand string `yaml:"shorthand" json:"shorthand,omitempty"`
+	Prompt    string `yaml:"prompt" json:"prompt,omitempty"`
+	Help      string `yaml:"help" json:"help,omitempty"`
+	// Default may refer to earlier variables, e.g. '{{.AppName}}'.
+	Default  string   `yaml:"default" json:"default,omitempty"`
+	Required bool     `yaml:"required" json:"required,omitempty"`
+	Pattern  string   `yaml:"pattern" json:"pattern,omitempty"`
+	Choices  []string `yaml:"choices" json:"choices,omitempty"`
+	// When makes the variable depend on an earlier one. It is either a
+	// variable name (true when that bool is set), its negation with a leading
+	// "!", or a comparison such as "Database == postgres".
+	When string `yaml:"when" json:"when,omitempty"`
+}
+
+// ReservedFlags are the flags of nturu generate itself, which no variable
+// may take, and ReservedShorthands their shorthands.
+var (
+	ReservedFlags = []string{
+		"framework", "template", "name", "module", "offline", "output", "yes", "dry-run",
+		"format", "skip-hooks", "force", "config", "set", "with", "without", "help", "generate",
+	}
+	ReservedShorthands = []string{"f", "t", "n", "m", "o", "y", "c", "h", "g"}
+)
+
+// FlagName is the name of the generate flag setting v.
+func (v *Variable) FlagName() string {
+	switch v.Name {
+	case AppName:
+		return "name"
+	case ModulePath:
+		return "module"
+	}
+	if v.Flag != "" {
+		return v.Flag
+	}
+	return render.Kebab(v.Name)
+}
+
+// Usage is the one-line description used for flags and listings.
+func (v *Variable) Usage() string {
+	if v.Help != "" {
+		return v.Help
+	}
+	if v.Prompt != "" {
+		return v.Prompt
+	}
+	return v.Name
+}
+
+func (v *Variable) validate(declared map[string]bool) error {
+	if !identifier.MatchString(v.Name) {
+		return fmt.Errorf("name %q is not a valid identifier", v.Name)
+	}
+	if declared[v.Name] {
+		return errors.New("declared twice")
+	}
+	if v.Shorthand != "" && !shorthand.MatchString(v.Shorthand) {
+		return fmt.Errorf("shorthand %q must be a single letter or digit", v.Shorthand)
+	}
+	// generate has flags of its own for the well-known variables.
+	if v.Name != AppName && v.Name != ModulePath {
+		if slices.Contains(ReservedFlags, v.FlagName()) {
+			return fmt.Errorf("flag --%s is a flag of nturu generate", v.FlagName())
+		}
+		if slices.Contains(ReservedShorthands, v.Shorthand) {
+			return fmt.Errorf("shorthand -%s is a flag of nturu generate", v.Shorthand)
+		}
+	}
+
+	switch v.Type {
+	case "":
+		v.Type = String
+	case String, Bool, Int:
+	case Enum:
+		if len(v.Choices) == 0 {
+			return errors.New("enum needs choices")
+		}
+	default:
+		return fmt.Errorf("unknown type %q", v.Type)
+	}
+	if v.Type != Enum && len(v.Choices) > 0 {
+		return errors.New("choices are only allowed on enum variables")
+	}
+
+	if v.Pattern != "" {
+		if v.Type != String {
+			return errors.New("pattern is only allowed on string variables")
+		}
+		if _, err := regexp.Compile(v.Pattern); err != nil {
+			return fmt.Errorf("pattern: %w", err)
+		}
+	}
+
+	for _, ref := range references(v.Default) {
+		if !declared[ref] {
+			return fmt.Errorf("default refers to %s, which is not declared before it", ref)
+		}
+	}
+	if v.When != "" {
+		ref, _, _, err := parseWhen(v.When)
+		if err != nil {
+			return err
+		}
+		if !declared[ref] {
+			return fmt.Errorf("when refers to %s, which is not declared before it", ref)
+		}
+	}
+
+	if !strings.Contains(v.Default, "{{") && v.Default != "" {
+		if _, err := v.Convert(v.Default); err != nil {
+			return fmt.Errorf("default: %w", err)
+		}
+	}
+	return nil
+}
+
+// Convert parses and validates a raw answer for v.
+func (v *Variable) Convert(raw string) (any, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		if v.Required {
+			return nil, fmt.Errorf("%s is required: pass --%s", v.Name, v.FlagName())
+		}
+		return v.zero(), nil
+	}
+
+	switch v.Type {
+	case Bool:
+		switch strings.ToLower(raw) {
+		case "y", "yes", "on":
+			return true, nil
+		case "n", "no", "off":
+			return false, nil
+		}
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %q is not a boolean", v.Name, raw)
+		}
+		return b, nil
+	case Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %q is not an integer", v.Name, raw)
+		}
+		return n, nil
+	case Enum:
+		for _, c := range v.Choices {
+			if c == raw {
+				return raw, nil
+			}
+		}
+		return nil, fmt.Errorf("%s: %q is not one of %s", v.Name, raw, strings.Join(v.Choices, ", "))
+	default:
+		if v.Pattern != "" && !regexp.MustCompile(v.Pattern).MatchString(raw) {
+			return nil, fmt.Errorf("%s: %q does not match %s", v.Name, raw, v.Pattern)
+		}
+		return raw, nil
+	}
+}
+
+func (v *Variable) zero() any {
+	switch v.Type {
+	case Bool:
+		return false
+	case Int:
+		return 0
+	default:
+		return ""
+	}
+}
+
+func (v *Variable) defaultValue(values map[string]any) (string, error) {
+	def, err := execute(v.Default, values)
+	if err != nil {
+		return "", fmt.Errorf("variable %s: default: %w", v.Name, err)
+	}
+	return def, nil
+}
+
+func (v *Variable) enabled(values map[string]any) (bool, error) {
+	if v.When == "" {
+		return true, nil
+	}
+	ref, op, want, err := parseWhen(v.When)
+	if err != nil {
+		return false, err
+	}
+	got := fmt.Sprint(values[ref])
+	switch op {
+	case "==":
+		return got == want, nil
+	case "!=":
+		return got != want, nil
+	case "!":
+		return got == "false", nil
+	default:
+		return got == "true", nil
+	}
+}
+
+// parseWhen splits a when expression into the variable it depends on, the
+// operator ("", "!", "==" or "!=") and the compared value.
+func parseWhen(expr string) (ref, op, value string, err error) {
+	expr = strings.TrimSpace(expr)
+	for _, o := range []string{"==", "!="} {
+		if l, r, ok := strings.Cut(expr, o); ok {
+			ref, op, value = strings.TrimSpace(l), o, strings.Trim(strings.TrimSpace(r), `"'`)
+			break
+		}
+	}
+	if op == "" {
+		ref = expr
+		if strings.HasPrefix(ref, "!") {
+			ref, op = strings.TrimSpace(ref[1:]), "!"
+		}
+	}
+	if !identifier.MatchString(ref) {
+		return "", "", "", fmt.Errorf("when %q: expected a variable name", expr)
+	}
+	return ref, op, value, nil
+}
+
+var (
+	action    = regexp.MustCompile(`{{(.*?)}}`)
+	reference = regexp.MustCompile(`\.([A-Za-z_][A-Za-z0-9_]*)`)
+)
+
+// references lists the variables a default template mentions.
+func references(text string) []string {
+	var refs []string
+	for _, a := range action.FindAllStringSubmatch(text, -1) {
+		for _, m := range reference.FindAllStringSubmatch(a[1], -1) {
+			refs = append(refs, m[1])
+		}
+	}
+	return refs
+}
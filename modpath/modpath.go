@@ -0,0 +1,218 @@
+// Package modpath moves Go code from one module path to another.
+//
+// Only Go syntax is touched: the module, require and replace directives of
+// go.mod files and the import paths of Go files. Comments, string literals
+// and prose that merely mention the old path are left alone.
+package modpath
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+)
+
+// Check reports whether path is a valid module path. Paths whose first
+// element is a domain must be fetchable by the go command; local paths such
+// as "orders", which go mod init accepts too, only need to be valid import
+// paths.
+func Check(path string) error {
+	first, _, _ := strings.Cut(path, "/")
+	check := module.CheckImportPath
+	if strings.Contains(first, ".") {
+		check = module.CheckPath
+	}
+	if err := check(path); err != nil {
+		return fmt.Errorf("invalid module path: %w", err)
+	}
+	return nil
+}
+
+// ModulePath returns the module path declared by the go.mod file in data,
+// or "" when it declares none.
+func ModulePath(data []byte) string {
+	return modfile.ModulePath(data)
+}
+
+// Move returns path moved from the module from to the module to, and
+// whether path is in from at all: the module itself or a package below it.
+func Move(path, from, to string) (string, bool) {
+	if path == from {
+		return to, true
+	}
+	if rest, ok := strings.CutPrefix(path, from+"/"); ok {
+		return to + "/" + rest, true
+	}
+	return path, false
+}
+
+// GoMod rewrites the go.mod file in data, named name in errors, from the
+// module from to the module to. The module directive, and requirements and
+// replacements of paths in from, as nested modules have, are moved.
+func GoMod(name string, data []byte, from, to string) ([]byte, error) {
+	f, err := modfile.Parse(name, data, nil)
+	if err != nil {
+		return nil, err
+	}
+	changed := false
+	if f.Module != nil {
+		if moved, ok := Move(f.Module.Mod.Path, from, to); ok {
+			if err := f.AddModuleStmt(moved); err != nil {
+				return nil, err
+			}
+			changed = true
+		}
+	}
+	// Dropping edits the lists, so collect the moves first.
+	var requires []*modfile.Require
+	for _, r := range f.Require {
+		if _, ok := Move(r.Mod.Path, from, to); ok {
+			requires = append(requires, &modfile.Require{Mod: r.Mod, Indirect: r.Indirect})
+		}
+	}
+	var replaces []*modfile.Replace
+	for _, r := range f.Replace {
+		if _, ok := Move(r.Old.Path, from, to); ok {
+			replaces = append(replaces, &modfile.Replace{Old: r.Old, New: r.New})
+		}
+	}
+	for _, r := range requires {
+		moved, _ := Move(r.Mod.Path, from, to)
+		if err := f.DropRequire(r.Mod.Path); err != nil {
+			return nil, err
+		}
+		f.AddNewRequire(moved, r.Mod.Version, r.Indirect)
+		changed = true
+	}
+	for _, r := range replaces {
+		moved, _ := Move(r.Old.Path, from, to)
+		if err := f.DropReplace(r.Old.Path, r.Old.Version); err != nil {
+			return nil, err
+		}
+		if err := f.AddReplace(moved, r.Old.Version, r.New.Path, r.New.Version); err != nil {
+			return nil, err
+		}
+		changed = true
+	}
+	if !changed {
+		return data, nil
+	}
+	f.Cleanup()
+	return modfile.Format(f.Syntax), nil
+}
+
+// GoFile rewrites the imports of packages in the module from in the Go
+// source src to the module to. Only the import paths change, and in gofmt'd
+// sources the imports are sorted again. Source that does not parse is
+// returned as it is: templates may ship broken Go on purpose, as test data.
+func GoFile(src []byte, from, to string) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, parser.ImportsOnly|parser.ParseComments)
+	if err != nil {
+		return src, nil
+	}
+
+	type edit struct {
+		start, end int
+		text       string
+	}
+	var edits []edit
+	for _, spec := range f.Imports {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		moved, ok := Move(path, from, to)
+		if !ok {
+			continue
+		}
+		edits = append(edits, edit{
+			start: fset.Position(spec.Path.Pos()).Offset,
+			end:   fset.Position(spec.Path.End()).Offset,
+			text:  strconv.Quote(moved),
+		})
+	}
+	if len(edits) == 0 {
+		return src, nil
+	}
+
+	// Splicing the literals in place keeps everything else byte for byte.
+	sort.Slice(edits, func(i, j int) bool { return edits[i].start < edits[j].start })
+	var out bytes.Buffer
+	last := 0
+	for _, e := range edits {
+		out.Write(src[last:e.start])
+		out.WriteString(e.text)
+		last = e.end
+	}
+	out.Write(src[last:])
+
+	// Moved imports may sort differently; keep gofmt'd sources gofmt'd.
+	// Printing a file is far slower than parsing its imports, so it is only
+	// done when the moves break the order of a run of imports.
+	if !reordered(fset, f, from, to) {
+		return out.Bytes(), nil
+	}
+	if formatted, err := format.Source(src); err == nil && bytes.Equal(formatted, src) {
+		return format.Source(out.Bytes())
+	}
+	return out.Bytes(), nil
+}
+
+// reordered reports whether gofmt could order the imports of f differently
+// once moved from from to to: a run of imports, which blank lines separate,
+// is sorted by path before the move but not after it. Trailing comments are
+// aligned across a run, so imports carrying one count as reordered too.
+func reordered(fset *token.FileSet, f *ast.File, from, to string) bool {
+	line := func(pos token.Pos) int { return fset.Position(pos).Line }
+	for _, decl := range f.Decls {
+		d, ok := decl.(*ast.GenDecl)
+		if !ok || d.Tok != token.IMPORT {
+			continue
+		}
+		var before, after []string
+		for i, spec := range d.Specs {
+			s := spec.(*ast.ImportSpec)
+			if s.Comment != nil {
+				return true
+			}
+			if i > 0 && line(s.Pos()) > line(d.Specs[i-1].End())+1 {
+				if sorted(before) && !sorted(after) {
+					return true
+				}
+				before, after = before[:0], after[:0]
+			}
+			path, err := strconv.Unquote(s.Path.Value)
+			if err != nil {
+				return true
+			}
+			before = append(before, path)
+			if moved, ok := Move(path, from, to); ok {
+				path = moved
+			}
+			after = append(after, path)
+		}
+		if sorted(before) && !sorted(after) {
+			return true
+		}
+	}
+	return false
+}
+
+// sorted reports whether paths are in increasing order, without repeats.
+func sorted(paths []string) bool {
+	for i := 1; i < len(paths); i++ {
+		if paths[i-1] >= paths[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,143 @@
+package modpath
+
+import (
+	"strings"
+	"testing"
+)
+
+const (
+	from = "github.com/nturu/microservice-template"
+	to   = "example.com/orders"
+)
+
+func TestGoMod(t *testing.T) {
+	in := `module github.com/nturu/microservice-template/tools
+
+go 1.21
+
+require (
+	github.com/gofiber/fiber/v2 v2.50.0
+	github.com/nturu/microservice-template v0.0.0 // indirect
+)
+
+replace github.com/nturu/microservice-template => ../
+`
+	want := `module example.com/orders/tools
+
+go 1.21
+
+require (
+	github.com/gofiber/fiber/v2 v2.50.0
+	example.com/orders v0.0.0 // indirect
+)
+
+replace example.com/orders => ../
+`
+	got, err := GoMod("go.mod", []byte(in), from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("GoMod:\n%s\nwant:\n%s", got, want)
+	}
+
+	other := "module example.com/other\n\ngo 1.21\n"
+	if got, _ := GoMod("go.mod", []byte(other), from, to); string(got) != other {
+		t.Errorf("GoMod changed an unrelated module:\n%s", got)
+	}
+}
+
+func TestGoFile(t *testing.T) {
+	in := `package main
+
+import (
+	"fmt"
+
+	"github.com/nturu/microservice-template/internal/routes"
+	db "github.com/nturu/microservice-template/database"
+	"github.com/nturu/microservice-template-extra/x"
+)
+
+// See github.com/nturu/microservice-template for details.
+const home = "github.com/nturu/microservice-template"
+
+func main() { fmt.Println(routes.X, db.Y, x.Z, home) }
+`
+	got, err := GoFile([]byte(in), from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`db "example.com/orders/database"`,
+		`"example.com/orders/internal/routes"`,
+		`"github.com/nturu/microservice-template-extra/x"`,
+		`// See github.com/nturu/microservice-template for details.`,
+		`const home = "github.com/nturu/microservice-template"`,
+	} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("GoFile output lacks %s:\n%s", want, got)
+		}
+	}
+	// The moved imports sort before the one they used to follow.
+	if strings.Index(string(got), "example.com/orders/database") > strings.Index(string(got), "microservice-template-extra") {
+		t.Errorf("GoFile did not sort the imports:\n%s", got)
+	}
+
+	broken := "package main\n\nimport \"github.com/nturu/microservice-template/x\"\n\nfunc {"
+	if got, err := GoFile([]byte(broken), from, to); err != nil || !strings.Contains(string(got), "example.com/orders/x") {
+		t.Errorf("GoFile on a broken body = %q, %v; want the import moved", got, err)
+	}
+}
+
+// TestGoFileSort checks gofmt'd sources stay gofmt'd, whether or not the
+// moved imports keep their place.
+func TestGoFileSort(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{
+			name: "order kept",
+			in:   "package main\n\nimport (\n\t\"fmt\"\n\n\t\"github.com/nturu/microservice-template/a\"\n\t\"github.com/nturu/microservice-template/b\"\n)\n",
+			want: "package main\n\nimport (\n\t\"fmt\"\n\n\t\"example.com/orders/a\"\n\t\"example.com/orders/b\"\n)\n",
+		},
+		{
+			name: "order broken",
+			in:   "package main\n\nimport (\n\t\"fmt\"\n\t\"github.com/nturu/microservice-template/a\"\n)\n",
+			want: "package main\n\nimport (\n\t\"example.com/orders/a\"\n\t\"fmt\"\n)\n",
+		},
+		{
+			name: "trailing comments",
+			in:   "package main\n\nimport (\n\t\"github.com/nturu/microservice-template/a\"  // a\n\t\"github.com/nturu/microservice-template/bc\" // bc\n)\n",
+			want: "package main\n\nimport (\n\t\"example.com/orders/a\"  // a\n\t\"example.com/orders/bc\" // bc\n)\n",
+		},
+		{
+			name: "not gofmt'd",
+			in:   "package main\n\nimport (\n\t\"fmt\"\n\t\"github.com/nturu/microservice-template/a\"\n)\nvar x  = 1\n",
+			want: "package main\n\nimport (\n\t\"fmt\"\n\t\"example.com/orders/a\"\n)\nvar x  = 1\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GoFile([]byte(tt.in), from, to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("GoFile:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	for _, path := range []string{"orders", "example.com/orders", "github.com/acme/orders/v2"} {
+		if err := Check(path); err != nil {
+			t.Errorf("Check(%q): %v", path, err)
+		}
+	}
+	for _, path := range []string{"", "Example.com/orders", "example.com/orders/", "a b", "../orders"} {
+		if err := Check(path); err == nil {
+			t.Errorf("Check(%q) succeeded, want an error", path)
+		}
+	}
+}
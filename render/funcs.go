@@ -0,0 +1,120 @@
+package render
+
+import (
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// funcs are available to every template on top of the text/template
+// builtins.
+var funcs = template.FuncMap{
+	"lower":   strings.ToLower,
+	"upper":   strings.ToUpper,
+	"replace": strings.ReplaceAll,
+	"trim":    strings.TrimSpace,
+	"quote":   strconv.Quote,
+	"snake":   Snake,
+	"kebab":   Kebab,
+	"camel":   Camel,
+	"pascal":  Pascal,
+	"default": func(def, value any) any {
+		if value == nil || value == "" {
+			return def
+		}
+		return value
+	},
+}
+
+// Words splits an identifier such as "orderService", "order-service" or
+// "OrderService" into lower case words. The case functions templates get,
+// and the names nturu add gives Go code, are all built on it.
+func Words(s string) []string {
+	var out []string
+	var cur []rune
+	flush := func() {
+		if len(cur) > 0 {
+			out = append(out, strings.ToLower(string(cur)))
+			cur = cur[:0]
+		}
+	}
+	runes := []rune(s)
+	for i, r := range runes {
+		switch {
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			flush()
+		case unicode.IsUpper(r) && i > 0 && (unicode.IsLower(runes[i-1]) ||
+			(i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1]))):
+			flush()
+			cur = append(cur, r)
+		default:
+			cur = append(cur, r)
+		}
+	}
+	flush()
+	return out
+}
+
+// Snake joins the words of s with underscores: order_service.
+func Snake(s string) string {
+	return strings.Join(Words(s), "_")
+}
+
+// Kebab joins the words of s with hyphens: order-service.
+func Kebab(s string) string {
+	return strings.Join(Words(s), "-")
+}
+
+// Pascal capitalizes every word of s: OrderService.
+func Pascal(s string) string {
+	var b strings.Builder
+	for _, w := range Words(s) {
+		b.WriteString(strings.ToUpper(w[:1]) + w[1:])
+	}
+	return b.String()
+}
+
+// Camel capitalizes every word of s but the first: orderService.
+func Camel(s string) string {
+	p := Pascal(s)
+	if p == "" {
+		return p
+	}
+	return strings.ToLower(p[:1]) + p[1:]
+}
+
+// initialisms are the words golint wants in a single case in Go names.
+var initialisms = map[string]bool{
+	"acl": true, "api": true, "ascii": true, "cpu": true, "css": true, "dns": true,
+	"eof": true, "guid": true, "html": true, "http": true, "https": true, "id": true,
+	"ip": true, "json": true, "lhs": true, "qps": true, "ram": true, "rhs": true,
+	"rpc": true, "sla": true, "smtp": true, "sql": true, "ssh": true, "tcp": true,
+	"tls": true, "ttl": true, "udp": true, "ui": true, "uid": true, "uuid": true,
+	"uri": true, "url": true, "utf8": true, "vm": true, "xml": true, "xmpp": true,
+	"xsrf": true, "xss": true,
+}
+
+// Exported is Pascal with initialisms in upper case, for exported Go
+// names: owner_id gives OwnerID and api-keys APIKeys.
+func Exported(s string) string {
+	var b strings.Builder
+	for _, w := range Words(s) {
+		if initialisms[w] {
+			b.WriteString(strings.ToUpper(w))
+		} else {
+			b.WriteString(strings.ToUpper(w[:1]) + w[1:])
+		}
+	}
+	return b.String()
+}
+
+// Unexported is Camel with initialisms in a single case, for unexported Go
+// names: owner_id gives ownerID and id_token idToken.
+func Unexported(s string) string {
+	words := Words(s)
+	if len(words) == 0 {
+		return ""
+	}
+	return words[0] + Exported(strings.Join(words[1:], "_"))
+}
@@ -0,0 +1,76 @@
+package render
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWords(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"orders", []string{"orders"}},
+		{"orderService", []string{"order", "service"}},
+		{"OrderService", []string{"order", "service"}},
+		{"order-service", []string{"order", "service"}},
+		{"order_service v2", []string{"order", "service", "v2"}},
+		{"HTTPServer", []string{"http", "server"}},
+		{"userID", []string{"user", "id"}},
+	}
+	for _, tt := range tests {
+		if got := Words(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Words(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFuncs(t *testing.T) {
+	r := New(map[string]any{"Name": "orderService", "Empty": ""}, "", "")
+	tests := []struct{ in, want string }{
+		{"{{snake .Name}}", "order_service"},
+		{"{{kebab .Name}}", "order-service"},
+		{"{{camel .Name}}", "orderService"},
+		{"{{pascal .Name}}", "OrderService"},
+		{"{{camel .Empty}}", ""},
+		{"{{upper .Name}} {{lower .Name}}", "ORDERSERVICE orderservice"},
+		{`{{replace .Name "Service" "Store"}}`, "orderStore"},
+		{`{{trim "  x "}}`, "x"},
+		{"{{quote .Name}}", `"orderService"`},
+		{`{{.Empty | default "none"}}`, "none"},
+		{`{{.Name | default "none"}}`, "orderService"},
+	}
+	for _, tt := range tests {
+		got, err := r.File("f.tmpl", []byte(tt.in))
+		if err != nil {
+			t.Errorf("%s: %v", tt.in, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestExported(t *testing.T) {
+	tests := []struct{ in, exported, unexported string }{
+		{"order-items", "OrderItems", "orderItems"},
+		{"owner_id", "OwnerID", "ownerID"},
+		{"ownerID", "OwnerID", "ownerID"},
+		{"id", "ID", "id"},
+		{"api-keys", "APIKeys", "apiKeys"},
+		{"HTTPServer", "HTTPServer", "httpServer"},
+		{"user_uuid", "UserUUID", "userUUID"},
+		{"identity", "Identity", "identity"},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		if got := Exported(tt.in); got != tt.exported {
+			t.Errorf("Exported(%q) = %q, want %q", tt.in, got, tt.exported)
+		}
+		if got := Unexported(tt.in); got != tt.unexported {
+			t.Errorf("Unexported(%q) = %q, want %q", tt.in, got, tt.unexported)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+// Package render expands template files and paths with text/template.
+//
+// Only files ending in Suffix are rendered; the suffix is dropped from the
+// generated name. Path segments are rendered whenever they contain the left
+// delimiter, so a directory called "{{.AppName}}" is named after the answer.
+// Templates that ship Go source or HTML with their own "{{ }}" actions pick
+// different delimiters in their manifest.
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Suffix marks a file whose contents are rendered.
+const Suffix = ".tmpl"
+
+// Default delimiters, used when a template does not choose its own.
+const (
+	DefaultLeftDelim  = "{{"
+	DefaultRightDelim = "}}"
+)
+
+type Renderer struct {
+	data  any
+	left  string
+	right string
+}
+
+// New returns a Renderer executing templates against data. Empty delimiters
+// fall back to the defaults.
+func New(data any, left, right string) *Renderer {
+	if left == "" {
+		left = DefaultLeftDelim
+	}
+	if right == "" {
+		right = DefaultRightDelim
+	}
+	return &Renderer{data: data, left: left, right: right}
+}
+
+// IsTemplate reports whether the file at name has its contents rendered.
+func IsTemplate(name string) bool {
+	return strings.HasSuffix(name, Suffix)
+}
+
+// Path renders every templated segment of the slash-separated name and drops
+// the Suffix from the final element.
+func (r *Renderer) Path(name string) (string, error) {
+	segments := strings.Split(name, "/")
+	for i, segment := range segments {
+		if !strings.Contains(segment, r.left) {
+			continue
+		}
+		out, err := r.execute(name, segment)
+		if err != nil {
+			// Lines are meaningless for a path; only the file name helps.
+			if rerr, ok := err.(*Error); ok {
+				rerr.Line = 0
+			}
+			return "", err
+		}
+		if out == "" || out == "." || out == ".." || strings.ContainsAny(out, `/\`) {
+			return "", &Error{File: name, Msg: fmt.Sprintf("segment %q renders to invalid name %q", segment, out)}
+		}
+		segments[i] = out
+	}
+	return strings.TrimSuffix(path.Join(segments...), Suffix), nil
+}
+
+// File renders the contents of the template file at name.
+func (r *Renderer) File(name string, content []byte) ([]byte, error) {
+	out, err := r.execute(name, string(content))
+	if err != nil {
+		return nil, err
+	}
+	return []byte(out), nil
+}
+
+func (r *Renderer) execute(name, text string) (string, error) {
+	t, err := template.New(name).
+		Delims(r.left, r.right).
+		Option("missingkey=error").
+		Funcs(funcs).
+		Parse(text)
+	if err != nil {
+		return "", newError(name, err)
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, r.data); err != nil {
+		return "", newError(name, err)
+	}
+	return buf.String(), nil
+}
+
+// Error is a rendering failure located in a template file.
+type Error struct {
+	File string
+	// Line is 0 when the failure is not tied to a line, e.g. a path.
+	Line int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %s", e.File, e.Msg)
+	}
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+}
+
+// templateError matches the "template: name:line[:col]: msg" prefix
+// text/template puts on parse and execution errors.
+var templateError = regexp.MustCompile(`^template: (.*?):(\d+)(?::\d+)?: (.*)$`)
+
+func newError(name string, err error) error {
+	msg := err.Error()
+	m := templateError.FindStringSubmatch(msg)
+	if m == nil || m[1] != name {
+		return &Error{File: name, Msg: strings.TrimPrefix(msg, "template: ")}
+	}
+	line, _ := strconv.Atoi(m[2])
+	return &Error{File: name, Line: line, Msg: m[3]}
+}
@@ -0,0 +1,112 @@
+package render
+
+import (
+	"errors"
+	"testing"
+)
+
+var data = map[string]any{"AppName": "orders", "Port": 3009}
+
+func TestFile(t *testing.T) {
+	tests := []struct {
+		name        string
+		left, right string
+		in, want    string
+	}{
+		{"default delimiters", "", "", "app {{.AppName}} on :{{.Port}}", "app orders on :3009"},
+		{
+			name: "custom delimiters",
+			left: "[[", right: "]]",
+			in:   `<h1>[[.AppName]]</h1>{{ .Title }}`,
+			want: `<h1>orders</h1>{{ .Title }}`,
+		},
+		{
+			name: "custom delimiters with functions",
+			left: "<%", right: "%>",
+			in:   `package <% .AppName | snake %> // {{ not an action }}`,
+			want: `package orders // {{ not an action }}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := New(data, tt.left, tt.right).File("main.go.tmpl", []byte(tt.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("File = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		left, right string
+		in, want    string
+	}{
+		{"undefined function", "", "", "a\nb {{foo}}\n", `main.go.tmpl:2: function "foo" not defined`},
+		{"missing key", "", "", "a\n\n{{.Missing}}", `main.go.tmpl:3: executing "main.go.tmpl" at <.Missing>: map has no entry for key "Missing"`},
+		{"unclosed action", "[[", "]]", "a\n[[ .AppName", `main.go.tmpl:2: unclosed action`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(data, tt.left, tt.right).File("main.go.tmpl", []byte(tt.in))
+			var rerr *Error
+			if !errors.As(err, &rerr) {
+				t.Fatalf("File error = %v, want an *Error", err)
+			}
+			if err.Error() != tt.want {
+				t.Errorf("File error = %q, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPath(t *testing.T) {
+	tests := []struct {
+		name        string
+		left, right string
+		in, want    string
+	}{
+		{"plain", "", "", "internal/db/db.go", "internal/db/db.go"},
+		{"suffix", "", "", "main.go.tmpl", "main.go"},
+		{"segments", "", "", "cmd/{{.AppName}}/{{.AppName}}.go.tmpl", "cmd/orders/orders.go"},
+		{"custom delimiters", "[[", "]]", "cmd/[[.AppName]]/{{x}}.go", "cmd/orders/{{x}}.go"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := New(data, tt.left, tt.right).Path(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Path(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPathErrors(t *testing.T) {
+	r := New(map[string]any{"Empty": "", "Dir": "a/b", "Up": ".."}, "", "")
+	tests := []struct{ in, want string }{
+		{"{{.Empty}}/main.go", `{{.Empty}}/main.go: segment "{{.Empty}}" renders to invalid name ""`},
+		{"cmd/{{.Dir}}.go", `cmd/{{.Dir}}.go: segment "{{.Dir}}.go" renders to invalid name "a/b.go"`},
+		{"{{.Up}}/x", `{{.Up}}/x: segment "{{.Up}}" renders to invalid name ".."`},
+		// A path has no lines worth pointing at.
+		{"{{foo}}/x", `{{foo}}/x: function "foo" not defined`},
+	}
+	for _, tt := range tests {
+		_, err := r.Path(tt.in)
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("Path(%q) error = %v, want %q", tt.in, err, tt.want)
+		}
+	}
+}
+
+func TestIsTemplate(t *testing.T) {
+	if !IsTemplate("main.go.tmpl") || IsTemplate("main.go") || IsTemplate("tmpl") {
+		t.Error("IsTemplate matches other than names ending in .tmpl")
+	}
+}
@@ -0,0 +1,265 @@
+package scaffold
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// parse parses the project's Go file at name as it is now, edits included.
+func (p *Project) parse(name string) (*token.FileSet, *ast.File, []byte, error) {
+	src, ok, err := p.read(name)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("%s does not exist", name)
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, name, src, parser.ParseComments)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return fset, f, src, nil
+}
+
+// findDecl returns the file of the package in the project directory dir
+// holding a top-level declaration match accepts, or "" when none does.
+func (p *Project) findDecl(dir string, match func(ast.Decl) bool) (string, error) {
+	files, err := p.files(dir)
+	if err != nil {
+		return "", err
+	}
+	for _, name := range files {
+		_, f, _, err := p.parse(name)
+		if err != nil {
+			return "", err
+		}
+		for _, d := range f.Decls {
+			if match(d) {
+				return name, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// isType matches the declaration of the type name.
+func isType(name string) func(ast.Decl) bool {
+	return func(d ast.Decl) bool {
+		gen, ok := d.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			return false
+		}
+		for _, spec := range gen.Specs {
+			if spec.(*ast.TypeSpec).Name.Name == name {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// isFunc matches the function name, or with a non-empty recv the method
+// name of that type.
+func isFunc(recv, name string) func(ast.Decl) bool {
+	return func(d ast.Decl) bool {
+		fn, ok := d.(*ast.FuncDecl)
+		if !ok || fn.Name.Name != name {
+			return false
+		}
+		if fn.Recv == nil {
+			return recv == ""
+		}
+		return recv != "" && receiverType(fn) == recv
+	}
+}
+
+// receiverType returns the name of the type a method is declared on.
+func receiverType(fn *ast.FuncDecl) string {
+	t := fn.Recv.List[0].Type
+	if star, ok := t.(*ast.StarExpr); ok {
+		t = star.X
+	}
+	if id, ok := t.(*ast.Ident); ok {
+		return id.Name
+	}
+	return ""
+}
+
+// funcDecl returns the top-level function name in f.
+func funcDecl(f *ast.File, name string) *ast.FuncDecl {
+	for _, d := range f.Decls {
+		if isFunc("", name)(d) {
+			return d.(*ast.FuncDecl)
+		}
+	}
+	return nil
+}
+
+// addDecl appends the Go source decl to the file at name, creating it in
+// package pkg when it does not exist, and imports what decl needs.
+func (p *Project) addDecl(name, pkg, decl string, imports ...string) error {
+	src, ok, err := p.read(name)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		src = []byte("package " + pkg + "\n")
+	}
+	src = append(bytes.TrimRight(src, "\n"), "\n\n"+decl...)
+	return p.write(name, src, imports...)
+}
+
+// appendStmt adds the statement stmt at the end of the function fn in the
+// file at name, importing what it needs.
+func (p *Project) appendStmt(name, fn, stmt string, imports ...string) error {
+	fset, f, src, err := p.parse(name)
+	if err != nil {
+		return err
+	}
+	decl := funcDecl(f, fn)
+	if decl == nil {
+		return fmt.Errorf("%s: no function %s", name, fn)
+	}
+	// Insert after the last statement, not before the closing brace, so the
+	// statement does not end up after a trailing comment.
+	at := fset.Position(decl.Body.Rbrace).Offset
+	insert := stmt + "\n"
+	if n := len(decl.Body.List); n > 0 {
+		at = fset.Position(decl.Body.List[n-1].End()).Offset
+		insert = "\n" + stmt
+	}
+	return p.write(name, splice(src, at, insert), imports...)
+}
+
+// addImports adds the import paths src lacks, each to the group of imports
+// like it: the standard library, the project's module or any other, in
+// that order. gofmt sorts them within the group.
+func (p *Project) addImports(name string, src []byte, paths ...string) ([]byte, error) {
+	for _, imp := range paths {
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, name, src, parser.ImportsOnly)
+		if err != nil {
+			return nil, err
+		}
+		quoted := strconv.Quote(imp)
+		group := p.importGroup(imp)
+		var like, later, last *ast.ImportSpec
+		have := false
+		for _, spec := range f.Imports {
+			path, _ := strconv.Unquote(spec.Path.Value)
+			have = have || path == imp
+			switch g := p.importGroup(path); {
+			case g == group:
+				like = spec
+			case g > group && later == nil:
+				later = spec
+			}
+			last = spec
+		}
+		offset := func(pos token.Pos) int { return fset.Position(pos).Offset }
+		switch decl := lastImportDecl(f); {
+		case have:
+		case decl == nil:
+			src = splice(src, offset(f.Name.End()), "\n\nimport (\n\t"+quoted+"\n)")
+		case !decl.Lparen.IsValid():
+			// Turn import "fmt" into a block.
+			spec := decl.Specs[0]
+			src = splice(src, offset(spec.End()), "\n\t"+quoted+"\n)")
+			src = splice(src, offset(spec.Pos()), "(\n\t")
+		case like != nil:
+			src = splice(src, offset(like.End()), "\n\t"+quoted)
+		case later != nil:
+			src = splice(src, offset(later.Pos()), quoted+"\n\n\t")
+		default:
+			src = splice(src, offset(last.End()), "\n\n\t"+quoted)
+		}
+	}
+	return src, nil
+}
+
+// importGroup classifies an import path: 0 for the standard library, 1 for
+// the project's module and 2 for any other.
+func (p *Project) importGroup(path string) int {
+	first, _, _ := strings.Cut(path, "/")
+	switch {
+	case !strings.Contains(first, "."):
+		return 0
+	case path == p.Module || strings.HasPrefix(path, p.Module+"/"):
+		return 1
+	}
+	return 2
+}
+
+// splice inserts s into src at offset at.
+func splice(src []byte, at int, s string) []byte {
+	out := make([]byte, 0, len(src)+len(s))
+	out = append(out, src[:at]...)
+	out = append(out, s...)
+	return append(out, src[at:]...)
+}
+
+func lastImportDecl(f *ast.File) *ast.GenDecl {
+	var last *ast.GenDecl
+	for _, d := range f.Decls {
+		if gen, ok := d.(*ast.GenDecl); ok && gen.Tok == token.IMPORT {
+			last = gen
+		}
+	}
+	return last
+}
+
+// calls reports whether body makes a call match accepts.
+func calls(body *ast.BlockStmt, match func(*ast.CallExpr) bool) bool {
+	found := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		if call, ok := n.(*ast.CallExpr); ok && match(call) {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// selector returns the parts of a call to x.sel, or "", "".
+func selector(call *ast.CallExpr) (x, sel string) {
+	s, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return "", ""
+	}
+	id, ok := s.X.(*ast.Ident)
+	if !ok {
+		return "", ""
+	}
+	return id.Name, s.Sel.Name
+}
+
+// stringArg returns the value of the string literal that is argument i of
+// call, or "" with false.
+func stringArg(call *ast.CallExpr, i int) (string, bool) {
+	if len(call.Args) <= i {
+		return "", false
+	}
+	lit, ok := call.Args[i].(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return "", false
+	}
+	s, err := strconv.Unquote(lit.Value)
+	return s, err == nil
+}
+
+// pkgName is the package name of the package in the slash-separated
+// directory dir, by the convention that they match.
+func pkgName(dir string) string {
+	return path.Base(dir)
+}
+
+func quote(s string) string {
+	return strconv.Quote(s)
+}
@@ -0,0 +1,376 @@
+package scaffold
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"path"
+	"strings"
+	"unicode"
+
+	"github.com/CeoFred/nturu/render"
+)
+
+// Directories of the fiber template, relative to its go.mod.
+const (
+	fiberHandlers   = "internal/handlers"
+	fiberHelpers    = "internal/helpers"
+	fiberMiddleware = "internal/middleware"
+	fiberValidators = "internal/validators"
+	fiberRoutes     = "internal/routes"
+)
+
+const (
+	fiberImport     = "github.com/gofiber/fiber/v2"
+	gormImport      = "gorm.io/gorm"
+	validatorImport = "github.com/go-playground/validator/v10"
+)
+
+// Handler is an endpoint to add to a fiber project.
+type Handler struct {
+	// Resource names the route group, such as orders for /orders, and
+	// Action the handler, such as create.
+	Resource string
+	Action   string
+	// Method is the HTTP method, GET when empty.
+	Method string
+	// Path is the full route below the API prefix, such as /orders/:id; it
+	// must be in the resource's group. /<resource> when empty.
+	Path string
+	// Auth puts the route behind the JWT middleware.
+	Auth bool
+}
+
+// ParseHandler splits a handler name such as orders.create into its
+// resource and action.
+func ParseHandler(name string) (resource, action string, err error) {
+	resource, action, ok := strings.Cut(name, ".")
+	if !ok {
+		return "", "", fmt.Errorf("handler %q must be <resource>.<action>, e.g. orders.create", name)
+	}
+	if err := checkName("resource", resource); err != nil {
+		return "", "", err
+	}
+	if err := checkName("action", action); err != nil {
+		return "", "", err
+	}
+	return resource, action, nil
+}
+
+// bodyMethods are the methods whose handlers read a request body.
+var bodyMethods = map[string]bool{"POST": true, "PUT": true, "PATCH": true}
+
+var httpMethods = map[string]bool{"GET": true, "POST": true, "PUT": true, "PATCH": true, "DELETE": true}
+
+// handlerData feeds the fiber recipes.
+type handlerData struct {
+	Handler
+	// Type is the handler type, Receiver its receiver name, HandlerVar the
+	// variable holding one in the register function and Func the method.
+	Type, Receiver, HandlerVar, Func string
+	// Input and Validator are empty for methods without a body.
+	Input, Validator string
+	Summary, Tag     string
+	// Verb is the lower-case method, Call the router method, Router the
+	// swagger route and Params its path parameters.
+	Verb, Call, Router string
+	Params             []string
+	// Register is the function registering the resource's routes on the
+	// router Group, and Sub the route within the group.
+	Register, Group, Sub string
+	// Repository is the repository type a new handler type is created
+	// with, held in RepositoryField and passed as RepositoryParam.
+	Repository, RepositoryField, RepositoryParam string
+}
+
+// AddHandler adds a handler for h with swagger annotations, a request body
+// type and validator for methods with a body, and registers its route in
+// the register function of its resource, which it creates when needed.
+func (p *Project) AddHandler(h Handler) error {
+	if p.Template != "fiber" {
+		return p.unsupported("handler", "fiber")
+	}
+	h.Method = strings.ToUpper(h.Method)
+	if h.Method == "" {
+		h.Method = "GET"
+	}
+	if !httpMethods[h.Method] {
+		return fmt.Errorf("unsupported method %s; use GET, POST, PUT, PATCH or DELETE", h.Method)
+	}
+	prefix := "/" + h.Resource
+	if h.Path == "" {
+		h.Path = prefix
+	}
+	sub, ok := strings.CutPrefix(h.Path, prefix)
+	if !ok || sub != "" && sub[0] != '/' {
+		return fmt.Errorf("path %s is not in the %s group; handlers of %s are routed below %s", h.Path, h.Resource, h.Resource, prefix)
+	}
+	if sub == "" {
+		sub = "/"
+	}
+
+	d := handlerData{
+		Handler: h,
+		Func:    render.Exported(h.Action),
+		Summary: sentence(h.Action + " " + h.Resource),
+		Tag:     render.Exported(h.Resource),
+		Verb:    strings.ToLower(h.Method),
+		Call:    render.Exported(strings.ToLower(h.Method)),
+		Sub:     sub,
+	}
+	d.Router, d.Params = swaggerRoute(h.Path)
+	if bodyMethods[h.Method] {
+		d.Input = render.Exported(h.Action) + render.Exported(h.Resource) + "Input"
+		d.Validator = "Validate" + render.Exported(h.Action) + render.Exported(h.Resource)
+	}
+
+	reg, err := p.findRegister(h.Resource)
+	if err != nil {
+		return err
+	}
+	if reg != nil {
+		d.Register, d.Group, d.HandlerVar, d.Type = reg.fn, reg.group, reg.handlerVar, reg.handlerType
+		if d.Type == "" {
+			return fmt.Errorf("%s: %s creates no handler with handlers.New...; add the route by hand", reg.file, reg.fn)
+		}
+	} else {
+		d.Register = "register" + render.Exported(h.Resource)
+		d.Group = render.Unexported(h.Resource) + "Router"
+		d.HandlerVar = "handler"
+		d.Type = render.Exported(h.Resource) + "Handler"
+	}
+	d.Receiver = string(unicode.ToLower([]rune(d.Type)[0]))
+
+	file := render.Snake(h.Resource) + ".go"
+	handlersDir := p.goPath(fiberHandlers)
+	typeFile, err := p.findDecl(handlersDir, isType(d.Type))
+	if err != nil {
+		return err
+	}
+	if typeFile == "" {
+		if err := p.addHandlerRepository(&d); err != nil {
+			return err
+		}
+		typeFile = path.Join(handlersDir, file)
+		if err := p.addRecipe(typeFile, "fiber.tmpl", "handlerType", d, p.importPath(fiberRepository)); err != nil {
+			return err
+		}
+	}
+	if found, err := p.findDecl(handlersDir, isFunc(d.Type, d.Func)); err != nil {
+		return err
+	} else if found == "" {
+		imports := []string{fiberImport}
+		if d.Auth || d.Input != "" {
+			imports = append(imports, p.importPath(fiberHelpers))
+		}
+		if err := p.addRecipe(typeFile, "fiber.tmpl", "handlerMethod", d, imports...); err != nil {
+			return err
+		}
+	}
+
+	if d.Input != "" {
+		helpers := p.goPath(fiberHelpers)
+		if found, err := p.findDecl(helpers, isType(d.Input)); err != nil {
+			return err
+		} else if found == "" {
+			if err := p.addRecipe(path.Join(helpers, file), "fiber.tmpl", "input", d); err != nil {
+				return err
+			}
+		}
+		validators := p.goPath(fiberValidators)
+		if found, err := p.findDecl(validators, isFunc("", d.Validator)); err != nil {
+			return err
+		} else if found == "" {
+			err := p.addRecipe(path.Join(validators, file), "fiber.tmpl", "validator", d, fiberImport, validatorImport, p.importPath(fiberHelpers))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if reg == nil {
+		routesFile := path.Join(p.goPath(fiberRoutes), file)
+		imports := []string{fiberImport, gormImport, p.importPath(fiberHandlers), p.importPath(fiberRepository)}
+		err := p.addRecipe(routesFile, "fiber.tmpl", "register", d, imports...)
+		if err != nil {
+			return err
+		}
+		if err := p.registerInRoutes(d.Register); err != nil {
+			return err
+		}
+		reg = &register{file: routesFile, fn: d.Register}
+	}
+	return p.addRoute(reg, d)
+}
+
+// addHandlerRepository names the repository of the resource of d, which a
+// new handler type is created with as NewUserHandler is. A resource whose
+// model has no repository yet gets one with a TODO, for nturu add model to
+// fill in.
+func (p *Project) addHandlerRepository(d *handlerData) error {
+	m, err := newModelData(Model{Name: singular(d.Resource)})
+	if err != nil {
+		return err
+	}
+	d.Repository = m.Type + "Repository"
+	d.RepositoryField = render.Unexported(d.Repository)
+	d.RepositoryParam = m.Var + "Repo"
+
+	repository := p.goPath(fiberRepository)
+	if found, err := p.findDecl(repository, isType(d.Repository)); err != nil || found != "" {
+		return err
+	}
+	return p.addRecipe(path.Join(repository, render.Snake(m.Type)+".go"), "fiber.tmpl", "repositoryStub", m, gormImport)
+}
+
+// addRecipe renders recipe from the recipes file with d and appends it to
+// the file at name.
+func (p *Project) addRecipe(name, recipes, recipe string, d any, imports ...string) error {
+	src, err := execute(recipes, recipe, d)
+	if err != nil {
+		return err
+	}
+	return p.addDecl(name, pkgName(path.Dir(name)), strings.TrimSpace(src)+"\n", imports...)
+}
+
+// register is a function registering the routes of a resource, such as
+//
+//	func registerUser(router fiber.Router, db *gorm.DB) {
+//		userRouter := router.Group("users")
+//		handler := handlers.NewUserHandler(repository.NewUserRepository(db))
+//		...
+type register struct {
+	file, fn                       string
+	group, handlerVar, handlerType string
+}
+
+// findRegister finds the function of the routes package creating the route
+// group of resource, or nil.
+func (p *Project) findRegister(resource string) (*register, error) {
+	files, err := p.files(p.goPath(fiberRoutes))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range files {
+		_, f, _, err := p.parse(name)
+		if err != nil {
+			return nil, err
+		}
+		for _, decl := range f.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Recv != nil || fn.Body == nil {
+				continue
+			}
+			var reg *register
+			for _, stmt := range fn.Body.List {
+				v, call := assignedCall(stmt)
+				if call == nil {
+					continue
+				}
+				_, sel := selector(call)
+				if g, ok := stringArg(call, 0); sel == "Group" && ok && strings.Trim(g, "/") == resource {
+					reg = &register{file: name, fn: fn.Name.Name, group: v}
+				}
+				if x, sel := selector(call); reg != nil && x == "handlers" && strings.HasPrefix(sel, "New") {
+					reg.handlerVar, reg.handlerType = v, strings.TrimPrefix(sel, "New")
+				}
+			}
+			if reg != nil {
+				return reg, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// assignedCall matches v := call(...) and returns v and the call.
+func assignedCall(stmt ast.Stmt) (string, *ast.CallExpr) {
+	assign, ok := stmt.(*ast.AssignStmt)
+	if !ok || assign.Tok != token.DEFINE || len(assign.Lhs) != 1 || len(assign.Rhs) != 1 {
+		return "", nil
+	}
+	id, ok := assign.Lhs[0].(*ast.Ident)
+	call, isCall := assign.Rhs[0].(*ast.CallExpr)
+	if !ok || !isCall {
+		return "", nil
+	}
+	return id.Name, call
+}
+
+// registerInRoutes calls the register function fn from Routes, which sets
+// up the API router, unless it does already.
+func (p *Project) registerInRoutes(fn string) error {
+	routesDir := p.goPath(fiberRoutes)
+	name, err := p.findDecl(routesDir, isFunc("", "Routes"))
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		return fmt.Errorf("%s declares no Routes function to register %s in", routesDir, fn)
+	}
+	_, f, _, err := p.parse(name)
+	if err != nil {
+		return err
+	}
+	body := funcDecl(f, "Routes").Body
+	if calls(body, func(call *ast.CallExpr) bool {
+		id, ok := call.Fun.(*ast.Ident)
+		return ok && id.Name == fn
+	}) {
+		return nil
+	}
+	return p.appendStmt(name, "Routes", fn+"(router, db)")
+}
+
+// addRoute registers the handler in reg unless a route with the same
+// method and path is there already.
+func (p *Project) addRoute(reg *register, d handlerData) error {
+	_, f, _, err := p.parse(reg.file)
+	if err != nil {
+		return err
+	}
+	body := funcDecl(f, reg.fn).Body
+	if calls(body, func(call *ast.CallExpr) bool {
+		x, sel := selector(call)
+		sub, _ := stringArg(call, 0)
+		return x == d.Group && sel == d.Call && sub == d.Sub
+	}) {
+		return nil
+	}
+
+	stmt, err := execute("fiber.tmpl", "route", d)
+	if err != nil {
+		return err
+	}
+	var imports []string
+	if d.Auth {
+		imports = append(imports, p.importPath(fiberMiddleware))
+	}
+	if d.Validator != "" {
+		imports = append(imports, p.importPath(fiberValidators))
+	}
+	return p.appendStmt(reg.file, reg.fn, strings.TrimSpace(stmt), imports...)
+}
+
+// swaggerRoute turns a fiber route such as /orders/:id into the swagger
+// route /orders/{id} and its parameters.
+func swaggerRoute(route string) (string, []string) {
+	var params []string
+	parts := strings.Split(route, "/")
+	for i, part := range parts {
+		if name, ok := strings.CutPrefix(part, ":"); ok {
+			name = strings.TrimSuffix(name, "?")
+			params = append(params, name)
+			parts[i] = "{" + name + "}"
+		}
+	}
+	return strings.Join(parts, "/"), params
+}
+
+// sentence turns words such as "create order-items" into a sentence,
+// "Create order items".
+func sentence(s string) string {
+	r := []rune(strings.Join(render.Words(s), " "))
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
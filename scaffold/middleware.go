@@ -0,0 +1,289 @@
+package scaffold
+
+import (
+	"fmt"
+	"go/ast"
+	"path"
+	"strings"
+
+	"github.com/CeoFred/nturu/render"
+)
+
+// Middleware is a middleware to add to a project.
+type Middleware struct {
+	// Name names the middleware, such as tenant for TenantMiddleware.
+	Name string
+	// Group is the route group to register it on, such as orders; empty
+	// registers it for every route.
+	Group string
+}
+
+// middlewareData feeds the middleware recipes.
+type middlewareData struct {
+	// Func is the middleware function and Test its test.
+	Func, Test string
+}
+
+const bunrouterImport = "github.com/uptrace/bunrouter"
+
+// AddMiddleware adds a middleware passing every request on and a test
+// stub for it, and registers it for every route or on one route group.
+// Fiber middlewares follow JWTMiddleware: a function of the database
+// returning a fiber.Handler. Default ones are bunrouter middlewares.
+func (p *Project) AddMiddleware(m Middleware) error {
+	if err := checkName("middleware", m.Name); err != nil {
+		return err
+	}
+	if m.Group != "" {
+		if err := checkName("group", m.Group); err != nil {
+			return err
+		}
+	}
+	name := render.Exported(m.Name)
+	if !strings.HasSuffix(name, "Middleware") {
+		name += "Middleware"
+	}
+	d := middlewareData{Func: name, Test: "Test" + name}
+
+	var dir, recipes string
+	var imports, testImports []string
+	switch p.Template {
+	case "fiber":
+		dir, recipes = p.goPath(fiberMiddleware), "fiber.tmpl"
+		imports = []string{fiberImport, gormImport}
+		testImports = []string{"net/http/httptest", "testing", fiberImport}
+	case "default":
+		dir, recipes = p.goPath(defaultMiddleware), "default.tmpl"
+		imports = []string{"net/http", bunrouterImport}
+		testImports = []string{"net/http", "net/http/httptest", "testing", bunrouterImport}
+	default:
+		return p.unsupported("middleware", "fiber", "default")
+	}
+
+	file := path.Join(dir, render.Snake(m.Name)+".go")
+	if found, err := p.findDecl(dir, isFunc("", d.Func)); err != nil {
+		return err
+	} else if found == "" {
+		if err := p.addRecipe(file, recipes, "middleware", d, imports...); err != nil {
+			return err
+		}
+	}
+	test := strings.TrimSuffix(file, ".go") + "_test.go"
+	if has, err := p.declares(test, d.Test); err != nil {
+		return err
+	} else if !has {
+		if err := p.addRecipe(test, recipes, "middlewareTest", d, testImports...); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case p.Template == "fiber" && m.Group == "":
+		return p.useInMain(d.Func)
+	case p.Template == "fiber":
+		return p.useInGroup(m.Group, d.Func)
+	case m.Group == "":
+		return p.useInRouter(d.Func)
+	}
+	return p.useInBunGroup(m.Group, d.Func)
+}
+
+// declares reports whether the Go file at name exists and declares the
+// function fn.
+func (p *Project) declares(name, fn string) (bool, error) {
+	if _, ok, err := p.read(name); err != nil || !ok {
+		return false, err
+	}
+	_, f, _, err := p.parse(name)
+	if err != nil {
+		return false, err
+	}
+	return funcDecl(f, fn) != nil, nil
+}
+
+// usesMiddleware matches a call to x.Use with the middleware fn among its
+// arguments, called or not.
+func usesMiddleware(x, fn string) func(*ast.CallExpr) bool {
+	return func(call *ast.CallExpr) bool {
+		if v, sel := selector(call); v != x || sel != "Use" {
+			return false
+		}
+		for _, arg := range call.Args {
+			if c, ok := arg.(*ast.CallExpr); ok {
+				arg = c.Fun
+			}
+			if s, ok := arg.(*ast.SelectorExpr); ok && s.Sel.Name == fn {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// useInMain registers the fiber middleware fn for every route in main,
+// right before routes.Routes binds them, which is the first place the
+// database is connected:
+//
+//	app.Use(middleware.TenantMiddleware(database.DB))
+//
+//	// Bind routes
+//	routes.Routes(app, database.DB)
+func (p *Project) useInMain(fn string) error {
+	main := p.goPath("main.go")
+	fset, f, src, err := p.parse(main)
+	if err != nil {
+		return err
+	}
+	decl := funcDecl(f, "main")
+	if decl == nil {
+		return fmt.Errorf("%s declares no main function to register %s in", main, fn)
+	}
+	for _, stmt := range decl.Body.List {
+		expr, ok := stmt.(*ast.ExprStmt)
+		if !ok {
+			continue
+		}
+		call, ok := expr.X.(*ast.CallExpr)
+		if !ok || len(call.Args) != 2 {
+			continue
+		}
+		if x, sel := selector(call); x != "routes" || sel != "Routes" {
+			continue
+		}
+		text := func(n ast.Node) string {
+			return string(src[fset.Position(n.Pos()).Offset:fset.Position(n.End()).Offset])
+		}
+		app := text(call.Args[0])
+		if calls(decl.Body, usesMiddleware(app, fn)) {
+			return nil
+		}
+		at := stmt.Pos()
+		for _, c := range f.Comments {
+			if fset.Position(c.End()).Line == fset.Position(at).Line-1 {
+				at = c.Pos()
+			}
+		}
+		use := app + ".Use(middleware." + fn + "(" + text(call.Args[1]) + "))\n\n\t"
+		return p.write(main, splice(src, fset.Position(at).Offset, use), p.importPath(fiberMiddleware))
+	}
+	return fmt.Errorf("%s: main does not call routes.Routes; register %s on the app by hand", main, fn)
+}
+
+// useInGroup registers the fiber middleware fn on the route group of
+// resource, right after the group is created.
+func (p *Project) useInGroup(resource, fn string) error {
+	reg, err := p.findRegister(resource)
+	if err != nil {
+		return err
+	}
+	if reg == nil {
+		return fmt.Errorf("%s has no %s route group; add a handler to it first with nturu add handler %s.<action>", p.goPath(fiberRoutes), resource, resource)
+	}
+	fset, f, src, err := p.parse(reg.file)
+	if err != nil {
+		return err
+	}
+	decl := funcDecl(f, reg.fn)
+	if calls(decl.Body, usesMiddleware(reg.group, fn)) {
+		return nil
+	}
+	db := ""
+	for _, field := range decl.Type.Params.List {
+		if star, ok := field.Type.(*ast.StarExpr); ok && len(field.Names) == 1 {
+			if s, ok := star.X.(*ast.SelectorExpr); ok && s.Sel.Name == "DB" {
+				db = field.Names[0].Name
+			}
+		}
+	}
+	if db == "" {
+		return fmt.Errorf("%s: %s takes no *gorm.DB to pass %s", reg.file, reg.fn, fn)
+	}
+	for _, stmt := range decl.Body.List {
+		if v, call := assignedCall(stmt); call != nil && v == reg.group {
+			use := "\n\t" + reg.group + ".Use(middleware." + fn + "(" + db + "))"
+			return p.write(reg.file, splice(src, fset.Position(stmt.End()).Offset, use), p.importPath(fiberMiddleware))
+		}
+	}
+	return fmt.Errorf("%s: %s does not create the %s group", reg.file, reg.fn, resource)
+}
+
+// useInRouter registers the bunrouter middleware fn for every route among
+// the options of bunrouter.New in the service's Run method.
+func (p *Project) useInRouter(fn string) error {
+	name := path.Join(p.goPath(defaultService), "microservice.go")
+	fset, f, src, err := p.parse(name)
+	if err != nil {
+		return err
+	}
+	var run *ast.FuncDecl
+	for _, d := range f.Decls {
+		if isFunc("Microservice", "Run")(d) {
+			run = d.(*ast.FuncDecl)
+		}
+	}
+	if run == nil {
+		return fmt.Errorf("%s declares no Microservice.Run creating the router", name)
+	}
+	var router *ast.CallExpr
+	ast.Inspect(run.Body, func(n ast.Node) bool {
+		if call, ok := n.(*ast.CallExpr); ok && router == nil {
+			if x, sel := selector(call); x == "bunrouter" && sel == "New" {
+				router = call
+			}
+		}
+		return router == nil
+	})
+	if router == nil {
+		return fmt.Errorf("%s: Run does not call bunrouter.New; register %s on the router by hand", name, fn)
+	}
+	for _, arg := range router.Args {
+		if call, ok := arg.(*ast.CallExpr); ok && usesMiddleware("bunrouter", fn)(call) {
+			return nil
+		}
+	}
+	use := "bunrouter.Use(middleware." + fn + ")"
+	at := fset.Position(router.Rparen).Offset
+	if n := len(router.Args); n > 0 {
+		at = fset.Position(router.Args[n-1].End()).Offset
+		use = ",\n\t\t" + use
+	}
+	return p.write(name, splice(src, at, use), p.importPath(defaultMiddleware))
+}
+
+// useInBunGroup registers the bunrouter middleware fn on the group a
+// service file creates for resource with g := router.NewGroup("/resource"),
+// or a path ending in /resource such as the /v1/invoices of add resource.
+func (p *Project) useInBunGroup(resource, fn string) error {
+	files, err := p.files(p.goPath(defaultService))
+	if err != nil {
+		return err
+	}
+	for _, name := range files {
+		fset, f, src, err := p.parse(name)
+		if err != nil {
+			return err
+		}
+		for _, d := range f.Decls {
+			decl, ok := d.(*ast.FuncDecl)
+			if !ok || decl.Body == nil {
+				continue
+			}
+			for _, stmt := range decl.Body.List {
+				v, call := assignedCall(stmt)
+				if call == nil {
+					continue
+				}
+				_, sel := selector(call)
+				if g, ok := stringArg(call, 0); sel != "NewGroup" || !ok || path.Base(strings.Trim(g, "/")) != resource {
+					continue
+				}
+				if calls(decl.Body, usesMiddleware(v, fn)) {
+					return nil
+				}
+				use := "\n\t" + v + " = " + v + ".Use(middleware." + fn + ")"
+				return p.write(name, splice(src, fset.Position(stmt.End()).Offset, use), p.importPath(defaultMiddleware))
+			}
+		}
+	}
+	return fmt.Errorf("%s creates no %s group with router.NewGroup(\".../%s\")", p.goPath(defaultService), resource, resource)
+}
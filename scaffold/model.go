@@ -0,0 +1,465 @@
+package scaffold
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"path"
+	"strings"
+	"time"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+
+	"github.com/CeoFred/nturu/render"
+)
+
+// fieldType is how a field type given on the command line is declared in
+// Go and in Postgres.
+type fieldType struct {
+	Go     string
+	Import string
+	SQL    string
+}
+
+var fieldTypes = map[string]fieldType{
+	"string":  {Go: "string", SQL: "VARCHAR(255)"},
+	"text":    {Go: "string", SQL: "TEXT"},
+	"int":     {Go: "int", SQL: "INTEGER"},
+	"int32":   {Go: "int32", SQL: "INTEGER"},
+	"int64":   {Go: "int64", SQL: "BIGINT"},
+	"float32": {Go: "float32", SQL: "REAL"},
+	"float64": {Go: "float64", SQL: "DOUBLE PRECISION"},
+	"bool":    {Go: "bool", SQL: "BOOLEAN"},
+	"time":    {Go: "time.Time", Import: "time", SQL: "TIMESTAMP"},
+	"uuid":    {Go: "uuid.UUID", Import: uuidImport, SQL: "UUID"},
+	"json":    {Go: "json.RawMessage", Import: "encoding/json", SQL: "JSONB"},
+}
+
+// fieldTypeAliases are other names accepted for field types.
+var fieldTypeAliases = map[string]string{
+	"float":     "float64",
+	"integer":   "int",
+	"bigint":    "int64",
+	"boolean":   "bool",
+	"timestamp": "time",
+	"datetime":  "time",
+}
+
+const (
+	uuidImport  = "github.com/google/uuid"
+	uuidVersion = "v1.4.0"
+)
+
+// Field is a column of a model, such as price:float64.
+type Field struct {
+	// Name is the Go field name and Column the column name.
+	Name   string
+	Column string
+	Type   fieldType
+}
+
+// ParseField parses a field given as name:type, such as owner_id:uuid.
+func ParseField(s string) (Field, error) {
+	name, typ, ok := strings.Cut(s, ":")
+	if !ok {
+		return Field{}, fmt.Errorf("field %q must be name:type, e.g. price:float64", s)
+	}
+	if err := checkName("field", name); err != nil {
+		return Field{}, err
+	}
+	typ = strings.ToLower(typ)
+	if alias, ok := fieldTypeAliases[typ]; ok {
+		typ = alias
+	}
+	t, ok := fieldTypes[typ]
+	if !ok {
+		return Field{}, fmt.Errorf("field %s has unknown type %q; use %s", name, typ, orList(fieldTypeNames()))
+	}
+	return Field{Name: render.Exported(name), Column: render.Snake(name), Type: t}, nil
+}
+
+func fieldTypeNames() []string {
+	return []string{"string", "text", "int", "int32", "int64", "float32", "float64", "bool", "time", "uuid", "json"}
+}
+
+// Model is a database table and the Go type for its rows.
+type Model struct {
+	// Name is the model name, such as Product or order-item.
+	Name   string
+	Fields []Field
+}
+
+// modelData feeds the model recipes.
+type modelData struct {
+	// Type is the Go type, Plural its plural, Var a variable holding one and
+	// Table the table.
+	Type, Plural, Var, Table string
+	Fields                   []Field
+	// Package is the import path of the models, for the repository.
+	Package string
+}
+
+// now stamps the names of new migrations.
+var now = time.Now
+
+// AddModel adds a model, its migration and, in fiber projects, a repository
+// with a finder for every field. Every table has an id primary key and
+// created_at and updated_at timestamps.
+func (p *Project) AddModel(m Model) error {
+	d, err := newModelData(m)
+	if err != nil {
+		return err
+	}
+	switch p.Template {
+	case "fiber":
+		return p.addFiberModel(d)
+	case "default":
+		return p.addBunModel(d)
+	}
+	return p.unsupported("model", "fiber", "default")
+}
+
+// newModelData checks m and names what the recipes declare for it.
+func newModelData(m Model) (modelData, error) {
+	if err := checkName("model", m.Name); err != nil {
+		return modelData{}, err
+	}
+	seen := map[string]bool{}
+	for _, f := range m.Fields {
+		switch {
+		case f.Column == "id" || f.Column == "created_at" || f.Column == "updated_at":
+			return modelData{}, fmt.Errorf("field %s is added to every model", f.Column)
+		case seen[f.Column]:
+			return modelData{}, fmt.Errorf("field %s is given twice", f.Column)
+		}
+		seen[f.Column] = true
+	}
+	return modelData{
+		Type:   render.Exported(m.Name),
+		Plural: render.Exported(plural(m.Name)),
+		Var:    render.Unexported(m.Name),
+		Table:  plural(render.Snake(m.Name)),
+		Fields: m.Fields,
+	}, nil
+}
+
+// Directories and files of the fiber template, relative to its go.mod.
+const (
+	fiberModels     = "internal/models"
+	fiberRepository = "internal/repository"
+	fiberDatabase   = "database"
+)
+
+func (p *Project) addFiberModel(d modelData) error {
+	file := render.Snake(d.Type) + ".go"
+	d.Package = p.importPath(fiberModels)
+
+	models := p.goPath(fiberModels)
+	if found, err := p.findDecl(models, isType(d.Type)); err != nil {
+		return err
+	} else if found == "" {
+		if err := p.addRecipe(path.Join(models, file), "fiber.tmpl", "model", d, d.imports("time")...); err != nil {
+			return err
+		}
+	}
+
+	// A repository may exist without its queries, added by nturu add
+	// handler for a resource with no model yet.
+	repository := p.goPath(fiberRepository)
+	imports := append(d.imports(), gormImport, d.Package)
+	if found, err := p.findDecl(repository, isType(d.Type+"Repository")); err != nil {
+		return err
+	} else if found == "" {
+		if err := p.addRecipe(path.Join(repository, file), "fiber.tmpl", "repository", d, imports...); err != nil {
+			return err
+		}
+	} else if queries, err := p.findDecl(repository, isFunc(d.Type+"Repository", "All"+d.Plural)); err != nil {
+		return err
+	} else if queries == "" {
+		if err := p.addRecipe(found, "fiber.tmpl", "repositoryMethods", d, imports...); err != nil {
+			return err
+		}
+	}
+
+	if err := p.addManualMigration(d.Table, createTable(d.Table, "SERIAL", d.Fields)); err != nil {
+		return err
+	}
+	return p.requireFor(d.Fields)
+}
+
+// imports lists the packages the types of d's fields need, and more.
+func (d modelData) imports(more ...string) []string {
+	imports := more
+	for _, f := range d.Fields {
+		if f.Type.Import != "" {
+			imports = append(imports, f.Type.Import)
+		}
+	}
+	return imports
+}
+
+// addManualMigration adds the query creating table to the queries
+// database.RunManualMigration runs, unless one creates it already.
+func (p *Project) addManualMigration(table, create string) error {
+	const fn = "RunManualMigration"
+	dir := p.goPath(fiberDatabase)
+	name, err := p.findDecl(dir, isFunc("", fn))
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		return fmt.Errorf("%s declares no %s to add the %s table to", dir, fn, table)
+	}
+	fset, f, src, err := p.parse(name)
+	if err != nil {
+		return err
+	}
+	body := funcDecl(f, fn).Body
+	if createsTable(body, table) {
+		return nil
+	}
+
+	// The queries are run from the list in
+	//
+	//	migrationQueries := []string{
+	//		query1,
+	//	}
+	var list *ast.CompositeLit
+	var listStmt ast.Stmt
+	declared := map[string]bool{}
+	for _, stmt := range body.List {
+		assign, ok := stmt.(*ast.AssignStmt)
+		if !ok || assign.Tok != token.DEFINE || len(assign.Lhs) != len(assign.Rhs) {
+			continue
+		}
+		for i, lhs := range assign.Lhs {
+			id, ok := lhs.(*ast.Ident)
+			if !ok {
+				continue
+			}
+			declared[id.Name] = true
+			if lit, ok := assign.Rhs[i].(*ast.CompositeLit); ok && id.Name == "migrationQueries" && list == nil {
+				list, listStmt = lit, stmt
+			}
+		}
+	}
+	if list == nil {
+		return fmt.Errorf("%s: %s has no migrationQueries list to add the %s table to", name, fn, table)
+	}
+	query := fmt.Sprintf("query%d", len(list.Elts)+1)
+	for i := len(list.Elts) + 2; declared[query]; i++ {
+		query = fmt.Sprintf("query%d", i)
+	}
+
+	offset := func(pos token.Pos) int { return fset.Position(pos).Offset }
+	// Splice from the end, so earlier offsets stay valid.
+	if n := len(list.Elts); n == 0 {
+		src = splice(src, offset(list.Lbrace)+1, "\n"+query+",\n")
+	} else if end := offset(list.Elts[n-1].End()); src[end] == ',' {
+		src = splice(src, end, ",\n"+query)
+	} else {
+		src = splice(src, end, ", "+query)
+	}
+	src = splice(src, offset(listStmt.Pos()), query+" := `"+create+"`\n\n")
+	return p.write(name, src)
+}
+
+// createsTable reports whether a string in body creates table.
+func createsTable(body *ast.BlockStmt, table string) bool {
+	found := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		lit, ok := n.(*ast.BasicLit)
+		if !ok || lit.Kind != token.STRING {
+			return !found
+		}
+		words := strings.Fields(strings.ToLower(strings.NewReplacer("(", " ", "`", " ", `"`, " ").Replace(lit.Value)))
+		for i := 0; i+2 < len(words); i++ {
+			if words[i] != "create" || words[i+1] != "table" {
+				continue
+			}
+			name := words[i+2:]
+			if len(name) > 3 && strings.Join(name[:3], " ") == "if not exists" {
+				name = name[3:]
+			}
+			found = found || name[0] == table
+		}
+		return !found
+	})
+	return found
+}
+
+// createTable returns the statement creating table with an id of the
+// Postgres type id, the fields and timestamps.
+func createTable(table, id string, fields []Field) string {
+	columns := []string{"id " + id + " PRIMARY KEY"}
+	for _, f := range fields {
+		columns = append(columns, f.Column+" "+f.Type.SQL+" NOT NULL")
+	}
+	columns = append(columns,
+		"created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP",
+		"updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP",
+	)
+	return "CREATE TABLE IF NOT EXISTS " + table + " (\n\t\t\t" + strings.Join(columns, ",\n\t\t\t") + "\n\t\t\t);"
+}
+
+// Directories of the default template, relative to its go.mod.
+const (
+	defaultDB         = "internal/db"
+	defaultMigrations = "internal/db/migrations"
+	defaultMain       = "cmd"
+	defaultMiddleware = "internal/middleware"
+	defaultService    = "service"
+	defaultTracing    = "internal/tracing"
+)
+
+const (
+	bunImport     = "github.com/uptrace/bun"
+	migrateImport = "github.com/uptrace/bun/migrate"
+	zerologImport = "github.com/rs/zerolog/log"
+)
+
+func (p *Project) addBunModel(d modelData) error {
+	db := p.goPath(defaultDB)
+	if found, err := p.findDecl(db, isType(d.Type)); err != nil {
+		return err
+	} else if found == "" {
+		if err := p.addRecipe(path.Join(db, "models.go"), "default.tmpl", "model", d, d.imports(bunImport, "time")...); err != nil {
+			return err
+		}
+	}
+
+	migrations := p.goPath(defaultMigrations)
+	if err := p.addMigrations(); err != nil {
+		return err
+	}
+	files, err := p.files(migrations)
+	if err != nil {
+		return err
+	}
+	suffix := "_create_" + d.Table + ".go"
+	for _, name := range files {
+		if strings.HasSuffix(name, suffix) {
+			return p.requireFor(d.Fields)
+		}
+	}
+	migration := struct {
+		Create, Table string
+	}{createTable(d.Table, "BIGSERIAL", d.Fields), d.Table}
+	name := path.Join(migrations, now().UTC().Format("20060102150405")+suffix)
+	if err := p.addRecipe(name, "default.tmpl", "migration", migration, "context", bunImport); err != nil {
+		return err
+	}
+	return p.requireFor(d.Fields)
+}
+
+// addMigrations adds the migrations package and runs it from main, unless
+// the project has it already.
+func (p *Project) addMigrations() error {
+	migrations := p.goPath(defaultMigrations)
+	if found, err := p.findDecl(migrations, isFunc("", "Migrate")); err != nil || found != "" {
+		return err
+	}
+	err := p.addRecipe(path.Join(migrations, "migrations.go"), "default.tmpl", "migrations", nil, "context", bunImport, migrateImport, zerologImport)
+	if err != nil {
+		return err
+	}
+
+	// Migrate right after connecting: db := db.NewDbConnection(cfg).
+	main := path.Join(p.goPath(defaultMain), "main.go")
+	fset, f, src, err := p.parse(main)
+	if err != nil {
+		return err
+	}
+	fn := funcDecl(f, "main")
+	if fn == nil {
+		return fmt.Errorf("%s declares no main function to run the migrations from", main)
+	}
+	for _, stmt := range fn.Body.List {
+		v, call := assignedCall(stmt)
+		if call == nil {
+			continue
+		}
+		if x, sel := selector(call); x == "db" && sel == "NewDbConnection" {
+			insert := "\n\n\tif err := migrations.Migrate(context.Background(), " + v + "); err != nil {\n\t\tpanic(err)\n\t}"
+			src = splice(src, fset.Position(stmt.End()).Offset, insert)
+			return p.write(main, src, "context", p.importPath(defaultMigrations))
+		}
+	}
+	return fmt.Errorf("%s: main does not call db.NewDbConnection; run migrations.Migrate after connecting", main)
+}
+
+// requireFor adds the modules the field types need to go.mod.
+func (p *Project) requireFor(fields []Field) error {
+	for _, f := range fields {
+		if f.Type.Import == uuidImport {
+			return p.require(uuidImport, uuidVersion)
+		}
+	}
+	return nil
+}
+
+// require adds mod at version to go.mod unless it is required already.
+func (p *Project) require(mod, version string) error {
+	name := p.goPath("go.mod")
+	data, _, err := p.read(name)
+	if err != nil {
+		return err
+	}
+	f, err := modfile.Parse(name, data, nil)
+	if err != nil {
+		return err
+	}
+	for _, r := range f.Require {
+		if r.Mod.Path == mod {
+			return nil
+		}
+	}
+	// Keep the new requirement out of the block of indirect ones.
+	var reqs []*modfile.Require
+	for _, r := range f.Require {
+		reqs = append(reqs, &modfile.Require{Mod: r.Mod, Indirect: r.Indirect})
+	}
+	reqs = append(reqs, &modfile.Require{Mod: module.Version{Path: mod, Version: version}})
+	f.SetRequireSeparateIndirect(reqs)
+	f.Cleanup()
+	if data, err = f.Format(); err != nil {
+		return err
+	}
+	if err := p.write(name, data); err != nil {
+		return err
+	}
+	p.notes = append(p.notes, fmt.Sprintf("go.mod requires %s now; run go mod tidy in %s", mod, p.GoDir))
+	return nil
+}
+
+// plural returns the English plural of a name such as order_item.
+func plural(name string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, "y") && len(lower) > 1 && !strings.ContainsAny(lower[len(lower)-2:len(lower)-1], "aeiou"):
+		return name[:len(name)-1] + "ies"
+	case strings.HasSuffix(lower, "s"), strings.HasSuffix(lower, "x"), strings.HasSuffix(lower, "z"),
+		strings.HasSuffix(lower, "ch"), strings.HasSuffix(lower, "sh"):
+		return name + "es"
+	}
+	return name + "s"
+}
+
+// singular returns the English singular of a plural name such as
+// order_items, undoing plural.
+func singular(name string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, "ies") && len(lower) > 3:
+		return name[:len(name)-3] + "y"
+	case strings.HasSuffix(lower, "sses"), strings.HasSuffix(lower, "xes"), strings.HasSuffix(lower, "zes"),
+		strings.HasSuffix(lower, "ches"), strings.HasSuffix(lower, "shes"):
+		return name[:len(name)-2]
+	case strings.HasSuffix(lower, "ss"):
+		return name
+	case strings.HasSuffix(lower, "s"):
+		return name[:len(name)-1]
+	}
+	return name
+}
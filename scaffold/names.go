@@ -0,0 +1,17 @@
+package scaffold
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// namePattern matches the names additions are given on the command line,
+// such as orders or order-items.
+var namePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*([-_][A-Za-z0-9]+)*$`)
+
+func checkName(what, name string) error {
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("%s %q must start with a letter and contain only letters, digits, - and _", what, name)
+	}
+	return nil
+}
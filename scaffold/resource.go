@@ -0,0 +1,250 @@
+package scaffold
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"path"
+	"strings"
+
+	"github.com/CeoFred/nturu/render"
+)
+
+// Resource is a model served over HTTP with list, get, create, update
+// and delete endpoints.
+type Resource struct {
+	// Name is the plural resource name, such as invoices or order-items;
+	// its singular names the model.
+	Name   string
+	Fields []Field
+}
+
+// resourceData feeds the resource recipes.
+type resourceData struct {
+	modelData
+	// Path is the route group, such as /v1/invoices, and Group the variable
+	// holding it in Run.
+	Path, Group string
+	// Receiver and Router are the names Run gives the service and the
+	// router, and DB the field of Microservice holding the database.
+	Receiver, Router, DB string
+}
+
+// AddResource adds a bun model with its migration, a store reading and
+// writing it through the database the service is created with, and
+// handlers listing a page of them, getting, creating, updating and
+// deleting one, routed in a group of Microservice.Run. Resources are
+// supported in default projects.
+func (p *Project) AddResource(r Resource) error {
+	if p.Template != "default" {
+		return p.unsupported("resource", "default")
+	}
+	if err := checkName("resource", r.Name); err != nil {
+		return err
+	}
+	m, err := newModelData(Model{Name: singular(r.Name), Fields: r.Fields})
+	if err != nil {
+		return err
+	}
+	d := resourceData{
+		modelData: m,
+		Path:      "/v1/" + strings.ReplaceAll(m.Table, "_", "-"),
+		Group:     render.Unexported(m.Plural),
+	}
+	if d.DB, err = p.keepDB(); err != nil {
+		return err
+	}
+	if err := p.addBunModel(m); err != nil {
+		return err
+	}
+
+	db := p.goPath(defaultDB)
+	if found, err := p.findDecl(db, isType(d.Type+"Store")); err != nil {
+		return err
+	} else if found == "" {
+		name := path.Join(db, render.Snake(d.Type)+"_store.go")
+		if err := p.addRecipe(name, "default.tmpl", "store", d, "context", "time", bunImport); err != nil {
+			return err
+		}
+	}
+	if found, err := p.findDecl(db, isFunc("", "oneRow")); err != nil {
+		return err
+	} else if found == "" {
+		if err := p.addRecipe(path.Join(db, "store.go"), "default.tmpl", "oneRow", nil, "database/sql"); err != nil {
+			return err
+		}
+	}
+
+	if found, err := p.findDecl(p.goPath(defaultService), isFunc("", "writeJSON")); err != nil {
+		return err
+	} else if found == "" {
+		imports := []string{"encoding/json", "errors", "fmt", "net/http", "strconv", zerologImport, bunrouterImport}
+		if err := p.addRecipe(path.Join(p.goPath(defaultService), "api.go"), "default.tmpl", "api", nil, imports...); err != nil {
+			return err
+		}
+	}
+	return p.routeResource(d)
+}
+
+// routeResource adds the handlers of d to the service and routes them in
+// Run after the routes it has, unless it routes d's group already:
+//
+//	invoices := router.NewGroup("/v1/invoices")
+//	invoices.GET("", srv.listInvoicesHandler)
+//	...
+func (p *Project) routeResource(d resourceData) error {
+	name := path.Join(p.goPath(defaultService), "microservice.go")
+	fset, f, src, err := p.parse(name)
+	if err != nil {
+		return err
+	}
+	var run *ast.FuncDecl
+	for _, decl := range f.Decls {
+		if isFunc("Microservice", "Run")(decl) {
+			run = decl.(*ast.FuncDecl)
+		}
+	}
+	if run == nil || len(run.Recv.List[0].Names) == 0 {
+		return fmt.Errorf("%s declares no Microservice.Run to route %s in", name, d.Path)
+	}
+	d.Receiver = run.Recv.List[0].Names[0].Name
+
+	// The routes go after the last statement using the router or a group
+	// of it.
+	var last ast.Stmt
+	routers := map[string]bool{}
+	for _, stmt := range run.Body.List {
+		var call *ast.CallExpr
+		switch stmt := stmt.(type) {
+		case *ast.ExprStmt:
+			call, _ = stmt.X.(*ast.CallExpr)
+		case *ast.AssignStmt:
+			if len(stmt.Rhs) == 1 {
+				call, _ = stmt.Rhs[0].(*ast.CallExpr)
+			}
+		}
+		if call == nil {
+			continue
+		}
+		x, sel := selector(call)
+		if g, ok := stringArg(call, 0); ok && sel == "NewGroup" && g == d.Path {
+			return nil
+		}
+		v, _ := assignedCall(stmt)
+		switch {
+		case x == "bunrouter" && sel == "New" && v != "":
+			d.Router = v
+			routers[v] = true
+		case routers[x] && sel == "NewGroup" && v != "":
+			routers[v] = true
+		case !routers[x]:
+			continue
+		}
+		last = stmt
+	}
+	if d.Router == "" {
+		return fmt.Errorf("%s: Run does not create a router with bunrouter.New to route %s in", name, d.Path)
+	}
+
+	service := p.goPath(defaultService)
+	if found, err := p.findDecl(service, isFunc("Microservice", "list"+d.Plural+"Handler")); err != nil {
+		return err
+	} else if found == "" {
+		imports := d.imports("database/sql", "encoding/json", "errors", "fmt", "net/http", bunrouterImport,
+			p.importPath(defaultDB), p.importPath(defaultTracing))
+		if err := p.addRecipe(path.Join(service, render.Snake(d.Plural)+".go"), "default.tmpl", "resourceHandlers", d, imports...); err != nil {
+			return err
+		}
+	}
+
+	routes, err := execute("default.tmpl", "resourceRoutes", d)
+	if err != nil {
+		return err
+	}
+	return p.write(name, splice(src, fset.Position(last.End()).Offset, "\n\n"+strings.TrimSpace(routes)))
+}
+
+// keepDB returns the field of Microservice holding the database, adding
+// one set from the *bun.DB NewMicroservice takes when there is none.
+func (p *Project) keepDB() (string, error) {
+	name := path.Join(p.goPath(defaultService), "microservice.go")
+	fset, f, src, err := p.parse(name)
+	if err != nil {
+		return "", err
+	}
+	var fields *ast.FieldList
+	for _, decl := range f.Decls {
+		if !isType("Microservice")(decl) {
+			continue
+		}
+		for _, spec := range decl.(*ast.GenDecl).Specs {
+			if st, ok := spec.(*ast.TypeSpec).Type.(*ast.StructType); ok && spec.(*ast.TypeSpec).Name.Name == "Microservice" {
+				fields = st.Fields
+			}
+		}
+	}
+	if fields == nil {
+		return "", fmt.Errorf("%s declares no Microservice struct", name)
+	}
+	for _, field := range fields.List {
+		if isBunDB(field.Type) && len(field.Names) > 0 {
+			return field.Names[0].Name, nil
+		}
+	}
+
+	ctor := funcDecl(f, "NewMicroservice")
+	if ctor == nil {
+		return "", fmt.Errorf("%s declares no NewMicroservice to keep the database from", name)
+	}
+	param := ""
+	for _, field := range ctor.Type.Params.List {
+		if isBunDB(field.Type) && len(field.Names) == 1 {
+			param = field.Names[0].Name
+		}
+	}
+	var lit *ast.CompositeLit
+	ast.Inspect(ctor.Body, func(n ast.Node) bool {
+		if c, ok := n.(*ast.CompositeLit); ok && lit == nil {
+			if id, ok := c.Type.(*ast.Ident); ok && id.Name == "Microservice" {
+				lit = c
+			}
+		}
+		return lit == nil
+	})
+	if param == "" || param == "_" || lit == nil {
+		return "", fmt.Errorf("%s: NewMicroservice does not take a *bun.DB and create a Microservice to keep it in", name)
+	}
+
+	const field = "db"
+	offset := func(pos token.Pos) int { return fset.Position(pos).Offset }
+	set := field + ": " + param
+	at, insert := offset(lit.Lbrace)+1, "\n"+set+",\n"
+	if n := len(lit.Elts); n > 0 {
+		at, insert = offset(lit.Elts[n-1].End()), ", "+set
+		if src[at] == ',' {
+			at, insert = at+1, "\n"+set+","
+		}
+	}
+	declare := offset(fields.Closing)
+	// Splice the later position first, so the earlier one stays valid.
+	if at > declare {
+		src = splice(splice(src, at, insert), declare, field+" *bun.DB\n")
+	} else {
+		src = splice(splice(src, declare, field+" *bun.DB\n"), at, insert)
+	}
+	return field, p.write(name, src, bunImport)
+}
+
+// isBunDB matches the type *bun.DB.
+func isBunDB(t ast.Expr) bool {
+	star, ok := t.(*ast.StarExpr)
+	if !ok {
+		return false
+	}
+	s, ok := star.X.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	x, ok := s.X.(*ast.Ident)
+	return ok && x.Name == "bun" && s.Sel.Name == "DB"
+}
@@ -0,0 +1,225 @@
+// Package scaffold adds code to a generated project: handlers, models and
+// the like, written the way the project's template writes its own.
+//
+// Every addition is planned in memory first. New declarations are only
+// added when the project does not declare them yet, and registrations are
+// inserted into existing functions by editing their syntax trees, so
+// running the same addition twice changes nothing the second time.
+package scaffold
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"go/format"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/CeoFred/nturu/lock"
+	"github.com/CeoFred/nturu/modpath"
+)
+
+//go:embed templates
+var templates embed.FS
+
+// Project is a generated project being added to.
+type Project struct {
+	Dir string
+	// Template is the name of the template the project was generated from,
+	// which decides how additions look.
+	Template string
+	// Module is the module path declared by the project's go.mod, and
+	// GoDir the slash-separated directory of that go.mod, "." at the root.
+	Module string
+	GoDir  string
+
+	// edited holds the new content of every file changed so far.
+	edited  map[string][]byte
+	created map[string]bool
+	notes   []string
+}
+
+// Open loads the project generated by nturu in dir.
+func Open(dir string) (*Project, error) {
+	l, err := lock.Read(dir)
+	if err != nil {
+		return nil, err
+	}
+	p := &Project{Dir: dir, Template: l.Template.Name, edited: map[string][]byte{}, created: map[string]bool{}}
+
+	// Templates keep go.mod at the root or one directory down, as the
+	// default template does in src.
+	candidates := []string{"."}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			candidates = append(candidates, e.Name())
+		}
+	}
+	for _, goDir := range candidates {
+		data, err := os.ReadFile(filepath.Join(dir, goDir, "go.mod"))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		p.Module = modpath.ModulePath(data)
+		if p.Module == "" {
+			return nil, fmt.Errorf("%s declares no module", path.Join(goDir, "go.mod"))
+		}
+		p.GoDir = goDir
+		return p, nil
+	}
+	return nil, fmt.Errorf("no go.mod found in %s", dir)
+}
+
+// Change is a file an addition creates or rewrites.
+type Change struct {
+	// Path is slash-separated and relative to the project root.
+	Path    string
+	Created bool
+	Content []byte
+}
+
+// Changes lists the files changed so far, by path.
+func (p *Project) Changes() []Change {
+	var changes []Change
+	for name, content := range p.edited {
+		changes = append(changes, Change{Path: name, Created: p.created[name], Content: content})
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+// Notes lists what to do after applying the changes.
+func (p *Project) Notes() []string {
+	return p.notes
+}
+
+// Apply writes every change to the project.
+func (p *Project) Apply() error {
+	for _, c := range p.Changes() {
+		name := filepath.Join(p.Dir, filepath.FromSlash(c.Path))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			return err
+		}
+		// WriteFile keeps the mode of the file it replaces.
+		if err := os.WriteFile(name, c.Content, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unsupported reports an addition the project's template has no recipe for.
+func (p *Project) unsupported(what string, templates ...string) error {
+	return fmt.Errorf("adding a %s is supported in projects generated from %s; this one comes from %s", what, orList(templates), p.Template)
+}
+
+// goPath returns the project path of the slash-separated path rel inside
+// the Go module.
+func (p *Project) goPath(rel string) string {
+	return path.Join(p.GoDir, rel)
+}
+
+// importPath returns the import path of the package in the module
+// directory rel.
+func (p *Project) importPath(rel string) string {
+	return path.Join(p.Module, rel)
+}
+
+// read returns the current content of the project file at name, edits
+// included, and whether it exists.
+func (p *Project) read(name string) ([]byte, bool, error) {
+	if content, ok := p.edited[name]; ok {
+		return content, true, nil
+	}
+	content, err := os.ReadFile(filepath.Join(p.Dir, filepath.FromSlash(name)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	return content, err == nil, err
+}
+
+// write records new content for the project file at name. Go source is
+// given the imports and gofmt'ed.
+func (p *Project) write(name string, content []byte, imports ...string) error {
+	if path.Ext(name) == ".go" {
+		imported, err := p.addImports(name, content, imports...)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if content, err = format.Source(imported); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	if _, exists, err := p.read(name); err != nil {
+		return err
+	} else if !exists {
+		p.created[name] = true
+	}
+	p.edited[name] = content
+	return nil
+}
+
+// files lists the Go files of the package in the project directory dir,
+// created ones included, leaving out tests.
+func (p *Project) files(dir string) ([]string, error) {
+	var names []string
+	entries, err := os.ReadDir(filepath.Join(p.Dir, filepath.FromSlash(dir)))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	for _, e := range entries {
+		names = append(names, path.Join(dir, e.Name()))
+	}
+	for name := range p.created {
+		if path.Dir(name) == dir {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var files []string
+	for i, name := range names {
+		if i > 0 && names[i-1] == name {
+			continue
+		}
+		if path.Ext(name) == ".go" && !strings.HasSuffix(name, "_test.go") {
+			files = append(files, name)
+		}
+	}
+	return files, nil
+}
+
+// execute executes the named template of the project's template recipes.
+func execute(recipes, name string, data any) (string, error) {
+	t, err := template.New(recipes).Funcs(template.FuncMap{"quote": quote}).ParseFS(templates, "templates/"+recipes)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := t.ExecuteTemplate(&buf, name, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func orList(items []string) string {
+	switch len(items) {
+	case 0:
+		return ""
+	case 1:
+		return items[0]
+	}
+	return strings.Join(items[:len(items)-1], ", ") + " or " + items[len(items)-1]
+}
@@ -0,0 +1,437 @@
+package scaffold
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CeoFred/nturu/lock"
+)
+
+// newProject writes files into a project generated from template.
+func newProject(t *testing.T, template string, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := lock.Write(dir, &lock.Lock{Template: lock.Template{Name: template}}); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// readFile returns the file name of the project in dir.
+func readFile(t *testing.T, dir, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// checkFiles checks every file of the project in dir holds the snippets
+// listed for it.
+func checkFiles(t *testing.T, dir string, files map[string][]string) {
+	t.Helper()
+	for name, wants := range files {
+		data := readFile(t, dir, name)
+		for _, want := range wants {
+			if !strings.Contains(data, want) {
+				t.Errorf("%s lacks %q:\n%s", name, want, data)
+			}
+		}
+	}
+}
+
+// step is one addition to a project. changes is how many files it should
+// change, -1 when that does not matter, and notes, when set, how many
+// notes it should leave; err says it should fail instead.
+type step struct {
+	name    string
+	add     func(*Project) error
+	changes int
+	notes   int
+	err     bool
+}
+
+// adding returns a step's add, adding v with a method such as
+// (*Project).AddHandler.
+func adding[T any](add func(*Project, T) error, v T) func(*Project) error {
+	return func(p *Project) error { return add(p, v) }
+}
+
+// runSteps opens the project in dir for every step in turn, adds to it and
+// applies the changes.
+func runSteps(t *testing.T, dir string, steps []step) {
+	t.Helper()
+	for _, s := range steps {
+		p, err := Open(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = s.add(p)
+		if s.err {
+			if err == nil {
+				t.Errorf("adding %s succeeded, want an error", s.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("adding %s: %v", s.name, err)
+		}
+		if err := p.Apply(); err != nil {
+			t.Fatalf("adding %s: %v", s.name, err)
+		}
+		var changed []string
+		for _, c := range p.Changes() {
+			changed = append(changed, c.Path)
+		}
+		if s.changes >= 0 && len(changed) != s.changes {
+			t.Errorf("adding %s changed %d files, want %d: %v", s.name, len(changed), s.changes, changed)
+		}
+		if s.notes != 0 && len(p.Notes()) != s.notes {
+			t.Errorf("adding %s left notes %q, want %d", s.name, p.Notes(), s.notes)
+		}
+	}
+}
+
+const fiberRoutesV1 = `package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+func Routes(app *fiber.App, db *gorm.DB) {
+	router := app.Group("/api/v1")
+
+	registerUser(router, db)
+}
+`
+
+const fiberRoutesUser = `package routes
+
+import (
+	"example.com/shop/internal/handlers"
+	"example.com/shop/internal/repository"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+func registerUser(router fiber.Router, db *gorm.DB) {
+	userRouter := router.Group("users")
+	handler := handlers.NewUserHandler(repository.NewUserRepository(db))
+
+	userRouter.Get("/profile", handler.UserProfile)
+}
+`
+
+func TestAddHandler(t *testing.T) {
+	dir := newProject(t, "fiber", map[string]string{
+		"go.mod":                       "module example.com/shop\n\ngo 1.19\n",
+		"internal/routes/v1.go":        fiberRoutesV1,
+		"internal/routes/user.go":      fiberRoutesUser,
+		"internal/handlers/user.go":    "package handlers\n\ntype UserHandler struct{}\n",
+		"internal/validators/user.go":  "package validators\n",
+		"internal/helpers/structs.go":  "package helpers\n",
+		"internal/middleware/users.go": "package middleware\n",
+		"database/migration.go":        fiberMigration,
+	})
+	orders := Handler{Resource: "orders", Action: "create", Method: "post", Path: "/orders", Auth: true}
+	runSteps(t, dir, []step{
+		{name: "orders.create", add: adding((*Project).AddHandler, orders), changes: 6},
+		{name: "orders.create again", add: adding((*Project).AddHandler, orders), changes: 0},
+		// The model fills in the repository the handler left empty.
+		{name: "model Order", add: adding((*Project).AddModel, Model{Name: "Order"}), changes: 3},
+		{name: "users.avatar", add: adding((*Project).AddHandler, Handler{Resource: "users", Action: "avatar", Method: "GET", Path: "/users/:id/avatar"}), changes: 2},
+		{name: "orders.list at /carts", add: adding((*Project).AddHandler, Handler{Resource: "orders", Action: "list", Path: "/carts"}), err: true},
+	})
+
+	checkFiles(t, dir, map[string][]string{
+		"internal/routes/v1.go": {"\tregisterUser(router, db)\n\tregisterOrders(router, db)\n}"},
+		"internal/routes/orders.go": {
+			`ordersRouter := router.Group("orders")`,
+			`ordersRouter.Post("/", middleware.JWTMiddleware(db), validators.ValidateCreateOrders, handler.Create)`,
+			"\t\"example.com/shop/internal/validators\"\n\n\t\"github.com/gofiber/fiber/v2\"",
+			// Handlers get their repository, as NewUserHandler does.
+			"handler := handlers.NewOrdersHandler(repository.NewOrderRepository(db))",
+		},
+		"internal/handlers/orders.go": {"func NewOrdersHandler(orderRepo *repository.OrderRepository) *OrdersHandler {"},
+		"internal/repository/order.go": {
+			"// TODO: add the queries",
+			"func NewOrderRepository(db *gorm.DB) *OrderRepository {",
+			"func (a *OrderRepository) AllOrders() ([]*models.Order, error) {",
+		},
+		"internal/routes/user.go":   {"\tuserRouter.Get(\"/profile\", handler.UserProfile)\n\tuserRouter.Get(\"/:id/avatar\", handler.Avatar)\n}"},
+		"internal/handlers/user.go": {"func (u *UserHandler) Avatar(c *fiber.Ctx) error", "// @Router /users/{id}/avatar [get]"},
+	})
+	if n := strings.Count(readFile(t, dir, "internal/repository/order.go"), "type OrderRepository struct"); n != 1 {
+		t.Errorf("OrderRepository is declared %d times", n)
+	}
+}
+
+const fiberMigration = `package database
+
+import (
+	"gorm.io/gorm"
+)
+
+func RunManualMigration(db *gorm.DB) {
+
+	query1 := ` + "`CREATE TABLE IF NOT EXISTS users (id SERIAL PRIMARY KEY);`" + `
+
+	migrationQueries := []string{
+		query1,
+	}
+
+	for _, query := range migrationQueries {
+		db.Exec(query)
+	}
+}
+`
+
+func TestAddModel(t *testing.T) {
+	dir := newProject(t, "fiber", map[string]string{
+		"go.mod":                "module example.com/shop\n\ngo 1.19\n\nrequire gorm.io/gorm v1.25.5\n",
+		"database/migration.go": fiberMigration,
+	})
+	fields := []Field{}
+	for _, s := range []string{"name:string", "price:float", "owner_id:uuid"} {
+		f, err := ParseField(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fields = append(fields, f)
+	}
+	product := Model{Name: "Product", Fields: fields}
+	runSteps(t, dir, []step{
+		{name: "Product", add: adding((*Project).AddModel, product), changes: 4, notes: 1},
+		{name: "Product again", add: adding((*Project).AddModel, product), changes: 0},
+		{name: "category", add: adding((*Project).AddModel, Model{Name: "category"}), changes: -1},
+		{name: "Order with an id field", add: adding((*Project).AddModel, Model{Name: "Order", Fields: []Field{{Name: "ID", Column: "id"}}}), err: true},
+	})
+
+	checkFiles(t, dir, map[string][]string{
+		"database/migration.go": {
+			"\tquery2 := `CREATE TABLE IF NOT EXISTS products (\n\t\t\tid SERIAL PRIMARY KEY,\n\t\t\tname VARCHAR(255) NOT NULL,\n\t\t\tprice DOUBLE PRECISION NOT NULL,\n\t\t\towner_id UUID NOT NULL,",
+			"CREATE TABLE IF NOT EXISTS categories (",
+			"\t\tquery1,\n\t\tquery2,\n\t\tquery3,\n\t}",
+		},
+		"internal/models/product.go": {
+			"OwnerID   uuid.UUID `json:\"owner_id\"`",
+			"return \"products\"",
+		},
+		"internal/repository/product.go": {
+			"func (a *ProductRepository) FindProductsByOwnerID(value uuid.UUID) ([]*models.Product, error)",
+			"\"example.com/shop/internal/models\"",
+		},
+		"go.mod": {"github.com/google/uuid v1.4.0"},
+	})
+	if _, err := ParseField("price:money"); err == nil {
+		t.Error("ParseField accepted an unknown type")
+	}
+}
+
+const fiberMain = `package main
+
+import (
+	"example.com/shop/database"
+	"example.com/shop/internal/routes"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func main() {
+	app := fiber.New()
+
+	database.Connect()
+
+	// Bind routes
+	routes.Routes(app, database.DB)
+}
+`
+
+const bunService = `package service
+
+import (
+	"github.com/uptrace/bunrouter"
+	"github.com/uptrace/bunrouter/extra/reqlog"
+)
+
+func (srv *Microservice) Run() {
+	router := bunrouter.New(
+		bunrouter.Use(reqlog.NewMiddleware()),
+	)
+
+	orders := router.NewGroup("/orders")
+	orders.GET("", srv.listOrders)
+}
+`
+
+func TestAddMiddleware(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		files    map[string]string
+		steps    []step
+		checks   map[string][]string
+	}{
+		{
+			name:     "fiber",
+			template: "fiber",
+			files: map[string]string{
+				"go.mod":                  "module example.com/shop\n\ngo 1.19\n",
+				"main.go":                 fiberMain,
+				"internal/routes/v1.go":   fiberRoutesV1,
+				"internal/routes/user.go": fiberRoutesUser,
+			},
+			steps: []step{
+				{name: "tenant", add: adding((*Project).AddMiddleware, Middleware{Name: "tenant"}), changes: 3},
+				{name: "tenant again", add: adding((*Project).AddMiddleware, Middleware{Name: "tenant"}), changes: 0},
+				{name: "audit on users", add: adding((*Project).AddMiddleware, Middleware{Name: "audit", Group: "users"}), changes: -1},
+				{name: "audit on carts", add: adding((*Project).AddMiddleware, Middleware{Name: "audit", Group: "carts"}), err: true},
+			},
+			checks: map[string][]string{
+				"main.go": {
+					"\tapp.Use(middleware.TenantMiddleware(database.DB))\n\n\t// Bind routes\n",
+					"\t\"example.com/shop/internal/middleware\"\n",
+				},
+				"internal/middleware/tenant.go":      {"func TenantMiddleware(db *gorm.DB) fiber.Handler {"},
+				"internal/middleware/tenant_test.go": {"func TestTenantMiddleware(t *testing.T) {"},
+				"internal/routes/user.go":            {"\tuserRouter := router.Group(\"users\")\n\tuserRouter.Use(middleware.AuditMiddleware(db))\n"},
+			},
+		},
+		{
+			name:     "default",
+			template: "default",
+			files: map[string]string{
+				"src/go.mod":                  "module example.com/shop\n\ngo 1.21.1\n",
+				"src/service/microservice.go": bunService,
+			},
+			steps: []step{
+				{name: "tenant", add: adding((*Project).AddMiddleware, Middleware{Name: "tenant"}), changes: -1},
+				{name: "audit on orders", add: adding((*Project).AddMiddleware, Middleware{Name: "audit", Group: "orders"}), changes: -1},
+				{name: "audit on orders again", add: adding((*Project).AddMiddleware, Middleware{Name: "audit", Group: "orders"}), changes: 0},
+			},
+			checks: map[string][]string{
+				"src/service/microservice.go": {
+					"\t\tbunrouter.Use(reqlog.NewMiddleware()),\n\t\tbunrouter.Use(middleware.TenantMiddleware),\n\t)",
+					"\torders := router.NewGroup(\"/orders\")\n\torders = orders.Use(middleware.AuditMiddleware)\n",
+				},
+				"src/internal/middleware/tenant.go": {"func TenantMiddleware(next bunrouter.HandlerFunc) bunrouter.HandlerFunc {"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := newProject(t, tt.template, tt.files)
+			runSteps(t, dir, tt.steps)
+			checkFiles(t, dir, tt.checks)
+		})
+	}
+}
+
+const bunMicroservice = `package service
+
+import (
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bunrouter"
+
+	"example.com/shop/internal/config"
+)
+
+type Microservice struct {
+	cfg *config.Config
+}
+
+func NewMicroservice(cfg *config.Config, db *bun.DB) (srv *Microservice, err error) {
+	srv = &Microservice{
+		cfg: cfg,
+	}
+	return
+}
+
+func (srv *Microservice) Run() {
+	router := bunrouter.New()
+
+	router.GET("/", srv.indexHandler)
+
+	serve(router)
+}
+`
+
+const bunMain = `package main
+
+import (
+	"example.com/shop/internal/db"
+)
+
+func main() {
+	db := db.NewDbConnection(cfg)
+
+	run(db)
+}
+`
+
+func TestAddResource(t *testing.T) {
+	dir := newProject(t, "default", map[string]string{
+		"src/go.mod":                  "module example.com/shop\n\ngo 1.21.1\n",
+		"src/cmd/main.go":             bunMain,
+		"src/internal/db/models.go":   "package db\n",
+		"src/service/microservice.go": bunMicroservice,
+	})
+	defer func(saved func() time.Time) { now = saved }(now)
+	now = func() time.Time { return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC) }
+
+	f, err := ParseField("total:float64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	invoices := Resource{Name: "invoices", Fields: []Field{f}}
+	runSteps(t, dir, []step{
+		{name: "invoices", add: adding((*Project).AddResource, invoices), changes: 9},
+		{name: "invoices again", add: adding((*Project).AddResource, invoices), changes: 0},
+		{name: "categories", add: adding((*Project).AddResource, Resource{Name: "categories"}), changes: -1},
+	})
+
+	checkFiles(t, dir, map[string][]string{
+		"src/service/microservice.go": {
+			"\tcfg *config.Config\n\tdb  *bun.DB\n}",
+			"\t\tcfg: cfg,\n\t\tdb:  db,\n\t}",
+			"\trouter.GET(\"/\", srv.indexHandler)\n\n\tinvoices := router.NewGroup(\"/v1/invoices\")\n\tinvoices.GET(\"\", srv.listInvoicesHandler)\n",
+			"\tinvoices.DELETE(\"/:id\", srv.deleteInvoiceHandler)\n\n\tcategories := router.NewGroup(\"/v1/categories\")\n",
+		},
+		"src/service/invoices.go": {
+			"\tTotal *float64 `json:\"total\"`\n",
+			"tracing.Tracer().Start(r.Context(), \"service.listInvoicesHandler\")",
+			"db.NewInvoiceStore(srv.db).List(ctx, limit, offset)",
+		},
+		"src/service/categories.go":                                    {"func (srv *Microservice) getCategoryHandler("},
+		"src/service/api.go":                                           {"func page(r bunrouter.Request) (limit, offset int, err error) {"},
+		"src/internal/db/invoice_store.go":                             {"func (s *InvoiceStore) List(ctx context.Context, limit, offset int) ([]Invoice, int, error) {"},
+		"src/internal/db/models.go":                                    {"type Invoice struct {", "type Category struct {"},
+		"src/internal/db/migrations/20240102030405_create_invoices.go": {"CREATE TABLE IF NOT EXISTS invoices ("},
+		"src/cmd/main.go": {
+			"\tdb := db.NewDbConnection(cfg)\n\n\tif err := migrations.Migrate(context.Background(), db); err != nil {\n",
+		},
+	})
+}
+
+func TestSingular(t *testing.T) {
+	for _, name := range []string{"invoice", "category", "box", "address", "order-item", "match"} {
+		if got := singular(plural(name)); got != name {
+			t.Errorf("singular(%q) = %q, want %q", plural(name), got, name)
+		}
+	}
+}
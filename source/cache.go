@@ -0,0 +1,370 @@
+package source
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/CeoFred/nturu/archive"
+	"github.com/CeoFred/nturu/manifest"
+)
+
+// Cache keeps downloaded template archives, one entry per source and
+// template version:
+//
+//	<Dir>/<source key>/<version>/archive        the archive as downloaded
+//	<Dir>/<source key>/<version>/template.yaml  its manifest, for listings
+//	<Dir>/<source key>/<version>/entry.json     the Entry
+type Cache struct {
+	Dir string
+	// Client downloads archives; nil uses a client with a generous timeout.
+	Client *http.Client
+	// Symlinks says what becomes of symbolic links in archives; by default
+	// they are left out.
+	Symlinks archive.SymlinkPolicy
+}
+
+// CacheDir is where downloaded templates are kept by default:
+// $XDG_CACHE_HOME/nturu/templates, falling back to ~/.cache.
+func CacheDir() string {
+	dir := os.Getenv("XDG_CACHE_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".cache")
+	}
+	return filepath.Join(dir, "nturu", "templates")
+}
+
+// Entry describes one cached template archive.
+type Entry struct {
+	// Source is the URL the archive was downloaded from, including any
+	// //subdir naming the template inside it.
+	Source  string `json:"source"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	// SHA256 is the hex digest of the archive, checked every time the entry
+	// is opened.
+	SHA256  string    `json:"sha256"`
+	Fetched time.Time `json:"fetched"`
+	Used    time.Time `json:"used"`
+
+	dir string
+}
+
+const (
+	archiveFile = "archive"
+	entryFile   = "entry.json"
+)
+
+// IsArchive reports whether ref is an http(s) archive URL the cache handles.
+func IsArchive(ref string) bool {
+	return strings.HasPrefix(ref, "https://") || strings.HasPrefix(ref, "http://")
+}
+
+// Entries lists every cached entry, oldest fetch first. Entries whose
+// metadata cannot be read are reported in the error and left out.
+func (c *Cache) Entries() ([]*Entry, error) {
+	sources, err := os.ReadDir(c.Dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*Entry
+	var errs []error
+	for _, s := range sources {
+		// Dot directories are pulls in progress.
+		if !s.IsDir() || strings.HasPrefix(s.Name(), ".") {
+			continue
+		}
+		versions, err := os.ReadDir(filepath.Join(c.Dir, s.Name()))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, v := range versions {
+			if !v.IsDir() {
+				continue
+			}
+			e, err := readEntry(filepath.Join(c.Dir, s.Name(), v.Name()))
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			entries = append(entries, e)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Fetched.Before(entries[j].Fetched) })
+	return entries, errors.Join(errs...)
+}
+
+// Latest returns the most recently fetched entry for source, or nil when the
+// source was never pulled.
+func (c *Cache) Latest(source string) (*Entry, error) {
+	entries, err := c.Entries()
+	var latest *Entry
+	for _, e := range entries {
+		if e.Source == source {
+			latest = e
+		}
+	}
+	if latest == nil {
+		return nil, err
+	}
+	return latest, nil
+}
+
+// Pull downloads the archive at source and caches it under the version its
+// manifest declares, replacing an entry for the same version.
+func (c *Cache) Pull(source string) (*Entry, error) {
+	u, subdir := splitSubdir(source)
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.MkdirTemp(c.Dir, ".pull-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	sum, err := c.download(u, filepath.Join(tmp, archiveFile))
+	if err != nil {
+		return nil, fmt.Errorf("template %s: %w", source, err)
+	}
+	t, cleanup, err := c.unpack(source, filepath.Join(tmp, archiveFile), subdir)
+	if err != nil {
+		return nil, err
+	}
+	data, err := fs.ReadFile(t.FS, manifest.File)
+	cleanup()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(tmp, manifest.File), data, 0644); err != nil {
+		return nil, err
+	}
+
+	e := &Entry{
+		Source:  source,
+		Name:    t.Manifest.Name,
+		Version: t.Manifest.Version,
+		SHA256:  sum,
+		Fetched: time.Now().UTC(),
+	}
+	e.dir = filepath.Join(c.Dir, sourceKey(source), versionDir(e.Version))
+	if err := e.save(tmp); err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(e.dir), 0755); err != nil {
+		return nil, err
+	}
+	if err := os.RemoveAll(e.dir); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp, e.dir); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Open checks the entry's archive against its recorded digest and unpacks it
+// into a temporary directory, removed by Template.Close.
+func (c *Cache) Open(e *Entry) (*Template, error) {
+	file := filepath.Join(e.dir, archiveFile)
+	sum, err := digest(file)
+	if err != nil {
+		return nil, err
+	}
+	if sum != e.SHA256 {
+		return nil, fmt.Errorf("cached template %s is corrupt: sha256 %s, want %s; pull it again with nturu templates pull %s", e.Source, sum, e.SHA256, e.Source)
+	}
+
+	_, subdir := splitSubdir(e.Source)
+	t, cleanup, err := c.unpack(e.Source, file, subdir)
+	if err != nil {
+		return nil, err
+	}
+	t.cleanup = cleanup
+	t.Digest = "sha256:" + e.SHA256
+
+	// Recording use is only a hint for prune; failing to is not an error.
+	e.Used = time.Now().UTC()
+	e.save(e.dir)
+	return t, nil
+}
+
+// Remove deletes the entry, and its source directory once empty.
+func (c *Cache) Remove(e *Entry) error {
+	if err := os.RemoveAll(e.dir); err != nil {
+		return err
+	}
+	// Fails while other versions remain, which is what we want.
+	os.Remove(filepath.Dir(e.dir))
+	return nil
+}
+
+// template returns the listing form of the entry, with its manifest but no
+// files.
+func (e *Entry) template() (*Template, error) {
+	m, err := manifest.Load(os.DirFS(e.dir))
+	if err != nil {
+		return nil, fmt.Errorf("cached template %s: %w", e.Source, err)
+	}
+	return &Template{
+		Name:     m.Name,
+		Kind:     Cached,
+		Location: e.Source,
+		Digest:   "sha256:" + e.SHA256,
+		Manifest: m,
+	}, nil
+}
+
+func (e *Entry) save(dir string) error {
+	data, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, entryFile), append(data, '\n'), 0644)
+}
+
+func readEntry(dir string) (*Entry, error) {
+	data, err := os.ReadFile(filepath.Join(dir, entryFile))
+	if err != nil {
+		return nil, err
+	}
+	e := &Entry{dir: dir}
+	if err := json.Unmarshal(data, e); err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Join(dir, entryFile), err)
+	}
+	return e, nil
+}
+
+func (c *Cache) download(url, dst string) (string, error) {
+	client := c.Client
+	if client == nil {
+		client = &http.Client{Timeout: 5 * time.Minute}
+	}
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+
+	f, err := os.Create(dst)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, h), resp.Body); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// unpack extracts the archive into a temporary directory and opens the
+// template in subdir, or in the single top-level directory archives of a
+// repository usually wrap everything in.
+func (c *Cache) unpack(source, file, subdir string) (*Template, func() error, error) {
+	tmp, err := os.MkdirTemp("", "nturu-archive-")
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup := func() error { return os.RemoveAll(tmp) }
+
+	if err := archive.Extract(file, tmp, archive.Options{Symlinks: c.Symlinks}); err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("template %s: %w", source, err)
+	}
+	dir := tmp
+	if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(subdir), manifest.File)); err != nil {
+		entries, _ := os.ReadDir(dir)
+		if len(entries) == 1 && entries[0].IsDir() {
+			dir = filepath.Join(dir, entries[0].Name())
+		}
+	}
+	dir = filepath.Join(dir, filepath.FromSlash(subdir))
+
+	t, err := openDir(filepath.Base(dir), Cached, dir)
+	if err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("%w (in %s)", err, source)
+	}
+	t.Name = t.Manifest.Name
+	t.Location = source
+	return t, cleanup, nil
+}
+
+// splitSubdir separates the //subdir suffix naming a template inside an
+// archive from the URL to download.
+func splitSubdir(source string) (url, subdir string) {
+	scheme, rest, _ := strings.Cut(source, "://")
+	if i := strings.Index(rest, "//"); i >= 0 {
+		return scheme + "://" + rest[:i], cleanSubdir(rest[i+2:])
+	}
+	return source, "."
+}
+
+// cleanSubdir keeps dir inside the archive, whatever dots it contains.
+func cleanSubdir(dir string) string {
+	dir = strings.TrimPrefix(path.Clean("/"+dir), "/")
+	if dir == "" {
+		return "."
+	}
+	return dir
+}
+
+func digest(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// sourceKey names the cache directory of a source.
+func sourceKey(source string) string {
+	sum := sha256.Sum256([]byte(source))
+	return hex.EncodeToString(sum[:8])
+}
+
+var unsafeVersion = regexp.MustCompile(`[^A-Za-z0-9._+-]`)
+
+// versionDir turns a manifest version into a directory name.
+func versionDir(version string) string {
+	version = unsafeVersion.ReplaceAllString(version, "_")
+	if version == "" || version == "." || version == ".." {
+		return "unversioned"
+	}
+	return version
+}
@@ -0,0 +1,277 @@
+package source
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// templateZip returns a zip archive holding a template of the given
+// version, with its files below prefix.
+func templateZip(t *testing.T, prefix, version string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	files := map[string]string{
+		"template.yaml": "name: service\nversion: " + version + "\nvariables:\n  - name: AppName\n",
+		"main.go.tmpl":  "package main // {{.AppName}} " + version + "\n",
+	}
+	for name, body := range files {
+		w, err := zw.Create(prefix + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// archiveServer serves archives by path and counts the requests it gets.
+type archiveServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	archives map[string][]byte
+	requests int
+}
+
+func newArchiveServer(t *testing.T) *archiveServer {
+	s := &archiveServer{archives: map[string][]byte{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.requests++
+		data, ok := s.archives[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *archiveServer) serve(path string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.archives[path] = data
+}
+
+func (s *archiveServer) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// testCache returns a cache in the default directory, under an
+// XDG_CACHE_HOME of its own.
+func testCache(t *testing.T) *Cache {
+	home := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", home)
+	c := &Cache{Dir: CacheDir()}
+	if want := filepath.Join(home, "nturu", "templates"); c.Dir != want {
+		t.Fatalf("CacheDir() = %s, want %s", c.Dir, want)
+	}
+	return c
+}
+
+func TestCachePullOpen(t *testing.T) {
+	srv := newArchiveServer(t)
+	data := templateZip(t, "service-main/", "1.0.0")
+	srv.serve("/service.zip", data)
+	c := testCache(t)
+
+	src := srv.URL + "/service.zip"
+	e, err := c.Pull(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(data)
+	if e.Source != src || e.Name != "service" || e.Version != "1.0.0" || e.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("Pull = %+v", e)
+	}
+
+	entries, err := c.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].SHA256 != e.SHA256 || !entries[0].Used.IsZero() {
+		t.Fatalf("Entries = %+v, want the pulled entry, never used", entries)
+	}
+
+	tpl, err := c.Open(entries[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tpl.Close()
+	if tpl.Kind != Cached || tpl.Location != src || tpl.Digest != "sha256:"+e.SHA256 {
+		t.Errorf("Open = %+v", tpl)
+	}
+	// The directory the archive wraps everything in is looked through.
+	body, err := fs.ReadFile(tpl.FS, "main.go.tmpl")
+	if err != nil || !strings.Contains(string(body), "1.0.0") {
+		t.Errorf("main.go.tmpl = %q, %v", body, err)
+	}
+	if entries, _ := c.Entries(); entries[0].Used.IsZero() {
+		t.Error("Open did not record the use of the entry")
+	}
+}
+
+func TestCachePullSubdir(t *testing.T) {
+	srv := newArchiveServer(t)
+	srv.serve("/templates.zip", templateZip(t, "templates-main/service/", "2.0.0"))
+	c := testCache(t)
+
+	e, err := c.Pull(srv.URL + "/templates.zip//service")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Version != "2.0.0" {
+		t.Errorf("Version = %s, want 2.0.0", e.Version)
+	}
+}
+
+func TestCachePullErrors(t *testing.T) {
+	srv := newArchiveServer(t)
+	srv.serve("/bogus.zip", []byte("not an archive"))
+	c := testCache(t)
+
+	if _, err := c.Pull(srv.URL + "/missing.zip"); err == nil || !strings.Contains(err.Error(), "404 Not Found") {
+		t.Errorf("Pull of a missing archive = %v, want a 404", err)
+	}
+	if _, err := c.Pull(srv.URL + "/bogus.zip"); err == nil {
+		t.Error("Pull of a file that is no archive succeeded")
+	}
+	// Failed pulls leave nothing behind, not even their temporary directory.
+	dirs, err := os.ReadDir(c.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dirs) != 0 {
+		t.Errorf("cache holds %d entries after failed pulls", len(dirs))
+	}
+}
+
+func TestCacheDigestMismatch(t *testing.T) {
+	srv := newArchiveServer(t)
+	srv.serve("/service.zip", templateZip(t, "", "1.0.0"))
+	c := testCache(t)
+
+	e, err := c.Pull(srv.URL + "/service.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Replace the cached archive with another valid one.
+	if err := os.WriteFile(filepath.Join(e.dir, archiveFile), templateZip(t, "", "1.0.1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.Open(e)
+	if err == nil || !strings.Contains(err.Error(), "is corrupt") || !strings.Contains(err.Error(), "want "+e.SHA256) {
+		t.Errorf("Open of a tampered archive = %v, want a digest mismatch", err)
+	}
+}
+
+func TestCatalogOffline(t *testing.T) {
+	srv := newArchiveServer(t)
+	srv.serve("/service.zip", templateZip(t, "", "1.0.0"))
+	catalog := &Catalog{Cache: testCache(t), Offline: true}
+	src := srv.URL + "/service.zip"
+
+	_, err := catalog.Resolve(src)
+	if err == nil || !strings.Contains(err.Error(), "is not cached and --offline forbids downloading it") {
+		t.Errorf("Resolve offline with a cold cache = %v", err)
+	}
+	if n := srv.count(); n != 0 {
+		t.Errorf("offline Resolve made %d requests", n)
+	}
+
+	catalog.Offline = false
+	tpl, err := catalog.Resolve(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl.Close()
+
+	// Once cached, the template opens without the network.
+	catalog.Offline = true
+	srv.Close()
+	tpl, err = catalog.Resolve(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl.Close()
+	if n := srv.count(); n != 1 {
+		t.Errorf("server got %d requests, want 1", n)
+	}
+}
+
+func TestCacheRepull(t *testing.T) {
+	srv := newArchiveServer(t)
+	srv.serve("/service.zip", templateZip(t, "", "1.0.0"))
+	c := testCache(t)
+	src := srv.URL + "/service.zip"
+
+	if _, err := c.Pull(src); err != nil {
+		t.Fatal(err)
+	}
+	// A new version is cached beside the old one and becomes the latest.
+	srv.serve("/service.zip", templateZip(t, "", "1.1.0"))
+	if _, err := c.Pull(src); err != nil {
+		t.Fatal(err)
+	}
+	latest, err := c.Latest(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest.Version != "1.1.0" {
+		t.Errorf("Latest = %s, want 1.1.0", latest.Version)
+	}
+
+	// The same version pulled again replaces its entry.
+	changed := templateZip(t, "service/", "1.1.0")
+	srv.serve("/service.zip", changed)
+	e, err := c.Pull(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := c.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var versions []string
+	for _, e := range entries {
+		versions = append(versions, e.Version)
+	}
+	if strings.Join(versions, " ") != "1.0.0 1.1.0" {
+		t.Errorf("cached versions = %q, want [1.0.0 1.1.0]", versions)
+	}
+	if sum := sha256.Sum256(changed); e.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Error("pulling a version again kept the old archive")
+	}
+	tpl, err := c.Open(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl.Close()
+
+	if err := c.Remove(entries[0]); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := c.Entries(); len(entries) != 1 || entries[0].Version != "1.1.0" {
+		t.Errorf("Entries after Remove = %+v", entries)
+	}
+}
@@ -0,0 +1,157 @@
+package source
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// GitPrefix marks a template kept in a git repository, as in
+// git+https://host/org/repo//subdir@v1.4.0.
+const GitPrefix = "git+"
+
+// gitSource is a parsed git+<url>[//<subdir>][@<ref>] template reference.
+type gitSource struct {
+	URL string
+	// Dir is the template directory inside the repository, "." for the root.
+	Dir string
+	// Ref is a tag, branch or commit; empty means the default branch.
+	Ref string
+}
+
+func parseGit(ref string) (gitSource, error) {
+	g := gitSource{Dir: "."}
+	s, gitRef, found := cutGitRef(strings.TrimPrefix(ref, GitPrefix))
+	if found && gitRef == "" {
+		return gitSource{}, fmt.Errorf("template %s: empty ref after @", ref)
+	}
+	g.Ref = gitRef
+	scheme, rest, ok := strings.Cut(s, "://")
+	if !ok || scheme == "" || rest == "" {
+		return gitSource{}, fmt.Errorf("template %s: want git+<url>[//<subdir>][@<ref>]", ref)
+	}
+
+	// Skip the leading slash of file:///abs paths when looking for "//".
+	if i := strings.Index(rest[1:], "//"); i >= 0 {
+		rest, g.Dir = rest[:i+1], path.Clean(rest[i+3:])
+		if g.Dir == ".." || strings.HasPrefix(g.Dir, "../") || path.IsAbs(g.Dir) {
+			return gitSource{}, fmt.Errorf("template %s: subdirectory %q is outside the repository", ref, g.Dir)
+		}
+	}
+	g.URL = scheme + "://" + rest
+	return g, nil
+}
+
+// cutGitRef splits a git template reference at the "@" introducing its
+// tag, branch or commit. That is the first "@" in the path, so user info
+// such as git@host stays with the host and branches such as feature/x keep
+// their slashes.
+func cutGitRef(ref string) (before, gitRef string, found bool) {
+	host := 0
+	if i := strings.Index(ref, "://"); i >= 0 {
+		host = i + len("://")
+	}
+	slash := strings.Index(ref[host:], "/")
+	if slash < 0 {
+		return ref, "", false
+	}
+	at := strings.Index(ref[host+slash:], "@")
+	if at < 0 {
+		return ref, "", false
+	}
+	at += host + slash
+	return ref[:at], ref[at+1:], true
+}
+
+// openGit clones the repository ref points to into a temporary directory and
+// checks out the requested ref. The clone is removed by Template.Close.
+func openGit(ref string) (*Template, error) {
+	g, err := parseGit(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.MkdirTemp("", "nturu-git-")
+	if err != nil {
+		return nil, err
+	}
+	cleanup := func() error { return os.RemoveAll(tmp) }
+
+	t, err := checkoutGit(ref, g, tmp)
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+	t.cleanup = cleanup
+	return t, nil
+}
+
+func checkoutGit(ref string, g gitSource, tmp string) (*Template, error) {
+	repo := filepath.Join(tmp, "repo")
+	if _, err := git("", "clone", "--quiet", "--no-checkout", "--", g.URL, repo); err != nil {
+		return nil, fmt.Errorf("template %s: %w", ref, err)
+	}
+	commit, err := resolveCommit(repo, g.Ref)
+	if err != nil {
+		return nil, fmt.Errorf("template %s: %w", ref, err)
+	}
+	if _, err := git(repo, "-c", "advice.detachedHead=false", "checkout", "--quiet", "--detach", commit); err != nil {
+		return nil, fmt.Errorf("template %s: %w", ref, err)
+	}
+
+	dir := filepath.Join(repo, filepath.FromSlash(g.Dir))
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("template %s: no directory %s at %s", ref, g.Dir, commit)
+	}
+	t, err := openDir(path.Base(g.URL), Git, dir)
+	if err != nil {
+		return nil, err
+	}
+	t.Name = t.Manifest.Name
+	t.Location = ref
+	t.Commit = commit
+	return t, nil
+}
+
+// resolveCommit returns the full SHA of the tag, branch or commit ref in the
+// freshly cloned repo, where branches only exist as remote-tracking refs.
+func resolveCommit(repo, ref string) (string, error) {
+	if ref == "" {
+		ref = "HEAD"
+	}
+	for _, candidate := range []string{ref, "refs/tags/" + ref, "origin/" + ref} {
+		out, err := git(repo, "rev-parse", "--verify", "--quiet", candidate+"^{commit}")
+		if err == nil {
+			return strings.TrimSpace(out), nil
+		}
+	}
+	return "", fmt.Errorf("no tag, branch or commit %q", ref)
+}
+
+// git runs git in dir and returns its standard output. Failures carry git's
+// own message.
+func git(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	// Never stop to ask for credentials; nturu may be running unattended.
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return "", errors.New("git templates need git installed")
+		}
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			return "", fmt.Errorf("git %s: %w", args[0], err)
+		}
+		return "", fmt.Errorf("git %s: %s", args[0], msg)
+	}
+	return stdout.String(), nil
+}
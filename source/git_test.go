@@ -0,0 +1,166 @@
+package source
+
+import (
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseGit(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want gitSource
+	}{
+		{"git+https://host/org/repo", gitSource{URL: "https://host/org/repo", Dir: "."}},
+		{"git+https://host/org/repo//subdir@v1.4.0", gitSource{URL: "https://host/org/repo", Dir: "subdir", Ref: "v1.4.0"}},
+		{"git+https://host/org/repo@main", gitSource{URL: "https://host/org/repo", Dir: ".", Ref: "main"}},
+		{"git+ssh://git@host/org/repo.git//a/b", gitSource{URL: "ssh://git@host/org/repo.git", Dir: "a/b"}},
+		{"git+file:///srv/repo.git//tpl@abc123", gitSource{URL: "file:///srv/repo.git", Dir: "tpl", Ref: "abc123"}},
+		{"git+https://github.com/acme/tpl@feature/x", gitSource{URL: "https://github.com/acme/tpl", Dir: ".", Ref: "feature/x"}},
+		{"git+https://github.com/acme/tpl//svc@release/1.x/rc", gitSource{URL: "https://github.com/acme/tpl", Dir: "svc", Ref: "release/1.x/rc"}},
+		{"git+https://user@host/org/repo", gitSource{URL: "https://user@host/org/repo", Dir: "."}},
+		{"git+ssh://git@host/org/repo.git@feature/x", gitSource{URL: "ssh://git@host/org/repo.git", Dir: ".", Ref: "feature/x"}},
+		{"git+ssh://git@host/org/repo.git//a/b@v2", gitSource{URL: "ssh://git@host/org/repo.git", Dir: "a/b", Ref: "v2"}},
+	}
+	for _, tt := range tests {
+		got, err := parseGit(tt.ref)
+		if err != nil {
+			t.Errorf("parseGit(%q): %v", tt.ref, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseGit(%q) = %+v, want %+v", tt.ref, got, tt.want)
+		}
+	}
+
+	for _, ref := range []string{"git+", "git+/srv/repo", "git+https://host/repo@", "git+https://host/repo//../x"} {
+		if _, err := parseGit(ref); err == nil {
+			t.Errorf("parseGit(%q) succeeded, want an error", ref)
+		}
+	}
+}
+
+func TestWithGitRef(t *testing.T) {
+	tests := []struct {
+		ref, want string
+	}{
+		{"git+https://host/org/repo", "git+https://host/org/repo@abc123"},
+		{"git+https://host/org/repo//tpl@v1.0.0", "git+https://host/org/repo//tpl@abc123"},
+		{"git+https://host/org/repo@feature/x", "git+https://host/org/repo@abc123"},
+		{"git+ssh://git@host/org/repo.git//tpl", "git+ssh://git@host/org/repo.git//tpl@abc123"},
+	}
+	for _, tt := range tests {
+		if got := WithGitRef(tt.ref, "abc123"); got != tt.want {
+			t.Errorf("WithGitRef(%q) = %s, want %s", tt.ref, got, tt.want)
+		}
+	}
+}
+
+// TestResolveGit checks out a bare repository on disk, so it needs git but
+// no network.
+func TestResolveGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	bare, commits := makeRepo(t)
+
+	tests := []struct {
+		ref     string
+		version string
+		commit  string
+	}{
+		{"", "2.0.0", commits[1]},
+		{"@v1.0.0", "1.0.0", commits[0]},
+		{"@main", "2.0.0", commits[1]},
+		{"@old", "1.0.0", commits[0]},
+		{"@release/1.x", "1.0.0", commits[0]},
+		{"@" + commits[0][:12], "1.0.0", commits[0]},
+	}
+	var c Catalog
+	for _, tt := range tests {
+		ref := "git+file://" + filepath.ToSlash(bare) + "//tpl" + tt.ref
+		tmpl, err := c.Resolve(ref)
+		if err != nil {
+			t.Errorf("Resolve(%q): %v", ref, err)
+			continue
+		}
+		if tmpl.Kind != Git || tmpl.Name != "skeleton" || tmpl.Location != ref {
+			t.Errorf("Resolve(%q) = %s %s %s", ref, tmpl.Kind, tmpl.Name, tmpl.Location)
+		}
+		if tmpl.Manifest.Version != tt.version {
+			t.Errorf("Resolve(%q) version = %s, want %s", ref, tmpl.Manifest.Version, tt.version)
+		}
+		if tmpl.Commit != tt.commit {
+			t.Errorf("Resolve(%q) commit = %s, want %s", ref, tmpl.Commit, tt.commit)
+		}
+		dir := tmpl.FS
+		if err := tmpl.Close(); err != nil {
+			t.Errorf("Close: %v", err)
+		}
+		if _, err := fs.Stat(dir, "template.yaml"); err == nil {
+			t.Errorf("checkout of %q still readable after Close", ref)
+		}
+	}
+
+	for _, ref := range []string{
+		"git+file://" + filepath.ToSlash(bare) + "//tpl@v9",
+		"git+file://" + filepath.ToSlash(bare) + "//nope",
+	} {
+		if _, err := c.Resolve(ref); err == nil {
+			t.Errorf("Resolve(%q) succeeded, want an error", ref)
+		}
+	}
+}
+
+// makeRepo creates a bare repository with a template in tpl/ at version
+// 1.0.0, tagged v1.0.0 and branched as old and release/1.x, then 2.0.0 on
+// main. It returns
+// the bare repository and both commits.
+func makeRepo(t *testing.T) (string, []string) {
+	t.Helper()
+	root := t.TempDir()
+	work := filepath.Join(root, "work")
+	bare := filepath.Join(root, "repo.git")
+
+	run := func(dir string, args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+			"GIT_CONFIG_GLOBAL="+os.DevNull, "GIT_CONFIG_NOSYSTEM=1")
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	write := func(version string) {
+		t.Helper()
+		manifest := "name: skeleton\nversion: " + version + "\nvariables:\n  - name: AppName\n    required: true\n"
+		if err := os.WriteFile(filepath.Join(work, "tpl", "template.yaml"), []byte(manifest), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Join(work, "tpl"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	run(work, "init", "--quiet", "--initial-branch=main")
+	write("1.0.0")
+	run(work, "add", ".")
+	run(work, "commit", "--quiet", "-m", "v1")
+	run(work, "tag", "v1.0.0")
+	run(work, "branch", "old")
+	run(work, "branch", "release/1.x")
+	first := run(work, "rev-parse", "HEAD")
+	write("2.0.0")
+	run(work, "commit", "--quiet", "-am", "v2")
+	second := run(work, "rev-parse", "HEAD")
+	run(root, "clone", "--quiet", "--bare", work, bare)
+	return bare, []string{first, second}
+}
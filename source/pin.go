@@ -0,0 +1,76 @@
+package source
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ResolvePinned opens the template ref refers to as it was recorded: a git
+// template at commit, an archive template from the cached copy with digest.
+// Other templates only exist in their current version, which callers must
+// check against the one they expect.
+func (c *Catalog) ResolvePinned(ref, commit, digest string) (*Template, error) {
+	switch {
+	case strings.HasPrefix(ref, GitPrefix) && commit != "":
+		return c.Resolve(WithGitRef(ref, commit))
+	case IsArchive(ref) && digest != "" && c.Cache != nil:
+		return c.openCached(ref, func(e *Entry) bool { return "sha256:"+e.SHA256 == digest },
+			"no cached copy with "+digest)
+	}
+	return c.Resolve(ref)
+}
+
+// ResolveVersion opens version of the template ref refers to: a tag, branch
+// or commit for git templates, a cached version for archive templates. Other
+// templates are opened as they are and must already be at version.
+func (c *Catalog) ResolveVersion(ref, version string) (*Template, error) {
+	switch {
+	case strings.HasPrefix(ref, GitPrefix):
+		return c.Resolve(WithGitRef(ref, version))
+	case IsArchive(ref) && c.Cache != nil:
+		return c.openCached(ref, func(e *Entry) bool { return sameVersion(e.Version, version) },
+			"version "+version+" is not cached; pull it with nturu templates pull")
+	}
+
+	t, err := c.Resolve(ref)
+	if err != nil {
+		return nil, err
+	}
+	if !sameVersion(t.Manifest.Version, version) {
+		t.Close()
+		return nil, fmt.Errorf("template %s is at version %s; version %s is not available", ref, t.Manifest.Version, version)
+	}
+	return t, nil
+}
+
+// openCached opens the most recently fetched cache entry of ref that match
+// accepts, failing with notFound when there is none.
+func (c *Catalog) openCached(ref string, match func(*Entry) bool, notFound string) (*Template, error) {
+	entries, err := c.Cache.Entries()
+	var found *Entry
+	for _, e := range entries {
+		if e.Source == ref && match(e) {
+			found = e
+		}
+	}
+	if found == nil && err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, fmt.Errorf("template %s: %s", ref, notFound)
+	}
+	return c.Cache.Open(found)
+}
+
+// WithGitRef returns the git template reference ref pinned to gitRef
+// instead of whatever ref it named.
+func WithGitRef(ref, gitRef string) string {
+	ref, _, _ = cutGitRef(ref)
+	return ref + "@" + gitRef
+}
+
+// sameVersion compares versions ignoring a leading "v", so v1.2.0 and 1.2.0
+// name the same release.
+func sameVersion(a, b string) bool {
+	return strings.TrimPrefix(a, "v") == strings.TrimPrefix(b, "v")
+}
@@ -0,0 +1,312 @@
+// Package source finds templates and opens them as file systems.
+//
+// Every template, wherever it comes from, is presented the same way: an
+// fs.FS rooted at the template with its manifest at the top.
+package source
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/CeoFred/nturu/manifest"
+)
+
+// Kind tells where a template comes from.
+type Kind string
+
+const (
+	// Embedded templates are compiled into the binary.
+	Embedded Kind = "embedded"
+	// Local templates are directories under LocalDir.
+	Local Kind = "local"
+	// Directory templates are opened from a path given by the user.
+	Directory Kind = "directory"
+	// Git templates are checked out of a repository.
+	Git Kind = "git"
+	// Cached templates are archives downloaded into the Cache.
+	Cached Kind = "cached"
+)
+
+// Template is a template opened from the catalog, with its manifest loaded.
+type Template struct {
+	Name string
+	Kind Kind
+	// Location is where the template was read from: an absolute directory,
+	// a git reference, or "embedded" for built-in templates.
+	Location string
+	// Commit is the full SHA a git template was checked out at, so the same
+	// files can be generated again.
+	Commit string
+	// Digest is "sha256:<hex>" of the archive a cached template came from.
+	Digest string
+	// FS is nil for cached templates returned by List; Resolve them to read
+	// their files.
+	FS       fs.FS
+	Manifest *manifest.Manifest
+
+	cleanup func() error
+}
+
+// Ref returns what Resolve needs to open the template again.
+func (t *Template) Ref() string {
+	switch t.Kind {
+	case Embedded, Local:
+		return t.Name
+	}
+	return t.Location
+}
+
+// Close releases whatever opening the template needed, such as a git
+// checkout. The template's FS must not be used afterwards.
+func (t *Template) Close() error {
+	if t.cleanup == nil {
+		return nil
+	}
+	return t.cleanup()
+}
+
+// ErrNotFound is returned when no template has the requested name.
+var ErrNotFound = errors.New("template not found")
+
+// Catalog knows every template that can be opened by name.
+type Catalog struct {
+	// Embedded holds the built-in templates as templates/<name>/<name>.zip.
+	Embedded fs.FS
+	// LocalDir holds user templates, one directory per template. Empty
+	// disables local templates.
+	LocalDir string
+	// Cache keeps templates downloaded from http(s) archive URLs. Nil
+	// disables archive templates.
+	Cache *Cache
+	// Offline refuses every source needing the network: archives must be
+	// cached already and git templates must be local.
+	Offline bool
+}
+
+// LocalDir is where user templates live by default:
+// $XDG_DATA_HOME/nturu/templates, falling back to ~/.local/share.
+func LocalDir() string {
+	dir := os.Getenv("XDG_DATA_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dir, "nturu", "templates")
+}
+
+// Open returns the template called name. A local template replaces an
+// embedded one of the same name.
+func (c *Catalog) Open(name string) (*Template, error) {
+	if c.LocalDir != "" {
+		dir := filepath.Join(c.LocalDir, name)
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return openDir(name, Local, dir)
+		}
+	}
+	if c.Embedded != nil {
+		t, err := c.openEmbedded(name)
+		if !errors.Is(err, fs.ErrNotExist) {
+			return t, err
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+}
+
+// Resolve opens the template ref refers to: a git+ reference, a template
+// directory given as a path or file:// URL, or the name of a template in the
+// catalog. Callers must Close the template when done.
+func (c *Catalog) Resolve(ref string) (*Template, error) {
+	if strings.HasPrefix(ref, GitPrefix) {
+		if c.Offline && !strings.HasPrefix(ref, GitPrefix+"file://") {
+			return nil, fmt.Errorf("template %s needs the network, which --offline forbids", ref)
+		}
+		return openGit(ref)
+	}
+	if IsArchive(ref) {
+		return c.openArchive(ref)
+	}
+	if !IsLocation(ref) {
+		return c.Open(ref)
+	}
+	dir, err := localPath(ref)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("template directory %s does not exist", dir)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("template %s: %w", ref, err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("template %s is not a directory", ref)
+	}
+	t, err := openDir(filepath.Base(dir), Directory, dir)
+	if err != nil {
+		return nil, err
+	}
+	t.Name = t.Manifest.Name
+	return t, nil
+}
+
+// openArchive opens the cached copy of the archive at ref, downloading it
+// first if it was never pulled.
+func (c *Catalog) openArchive(ref string) (*Template, error) {
+	if c.Cache == nil {
+		return nil, fmt.Errorf("template %s: archive templates are not supported", ref)
+	}
+	e, err := c.Cache.Latest(ref)
+	if e == nil && err != nil {
+		return nil, err
+	}
+	if e == nil && c.Offline {
+		return nil, fmt.Errorf("template %s is not cached and --offline forbids downloading it; run nturu templates pull %s first", ref, ref)
+	}
+	if e == nil {
+		e, err = c.Cache.Pull(ref)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return c.Cache.Open(e)
+}
+
+// IsLocation reports whether ref points at a template, as a path or URL,
+// rather than naming one in the catalog.
+func IsLocation(ref string) bool {
+	return strings.Contains(ref, "://") || strings.ContainsAny(ref, `/\`) || ref == "." || ref == ".."
+}
+
+// IsPath reports whether ref is a plain file system path, which callers may
+// want to anchor somewhere other than the working directory.
+func IsPath(ref string) bool {
+	return IsLocation(ref) && !strings.Contains(ref, "://")
+}
+
+// localPath returns the absolute directory a path or file:// URL refers to.
+func localPath(ref string) (string, error) {
+	if !strings.Contains(ref, "://") {
+		return filepath.Abs(ref)
+	}
+	u, err := url.Parse(ref)
+	if err != nil {
+		return "", fmt.Errorf("template %s: %w", ref, err)
+	}
+	if u.Scheme != "file" {
+		return "", fmt.Errorf("template %s: unsupported source %q", ref, u.Scheme)
+	}
+	// file:///abs/dir is the usual form; file://rel/dir is taken relative to
+	// the working directory rather than as a host name.
+	p := u.Path
+	if u.Host != "" && u.Host != "localhost" {
+		p = u.Host + p
+	}
+	return filepath.Abs(filepath.FromSlash(p))
+}
+
+// List opens every template in the catalog, sorted by name, with cached
+// templates listed once per version. Templates that fail to open are
+// reported in the returned error and left out.
+func (c *Catalog) List() ([]*Template, error) {
+	var templates []*Template
+	var errs []error
+	seen := map[string]bool{}
+
+	if c.LocalDir != "" {
+		entries, err := os.ReadDir(c.LocalDir)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, err)
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				continue
+			}
+			t, err := openDir(entry.Name(), Local, filepath.Join(c.LocalDir, entry.Name()))
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			templates = append(templates, t)
+			seen[t.Name] = true
+		}
+	}
+
+	if c.Embedded != nil {
+		entries, err := fs.ReadDir(c.Embedded, "templates")
+		if err != nil {
+			errs = append(errs, err)
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() || seen[entry.Name()] {
+				continue
+			}
+			t, err := c.openEmbedded(entry.Name())
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			templates = append(templates, t)
+		}
+	}
+
+	if c.Cache != nil {
+		entries, err := c.Cache.Entries()
+		if err != nil {
+			errs = append(errs, err)
+		}
+		for _, e := range entries {
+			t, err := e.template()
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			templates = append(templates, t)
+		}
+	}
+
+	sort.SliceStable(templates, func(i, j int) bool { return templates[i].Name < templates[j].Name })
+	return templates, errors.Join(errs...)
+}
+
+func (c *Catalog) openEmbedded(name string) (*Template, error) {
+	data, err := fs.ReadFile(c.Embedded, path.Join("templates", name, name+".zip"))
+	if err != nil {
+		return nil, err
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("template %s: %w", name, err)
+	}
+	return load(name, Embedded, string(Embedded), zr)
+}
+
+func openDir(name string, kind Kind, dir string) (*Template, error) {
+	return load(name, kind, dir, os.DirFS(dir))
+}
+
+func load(name string, kind Kind, location string, fsys fs.FS) (*Template, error) {
+	m, err := manifest.Load(fsys)
+	if err != nil {
+		return nil, fmt.Errorf("template %s: %w", name, err)
+	}
+	return &Template{
+		Name:     name,
+		Kind:     kind,
+		Location: location,
+		FS:       fsys,
+		Manifest: m,
+	}, nil
+}
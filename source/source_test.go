@@ -0,0 +1,140 @@
+package source
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// writeTemplate writes a template called name with the given version into
+// dir.
+func writeTemplate(t *testing.T, dir, name, version string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	data := "name: " + name + "\nversion: " + version + "\nvariables:\n  - name: AppName\n"
+	if err := os.WriteFile(filepath.Join(dir, "template.yaml"), []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// chdir changes the working directory to dir for the rest of the test.
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func TestCatalogLocal(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", home)
+	dir := LocalDir()
+	if want := filepath.Join(home, "nturu", "templates"); dir != want {
+		t.Fatalf("LocalDir() = %s, want %s", dir, want)
+	}
+	writeTemplate(t, filepath.Join(dir, "service"), "service", "2.0.0")
+	// A stray file next to the templates is not one.
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	catalog := &Catalog{
+		Embedded: fstest.MapFS{
+			"templates/service/service.zip": {Data: templateZip(t, "", "1.0.0")},
+			"templates/web/web.zip":         {Data: templateZip(t, "", "1.0.0")},
+		},
+		LocalDir: dir,
+	}
+
+	tpl, err := catalog.Resolve("service")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tpl.Kind != Local || tpl.Location != filepath.Join(dir, "service") || tpl.Manifest.Version != "2.0.0" {
+		t.Errorf("Resolve(service) = %s %s %s, want the local template to replace the built-in one", tpl.Kind, tpl.Location, tpl.Manifest.Version)
+	}
+	if tpl.Ref() != "service" {
+		t.Errorf("Ref() = %s, want service", tpl.Ref())
+	}
+
+	tpl, err = catalog.Resolve("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tpl.Kind != Embedded {
+		t.Errorf("Resolve(web) is %s, want embedded", tpl.Kind)
+	}
+
+	if _, err := catalog.Resolve("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Resolve(missing) = %v, want ErrNotFound", err)
+	}
+
+	templates, err := catalog.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var listed []string
+	for _, tpl := range templates {
+		listed = append(listed, tpl.Name+" "+string(tpl.Kind))
+	}
+	if got, want := strings.Join(listed, ", "), "service local, web embedded"; got != want {
+		t.Errorf("List() = %s, want %s", got, want)
+	}
+}
+
+func TestResolveDirectory(t *testing.T) {
+	// The working directory comes back with symlinks resolved.
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(root, "templates", "svc")
+	writeTemplate(t, dir, "service", "1.0.0")
+	if err := os.WriteFile(filepath.Join(root, "file"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	chdir(t, filepath.Join(root, "templates"))
+
+	catalog := &Catalog{}
+	for _, ref := range []string{
+		"./svc",
+		"svc/",
+		"../templates/svc",
+		dir,
+		"file://" + filepath.ToSlash(dir),
+		"file://localhost" + filepath.ToSlash(dir),
+		"file://svc",
+	} {
+		tpl, err := catalog.Resolve(ref)
+		if err != nil {
+			t.Errorf("Resolve(%s): %v", ref, err)
+			continue
+		}
+		if tpl.Kind != Directory || tpl.Location != dir || tpl.Name != "service" {
+			t.Errorf("Resolve(%s) = %s %s %s, want directory %s named service", ref, tpl.Kind, tpl.Location, tpl.Name, dir)
+		}
+		if tpl.Ref() != dir {
+			t.Errorf("Resolve(%s).Ref() = %s, want %s", ref, tpl.Ref(), dir)
+		}
+	}
+
+	for ref, want := range map[string]string{
+		"./missing":     "template directory " + filepath.Join(root, "templates", "missing") + " does not exist",
+		"../file":       "template ../file is not a directory",
+		"ftp://example": `template ftp://example: unsupported source "ftp"`,
+	} {
+		if _, err := catalog.Resolve(ref); err == nil || err.Error() != want {
+			t.Errorf("Resolve(%s) = %v, want %s", ref, err, want)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+// Package spec loads nturu.yaml project spec files.
+//
+// A spec records everything `nturu generate` needs to produce a project
+// without asking questions, so it can be checked in and replayed:
+//
+//	version: 1
+//	template: fiber
+//	name: orders
+//	module: github.com/acme/orders
+//	output: services/orders
+//	features: [swagger, otp]
+//	variables:
+//	  Port: 3009
+package spec
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultFile is the spec file name looked up by convention.
+const DefaultFile = "nturu.yaml"
+
+// CurrentVersion is the only spec format version understood today.
+const CurrentVersion = 1
+
+// Position is a 1-based line and column inside a spec file.
+type Position struct {
+	Line   int
+	Column int
+}
+
+// Value is a scalar read from the spec together with where it was found, so
+// callers validating it against a template can point back at the file.
+type Value struct {
+	Value string
+	Pos   Position
+}
+
+// Variable is one entry of the variables mapping.
+type Variable struct {
+	Name string
+	Value
+}
+
+type Spec struct {
+	// Path is the file the spec was read from.
+	Path string
+
+	Version  int
+	Template Value
+	Name     Value
+	Module   Value
+	Output   Value
+	// Features is nil when the spec does not list features, and empty when
+	// it lists none.
+	Features  []Value
+	Variables []Variable
+}
+
+// Error is a problem found at a specific place in a spec file.
+type Error struct {
+	Path string
+	Pos  Position
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s", e.Path, e.Pos.Line, e.Pos.Column, e.Msg)
+}
+
+// Errorf returns an *Error located at pos in s.
+func (s *Spec) Errorf(pos Position, format string, args ...any) error {
+	return &Error{Path: s.Path, Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// Load reads and validates the spec file at path. Every problem found is
+// reported, joined into a single error.
+func Load(path string) (*Spec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(path, data)
+}
+
+// Parse validates data as the contents of the spec file at path.
+func Parse(path string, data []byte) (*Spec, error) {
+	s := &Spec{Path: path, Version: CurrentVersion}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(doc.Content) == 0 {
+		return nil, fmt.Errorf("%s: spec is empty", path)
+	}
+
+	p := &parser{spec: s}
+	p.document(doc.Content[0])
+	if len(p.errs) > 0 {
+		return nil, errors.Join(p.errs...)
+	}
+	return s, nil
+}
+
+type parser struct {
+	spec *Spec
+	errs []error
+}
+
+func (p *parser) errorf(n *yaml.Node, format string, args ...any) {
+	p.errs = append(p.errs, p.spec.Errorf(pos(n), format, args...))
+}
+
+func (p *parser) document(root *yaml.Node) {
+	if root.Kind != yaml.MappingNode {
+		p.errorf(root, "spec must be a mapping of keys to values")
+		return
+	}
+
+	seen := map[string]bool{}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+		if seen[key.Value] {
+			p.errorf(key, "duplicate key %q", key.Value)
+			continue
+		}
+		seen[key.Value] = true
+
+		switch key.Value {
+		case "version":
+			p.version(value)
+		case "template":
+			p.spec.Template = p.scalar(key, value)
+		case "name":
+			p.spec.Name = p.scalar(key, value)
+			if strings.ContainsAny(p.spec.Name.Value, `/\`) {
+				p.errorf(value, "name %q must not contain path separators", p.spec.Name.Value)
+			}
+		case "module":
+			p.spec.Module = p.scalar(key, value)
+			if strings.ContainsAny(p.spec.Module.Value, " \t") {
+				p.errorf(value, "module %q must not contain whitespace", p.spec.Module.Value)
+			}
+		case "output":
+			p.spec.Output = p.scalar(key, value)
+		case "features":
+			p.features(value)
+		case "variables":
+			p.variables(value)
+		default:
+			p.errorf(key, "unknown key %q", key.Value)
+		}
+	}
+}
+
+func (p *parser) version(n *yaml.Node) {
+	v, err := strconv.Atoi(n.Value)
+	if n.Kind != yaml.ScalarNode || err != nil {
+		p.errorf(n, "version must be an integer")
+		return
+	}
+	if v != CurrentVersion {
+		p.errorf(n, "unsupported spec version %d (want %d)", v, CurrentVersion)
+		return
+	}
+	p.spec.Version = v
+}
+
+func (p *parser) scalar(key, n *yaml.Node) Value {
+	if n.Kind != yaml.ScalarNode {
+		p.errorf(n, "%s must be a string", key.Value)
+		return Value{}
+	}
+	if n.Value == "" {
+		p.errorf(n, "%s must not be empty", key.Value)
+	}
+	return Value{Value: n.Value, Pos: pos(n)}
+}
+
+func (p *parser) features(n *yaml.Node) {
+	if n.Kind != yaml.SequenceNode {
+		p.errorf(n, "features must be a list of feature names")
+		return
+	}
+	// An empty list is kept apart from a missing key: it turns every
+	// feature off.
+	p.spec.Features = []Value{}
+	seen := map[string]bool{}
+	for _, item := range n.Content {
+		if item.Kind != yaml.ScalarNode || item.Value == "" {
+			p.errorf(item, "feature must be a name")
+			continue
+		}
+		if seen[item.Value] {
+			p.errorf(item, "feature %q listed twice", item.Value)
+			continue
+		}
+		seen[item.Value] = true
+		p.spec.Features = append(p.spec.Features, Value{Value: item.Value, Pos: pos(item)})
+	}
+}
+
+func (p *parser) variables(n *yaml.Node) {
+	if n.Kind != yaml.MappingNode {
+		p.errorf(n, "variables must be a mapping of names to values")
+		return
+	}
+	seen := map[string]bool{}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key, value := n.Content[i], n.Content[i+1]
+		if seen[key.Value] {
+			p.errorf(key, "duplicate variable %q", key.Value)
+			continue
+		}
+		seen[key.Value] = true
+		if value.Kind != yaml.ScalarNode {
+			p.errorf(value, "variable %q must be a string, number or boolean", key.Value)
+			continue
+		}
+		p.spec.Variables = append(p.spec.Variables, Variable{
+			Name:  key.Value,
+			Value: Value{Value: value.Value, Pos: pos(value)},
+		})
+	}
+}
+
+func pos(n *yaml.Node) Position {
+	return Position{Line: n.Line, Column: n.Column}
+}
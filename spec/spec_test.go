@@ -0,0 +1,183 @@
+package spec
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	data := `version: 1
+template: fiber
+name: orders
+module: github.com/acme/orders
+output: services/orders
+features: [swagger, otp]
+variables:
+  Port: 3009
+  Debug: true
+`
+	s, err := Parse("nturu.yaml", []byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Spec{
+		Path:     "nturu.yaml",
+		Version:  1,
+		Template: Value{"fiber", Position{2, 11}},
+		Name:     Value{"orders", Position{3, 7}},
+		Module:   Value{"github.com/acme/orders", Position{4, 9}},
+		Output:   Value{"services/orders", Position{5, 9}},
+		Features: []Value{{"swagger", Position{6, 12}}, {"otp", Position{6, 21}}},
+		Variables: []Variable{
+			{Name: "Port", Value: Value{"3009", Position{8, 9}}},
+			{Name: "Debug", Value: Value{"true", Position{9, 10}}},
+		},
+	}
+	if !reflect.DeepEqual(s, want) {
+		t.Errorf("Parse:\n%+v\nwant:\n%+v", s, want)
+	}
+}
+
+func TestParseVersionDefault(t *testing.T) {
+	s, err := Parse("nturu.yaml", []byte("template: default\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Version != CurrentVersion {
+		t.Errorf("Version = %d, want %d", s.Version, CurrentVersion)
+	}
+}
+
+func TestParseNoFeatures(t *testing.T) {
+	s, err := Parse("nturu.yaml", []byte("template: fiber\nfeatures: []\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Features == nil || len(s.Features) != 0 {
+		t.Errorf("Features = %#v, want an empty list", s.Features)
+	}
+	s, err = Parse("nturu.yaml", []byte("template: fiber\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Features != nil {
+		t.Errorf("Features = %#v without the key, want nil", s.Features)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		// want lists the errors expected, in order, each with its position.
+		want []string
+	}{
+		{
+			name: "not a mapping",
+			data: "- fiber\n",
+			want: []string{"nturu.yaml:1:1: spec must be a mapping of keys to values"},
+		},
+		{
+			name: "unknown and duplicate keys",
+			data: "template: fiber\ntemplates: fiber\ntemplate: default\n",
+			want: []string{
+				`nturu.yaml:2:1: unknown key "templates"`,
+				`nturu.yaml:3:1: duplicate key "template"`,
+			},
+		},
+		{
+			name: "version",
+			data: "version: one\n",
+			want: []string{"nturu.yaml:1:10: version must be an integer"},
+		},
+		{
+			name: "unsupported version",
+			data: "version: 2\n",
+			want: []string{"nturu.yaml:1:10: unsupported spec version 2 (want 1)"},
+		},
+		{
+			name: "scalars",
+			data: "template: [fiber]\nname: ''\nmodule: example.com/a b\n",
+			want: []string{
+				"nturu.yaml:1:11: template must be a string",
+				"nturu.yaml:2:7: name must not be empty",
+				`nturu.yaml:3:9: module "example.com/a b" must not contain whitespace`,
+			},
+		},
+		{
+			name: "name with a path",
+			data: "name: services/orders\n",
+			want: []string{`nturu.yaml:1:7: name "services/orders" must not contain path separators`},
+		},
+		{
+			name: "features",
+			data: "features:\n  - swagger\n  - {otp: true}\n  - swagger\n",
+			want: []string{
+				"nturu.yaml:3:5: feature must be a name",
+				`nturu.yaml:4:5: feature "swagger" listed twice`,
+			},
+		},
+		{
+			name: "features not a list",
+			data: "features: swagger\n",
+			want: []string{"nturu.yaml:1:11: features must be a list of feature names"},
+		},
+		{
+			name: "variables",
+			data: "variables:\n  Port: 3009\n  Tags: [a, b]\n  Port: 3010\n",
+			want: []string{
+				`nturu.yaml:3:9: variable "Tags" must be a string, number or boolean`,
+				`nturu.yaml:4:3: duplicate variable "Port"`,
+			},
+		},
+		{
+			name: "variables not a mapping",
+			data: "variables: [Port]\n",
+			want: []string{"nturu.yaml:1:12: variables must be a mapping of names to values"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse("nturu.yaml", []byte(tt.data))
+			if err == nil {
+				t.Fatal("Parse succeeded")
+			}
+			if got := strings.Split(err.Error(), "\n"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("errors:\n%s\nwant:\n%s", err, strings.Join(tt.want, "\n"))
+			}
+			var serr *Error
+			if !errors.As(err, &serr) {
+				t.Errorf("no *Error in %v", err)
+			}
+		})
+	}
+}
+
+func TestParseInvalidYAML(t *testing.T) {
+	for _, data := range []string{"", "template: [fiber\n"} {
+		_, err := Parse("nturu.yaml", []byte(data))
+		if err == nil || !strings.HasPrefix(err.Error(), "nturu.yaml: ") {
+			t.Errorf("Parse(%q) = %v, want an error naming the file", data, err)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	name := filepath.Join(t.TempDir(), DefaultFile)
+	if err := os.WriteFile(name, []byte("template: fiber\nname: x/y\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := Load(name)
+	var serr *Error
+	if !errors.As(err, &serr) || serr.Path != name || serr.Pos != (Position{2, 7}) {
+		t.Errorf("Load = %v, want an error at %s:2:7", err, name)
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), DefaultFile)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Load of a missing file = %v, want os.ErrNotExist", err)
+	}
+}
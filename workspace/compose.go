@@ -0,0 +1,89 @@
+package workspace
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// composeService is how a service is run in the compose file: air
+// rebuilds it on every change, with the whole workspace mounted so the
+// service builds against go.work and the shared module.
+type composeService struct {
+	Image         string   `yaml:"image"`
+	ContainerName string   `yaml:"container_name"`
+	Restart       string   `yaml:"restart"`
+	Volumes       []string `yaml:"volumes"`
+	WorkingDir    string   `yaml:"working_dir"`
+	Networks      []string `yaml:"networks"`
+}
+
+// compose adds s to the services of the compose file, keeping the rest of
+// the file as it is.
+func (w *Workspace) compose(s Service) error {
+	name := filepath.Join(w.Dir, Compose)
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	if doc.Kind != yaml.DocumentNode || doc.Content[0].Kind != yaml.MappingNode {
+		return fmt.Errorf("%s is not a compose file", name)
+	}
+	root := doc.Content[0]
+
+	services := mapValue(root, "services")
+	if services == nil {
+		services = &yaml.Node{Kind: yaml.MappingNode}
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "services"}, services)
+	}
+	if services.Kind == yaml.ScalarNode && services.Tag == "!!null" {
+		*services = yaml.Node{Kind: yaml.MappingNode}
+	}
+	if services.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s: services is not a mapping", name)
+	}
+	if mapValue(services, s.Name) != nil {
+		return fmt.Errorf("%s already runs a service %s", name, s.Name)
+	}
+	// services: {} in a new workspace.
+	services.Style = 0
+
+	var value yaml.Node
+	err = value.Encode(composeService{
+		Image:         "cosmtrek/air",
+		ContainerName: s.Name,
+		Restart:       "on-failure",
+		Volumes:       []string{".:/workspace"},
+		WorkingDir:    "/workspace/" + s.Dir,
+		Networks:      []string{network},
+	})
+	if err != nil {
+		return err
+	}
+	services.Content = append(services.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: s.Name}, &value)
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return err
+	}
+	return os.WriteFile(name, buf.Bytes(), 0644)
+}
+
+// mapValue returns the value of key in the mapping node m, or nil.
+func mapValue(m *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package workspace
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/semver"
+)
+
+// use adds the module in the slash-separated directory dir to go.work,
+// raising its go version to the one the module declares when newer.
+func (w *Workspace) use(dir string) error {
+	name := filepath.Join(w.Dir, GoWork)
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	work, err := modfile.ParseWork(name, data, nil)
+	if err != nil {
+		return err
+	}
+
+	modName := filepath.Join(w.Dir, filepath.FromSlash(dir), "go.mod")
+	modData, err := os.ReadFile(modName)
+	if err != nil {
+		return err
+	}
+	mod, err := modfile.ParseLax(modName, modData, nil)
+	if err != nil {
+		return err
+	}
+	if mod.Go != nil && (work.Go == nil || semver.Compare("v"+mod.Go.Version, "v"+work.Go.Version) > 0) {
+		if err := work.AddGoStmt(mod.Go.Version); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	if err := work.AddUse("./"+dir, ""); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	work.SortBlocks()
+	work.Cleanup()
+	return os.WriteFile(name, modfile.Format(work.Syntax), 0644)
+}
@@ -0,0 +1,205 @@
+// Package workspace creates and maintains nturu workspaces: monorepos in
+// which several generated services live side by side, like
+//
+//	shop/
+//	  nturu.workspace.yaml   the manifest listing the services
+//	  go.work                uses ./shared and every service module
+//	  docker-compose.yaml    runs every service with air
+//	  Makefile               generates Go code from shared/proto
+//	  shared/                module for protocol buffers and common code
+//	  orders/                a service generated from a template
+//
+// The manifest records the workspace module path, below which the shared
+// module and every service get theirs, and where each service came from.
+package workspace
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// File is the manifest name, at the root of a workspace.
+const File = "nturu.workspace.yaml"
+
+// CurrentVersion is the manifest format version written today.
+const CurrentVersion = 1
+
+// Files of a workspace besides its manifest.
+const (
+	GoWork  = "go.work"
+	Compose = "docker-compose.yaml"
+	Shared  = "shared"
+)
+
+// goVersion is the Go version new workspaces and their shared module start
+// at; go.work is raised to the newest version a service module needs.
+const goVersion = "1.21"
+
+// network is the compose network every service joins.
+const network = "nturu"
+
+type Workspace struct {
+	// Dir is the directory of the workspace; it is not stored.
+	Dir string `yaml:"-"`
+
+	Version int    `yaml:"version"`
+	Name    string `yaml:"name"`
+	// Module is the module path prefix: the shared module is Module/shared
+	// and a service named orders Module/orders.
+	Module   string    `yaml:"module"`
+	Services []Service `yaml:"services"`
+}
+
+// Service is a project generated into the workspace.
+type Service struct {
+	Name     string `yaml:"name"`
+	Template string `yaml:"template"`
+	Module   string `yaml:"module"`
+	// Dir is the slash-separated directory of the service module, relative
+	// to the workspace; for templates keeping go.mod in a subdirectory it
+	// is that subdirectory, such as billing/src.
+	Dir string `yaml:"dir"`
+}
+
+// ErrNotFound is returned by Find when no directory holds a manifest.
+var ErrNotFound = errors.New("no " + File + " found; create a workspace with nturu new workspace")
+
+// Find loads the workspace whose manifest is in dir or the nearest parent.
+func Find(dir string) (*Workspace, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		w, err := read(dir)
+		if !errors.Is(err, fs.ErrNotExist) {
+			return w, err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, ErrNotFound
+		}
+		dir = parent
+	}
+}
+
+func read(dir string) (*Workspace, error) {
+	name := filepath.Join(dir, File)
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	w := &Workspace{}
+	if err := yaml.Unmarshal(data, w); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if w.Version != CurrentVersion {
+		return nil, fmt.Errorf("%s: unsupported workspace version %d, want %d", name, w.Version, CurrentVersion)
+	}
+	w.Dir = dir
+	return w, nil
+}
+
+// Save writes the manifest of w.
+func (w *Workspace) Save() error {
+	w.Version = CurrentVersion
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(w); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(w.Dir, File), buf.Bytes(), 0644)
+}
+
+// Service returns the service called name, or nil.
+func (w *Workspace) Service(name string) *Service {
+	for i := range w.Services {
+		if w.Services[i].Name == name {
+			return &w.Services[i]
+		}
+	}
+	return nil
+}
+
+// ServiceModule is the module path of the service called name.
+func (w *Workspace) ServiceModule(name string) string {
+	return w.Module + "/" + name
+}
+
+// Create lays out a new workspace in w.Dir, which must not exist or be
+// empty, and writes its manifest.
+func Create(w *Workspace) error {
+	entries, err := os.ReadDir(w.Dir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if len(entries) > 0 {
+		return fmt.Errorf("%s already exists and is not empty", w.Dir)
+	}
+
+	files := map[string]string{
+		GoWork:                                 "go " + goVersion + "\n\nuse ./" + Shared + "\n",
+		Compose:                                composeFile,
+		"Makefile":                             makefile,
+		".gitignore":                           ".env\n.bin/\ntmp/\n",
+		path.Join(Shared, "go.mod"):            "module " + w.Module + "/" + Shared + "\n\ngo " + goVersion + "\n",
+		path.Join(Shared, "doc.go"):            fmt.Sprintf("// Package shared holds the code the services of %s share.\npackage shared\n", w.Name),
+		path.Join(Shared, "proto", ".gitkeep"): "",
+	}
+	for name, content := range files {
+		name = filepath.Join(w.Dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			return err
+		}
+	}
+	w.Services = nil
+	return w.Save()
+}
+
+// AddService registers s, which is already generated, in go.work, the
+// compose file and the manifest.
+func (w *Workspace) AddService(s Service) error {
+	if w.Service(s.Name) != nil {
+		return fmt.Errorf("workspace %s already has a service %s", w.Name, s.Name)
+	}
+	if err := w.use(s.Dir); err != nil {
+		return err
+	}
+	if err := w.compose(s); err != nil {
+		return err
+	}
+	w.Services = append(w.Services, s)
+	return w.Save()
+}
+
+// composeFile starts without blank lines, which go when services are
+// added to it.
+const composeFile = `version: "3.8"
+services: {}
+networks:
+  ` + network + `:
+    driver: bridge
+`
+
+const makefile = `# Generates Go code for the protocol buffers in shared/proto, for the
+# services to import from the shared module.
+PROTO_DIR := ./shared/proto
+
+proto:
+	protoc --go_out=. --go_opt=paths=source_relative \
+	    --go-grpc_out=. --go-grpc_opt=paths=source_relative \
+	    $(PROTO_DIR)/*.proto
+
+.PHONY: proto
+`
@@ -0,0 +1,76 @@
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWorkspace(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "shop")
+	w := &Workspace{Dir: dir, Name: "shop", Module: "example.com/shop"}
+	if err := Create(w); err != nil {
+		t.Fatal(err)
+	}
+	if err := Create(w); err == nil {
+		t.Error("Create accepted a workspace that exists already")
+	}
+
+	// A service whose go.mod is in a subdirectory needing a newer Go.
+	mod := filepath.Join(dir, "billing", "src", "go.mod")
+	if err := os.MkdirAll(filepath.Dir(mod), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(mod, []byte("module example.com/shop/billing\n\ngo 1.22.1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	nested := filepath.Join(dir, "billing", "src", "internal")
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatal(err)
+	}
+	found, err := Find(nested)
+	if err != nil {
+		t.Fatal(err)
+	}
+	billing := Service{Name: "billing", Template: "default", Module: "example.com/shop/billing", Dir: "billing/src"}
+	if err := found.AddService(billing); err != nil {
+		t.Fatal(err)
+	}
+	if err := found.AddService(billing); err == nil {
+		t.Error("AddService added billing twice")
+	}
+
+	read := func(name string) string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	if got, want := read(GoWork), "go 1.22.1\n\nuse (\n\t./billing/src\n\t./shared\n)\n"; got != want {
+		t.Errorf("go.work is\n%s\nwant\n%s", got, want)
+	}
+	compose := read(Compose)
+	for _, want := range []string{
+		"services:\n  billing:\n    image: cosmtrek/air\n",
+		"    working_dir: /workspace/billing/src\n",
+		"networks:\n  nturu:\n    driver: bridge\n",
+	} {
+		if !strings.Contains(compose, want) {
+			t.Errorf("%s lacks %q:\n%s", Compose, want, compose)
+		}
+	}
+
+	again, err := Find(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := again.Service("billing"); s == nil || *s != billing {
+		t.Errorf("manifest records billing as %+v, want %+v", s, billing)
+	}
+	if _, err := Find(t.TempDir()); err != ErrNotFound {
+		t.Errorf("Find outside a workspace returned %v, want ErrNotFound", err)
+	}
+}